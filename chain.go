@@ -5,7 +5,12 @@
 
 package web
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
 
 // ChainHandlers executes each function from the arguments with handler
 // from the next function to construct a chan fo callers.
@@ -31,3 +36,158 @@ func FinalHandlerFunc(h func(w http.ResponseWriter, r *http.Request)) func(http.
 		return http.HandlerFunc(h)
 	}
 }
+
+// Chain is an ordered list of named middleware. Unlike ChainHandlers, it can
+// be inspected, extended and conditionally applied. Chain is immutable, all
+// methods return a new Chain.
+type Chain struct {
+	middleware []chainMiddleware
+	timing     func(r *http.Request, timings []MiddlewareTiming)
+}
+
+type chainMiddleware struct {
+	name string
+	fn   func(http.Handler) http.Handler
+	when func(r *http.Request) bool
+}
+
+// MiddlewareTiming is the duration of a single middleware execution.
+type MiddlewareTiming struct {
+	// Name is the middleware name, or "handler" for the final handler.
+	Name string
+	// Duration includes the execution of all inner middleware and the
+	// handler.
+	Duration time.Duration
+	// Self is the duration excluding inner middleware and the handler.
+	Self time.Duration
+}
+
+// NewChain returns an empty Chain.
+func NewChain() Chain {
+	return Chain{}
+}
+
+// Append returns a Chain with the middleware added as the innermost one.
+func (c Chain) Append(name string, m func(http.Handler) http.Handler) Chain {
+	return c.with(len(c.middleware), chainMiddleware{name: name, fn: m})
+}
+
+// Prepend returns a Chain with the middleware added as the outermost one.
+func (c Chain) Prepend(name string, m func(http.Handler) http.Handler) Chain {
+	return c.with(0, chainMiddleware{name: name, fn: m})
+}
+
+// When returns a Chain with the middleware appended that is executed only
+// for requests for which the predicate returns true.
+func (c Chain) When(predicate func(r *http.Request) bool, name string, m func(http.Handler) http.Handler) Chain {
+	return c.with(len(c.middleware), chainMiddleware{name: name, fn: m, when: predicate})
+}
+
+// Extend returns a Chain with all middleware from other chains appended.
+func (c Chain) Extend(chains ...Chain) Chain {
+	for _, o := range chains {
+		for _, m := range o.middleware {
+			c = c.with(len(c.middleware), m)
+		}
+	}
+	return c
+}
+
+// WithTiming returns a Chain that measures the duration of every middleware
+// and the final handler, and passes them to the function after the request
+// is served, ordered from the outermost one.
+func (c Chain) WithTiming(fn func(r *http.Request, timings []MiddlewareTiming)) Chain {
+	c.timing = fn
+	return c
+}
+
+// Names returns middleware names in the order of execution. Conditional
+// middleware names are suffixed with " (conditional)".
+func (c Chain) Names() []string {
+	names := make([]string, 0, len(c.middleware))
+	for _, m := range c.middleware {
+		if m.when != nil {
+			names = append(names, m.name+" (conditional)")
+			continue
+		}
+		names = append(names, m.name)
+	}
+	return names
+}
+
+// String returns middleware names in the order of execution.
+func (c Chain) String() string {
+	return strings.Join(c.Names(), " -> ")
+}
+
+// Then returns the handler wrapped with all middleware.
+func (c Chain) Then(h http.Handler) http.Handler {
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+	if c.timing != nil {
+		h = timedLayer(len(c.middleware), h)
+	}
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		m := c.middleware[i]
+		next := h
+		h = m.fn(next)
+		if m.when != nil {
+			wrapped, when := h, m.when
+			h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if when(r) {
+					wrapped.ServeHTTP(w, r)
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+		}
+		if c.timing != nil {
+			h = timedLayer(i, h)
+		}
+	}
+	if c.timing == nil {
+		return h
+	}
+	names := append(c.Names(), "handler")
+	timing, inner := c.timing, h
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		durations := make([]time.Duration, len(names))
+		inner.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), chainTimingContextKey{}, durations)))
+		timings := make([]MiddlewareTiming, len(names))
+		for i, name := range names {
+			self := durations[i]
+			if i+1 < len(durations) {
+				self -= durations[i+1]
+			}
+			timings[i] = MiddlewareTiming{Name: name, Duration: durations[i], Self: self}
+		}
+		timing(r, timings)
+	})
+}
+
+// ThenFunc returns the handler function wrapped with all middleware.
+func (c Chain) ThenFunc(h func(w http.ResponseWriter, r *http.Request)) http.Handler {
+	return c.Then(http.HandlerFunc(h))
+}
+
+func (c Chain) with(i int, m chainMiddleware) Chain {
+	middleware := make([]chainMiddleware, 0, len(c.middleware)+1)
+	middleware = append(middleware, c.middleware[:i]...)
+	middleware = append(middleware, m)
+	middleware = append(middleware, c.middleware[i:]...)
+	c.middleware = middleware
+	return c
+}
+
+type chainTimingContextKey struct{}
+
+func timedLayer(i int, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		h.ServeHTTP(w, r)
+		if durations, ok := r.Context().Value(chainTimingContextKey{}).([]time.Duration); ok && i < len(durations) {
+			durations[i] = time.Since(start)
+		}
+	})
+}
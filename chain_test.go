@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestChain(t *testing.T) {
@@ -108,3 +109,122 @@ func TestFinalHandlerFunc(t *testing.T) {
 		t.Errorf("expected body %q, got %q", "01", string(b))
 	}
 }
+
+func chainTestMiddleware(s string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(s))
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestChain_Then(t *testing.T) {
+	base := NewChain().
+		Append("b", chainTestMiddleware("b")).
+		Prepend("a", chainTestMiddleware("a"))
+	c := base.
+		Extend(NewChain().Append("c", chainTestMiddleware("c"))).
+		When(func(r *http.Request) bool { return r.URL.Path == "/d" }, "d", chainTestMiddleware("d"))
+
+	if v := base.String(); v != "a -> b" {
+		t.Errorf("expected %q, got %q", "a -> b", v)
+	}
+	if v := c.String(); v != "a -> b -> c -> d (conditional)" {
+		t.Errorf("expected %q, got %q", "a -> b -> c -> d (conditional)", v)
+	}
+
+	h := c.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("h"))
+	})
+	for path, want := range map[string]string{
+		"/":  "abch",
+		"/d": "abcdh",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if v := w.Body.String(); v != want {
+			t.Errorf("%s: expected body %q, got %q", path, want, v)
+		}
+	}
+}
+
+func TestChain_WithTiming(t *testing.T) {
+	var timings []MiddlewareTiming
+	h := NewChain().
+		Append("a", chainTestMiddleware("a")).
+		Append("b", chainTestMiddleware("b")).
+		WithTiming(func(r *http.Request, t []MiddlewareTiming) {
+			timings = t
+		}).
+		ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(10 * time.Millisecond)
+		})
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if len(timings) != 3 {
+		t.Fatalf("expected %v timings, got %v", 3, len(timings))
+	}
+	for i, name := range []string{"a", "b", "handler"} {
+		if timings[i].Name != name {
+			t.Errorf("expected name %q, got %q", name, timings[i].Name)
+		}
+		if timings[i].Duration < 10*time.Millisecond {
+			t.Errorf("%s: expected duration of at least 10ms, got %v", name, timings[i].Duration)
+		}
+	}
+	if timings[2].Self != timings[2].Duration {
+		t.Errorf("expected handler self duration %v, got %v", timings[2].Duration, timings[2].Self)
+	}
+	if timings[0].Self >= 10*time.Millisecond {
+		t.Errorf("expected small self duration, got %v", timings[0].Self)
+	}
+}
+
+func TestChain_WithTimingConditional(t *testing.T) {
+	var (
+		timings []MiddlewareTiming
+		path    string
+	)
+	h := NewChain().
+		Append("a", chainTestMiddleware("a")).
+		When(func(r *http.Request) bool { return r.URL.Path == "/b" }, "b", chainTestMiddleware("b")).
+		WithTiming(func(r *http.Request, t []MiddlewareTiming) {
+			timings = t
+			path = r.URL.Path
+		}).
+		ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("h"))
+		})
+
+	for p, want := range map[string]string{
+		"/":  "ah",
+		"/b": "abh",
+	} {
+		timings = nil
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", p, nil))
+
+		if v := w.Body.String(); v != want {
+			t.Errorf("%s: expected body %q, got %q", p, want, v)
+		}
+		if path != p {
+			t.Errorf("%s: expected timing request path %q, got %q", p, p, path)
+		}
+		if len(timings) != 3 {
+			t.Fatalf("%s: expected %v timings, got %v", p, 3, len(timings))
+		}
+		for i, name := range []string{"a", "b (conditional)", "handler"} {
+			if timings[i].Name != name {
+				t.Errorf("%s: expected name %q, got %q", p, name, timings[i].Name)
+			}
+			if timings[i].Self < 0 || timings[i].Self > timings[i].Duration {
+				t.Errorf("%s: %s: expected self duration between 0 and %v, got %v", p, name, timings[i].Duration, timings[i].Self)
+			}
+		}
+		if timings[0].Duration < timings[1].Duration || timings[1].Duration < timings[2].Duration {
+			t.Errorf("%s: expected durations to include inner ones, got %+v", p, timings)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package decoders provides request body decoders for content codings that
+// are not supported by the standard library, to be used with
+// web.DecompressHandler. They are kept in a separate package so that only
+// programs that use them depend on their implementations.
+package decoders
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"resenje.org/web"
+)
+
+// All returns a new map with web.DefaultDecoders and decoders for br and zstd
+// content codings, that can be set as web.DecompressHandler Decoders.
+func All() map[string]web.DecoderFunc {
+	decoders := make(map[string]web.DecoderFunc, len(web.DefaultDecoders)+2)
+	for name, f := range web.DefaultDecoders {
+		decoders[name] = f
+	}
+	decoders["br"] = NewBrotli
+	decoders["zstd"] = NewZstd
+	return decoders
+}
+
+// NewBrotli is a web.DecoderFunc for the br content coding.
+func NewBrotli(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(brotli.NewReader(r)), nil
+}
+
+// NewZstd is a web.DecoderFunc for the zstd content coding.
+func NewZstd(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
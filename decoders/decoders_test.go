@@ -0,0 +1,116 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package decoders_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"resenje.org/web"
+	"resenje.org/web/decoders"
+)
+
+func TestAll(t *testing.T) {
+	data := strings.Repeat("resenje ", 100)
+
+	for _, tc := range []struct {
+		encoding string
+		encode   func(w io.Writer) io.WriteCloser
+	}{
+		{
+			encoding: "gzip",
+			encode:   func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		},
+		{
+			encoding: "br",
+			encode:   func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+		},
+		{
+			encoding: "zstd",
+			encode: func(w io.Writer) io.WriteCloser {
+				e, err := zstd.NewWriter(w)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return e
+			},
+		},
+		{
+			encoding: "br, gzip",
+			encode: func(w io.Writer) io.WriteCloser {
+				g := gzip.NewWriter(w)
+				return &chainedWriter{WriteCloser: brotli.NewWriter(g), outer: g}
+			},
+		},
+	} {
+		t.Run(tc.encoding, func(t *testing.T) {
+			var body bytes.Buffer
+			e := tc.encode(&body)
+			if _, err := io.WriteString(e, data); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			var got string
+			h := web.DecompressHandler{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, err := io.ReadAll(r.Body)
+					if err != nil {
+						t.Error(err)
+					}
+					got = string(b)
+				}),
+				Decoders: decoders.All(),
+			}
+			r := httptest.NewRequest("POST", "/", &body)
+			r.Header.Set("Content-Encoding", tc.encoding)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("expected status code %d, got %d", http.StatusOK, w.Code)
+			}
+			if got != data {
+				t.Errorf("expected body %q, got %q", data, got)
+			}
+		})
+	}
+}
+
+func TestAll_defaultDecodersUnchanged(t *testing.T) {
+	decoders.All()
+
+	for _, name := range []string{"br", "zstd"} {
+		if _, ok := web.DefaultDecoders[name]; ok {
+			t.Errorf("expected no %s decoder in default decoders", name)
+		}
+	}
+}
+
+// chainedWriter encodes data with the embedded writer that writes to the outer
+// writer, closing both on Close.
+type chainedWriter struct {
+	io.WriteCloser
+	outer io.WriteCloser
+}
+
+func (w *chainedWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return w.outer.Close()
+}
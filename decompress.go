@@ -0,0 +1,254 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DecoderFunc constructs a reader that decodes data from the provided reader
+// compressed with a specific content coding.
+type DecoderFunc func(r io.Reader) (io.ReadCloser, error)
+
+// DefaultDecoders are content decoders used by DecompressHandler if its
+// Decoders field is nil. Only the content codings supported by the standard
+// library are included, while decoders for other codings, such as br and
+// zstd from the resenje.org/web/decoders package, can be added to the
+// Decoders field.
+var DefaultDecoders = map[string]DecoderFunc{
+	"gzip":    newGzipDecoder,
+	"x-gzip":  newGzipDecoder,
+	"deflate": newDeflateDecoder,
+}
+
+// ErrDecompressionRatioExceeded is returned by the request body reader when
+// the ratio between decompressed and compressed data exceeds the configured
+// MaxRatio of the DecompressHandler.
+var ErrDecompressionRatioExceeded = errors.New("decompression ratio exceeded")
+
+// decompressRatioMinSize is the number of decompressed bytes that have to be
+// read before the compression ratio is checked, as short inputs can have very
+// high ratios without being harmful.
+const decompressRatioMinSize = 64 * 1024
+
+// DecompressHandler transparently decodes request bodies that are compressed
+// as specified by the Content-Encoding HTTP header. It protects against
+// decompression bombs by limiting the size of both compressed and decompressed
+// data and the ratio between them.
+//
+// Requests with an unsupported content coding are responded with the 415
+// Unsupported Media Type HTTP response, and requests with the Content-Length
+// header greater than CompressedLimit with the 413 Request Entity Too Large
+// response. As the decompressed size is known only while the body is read,
+// reading the body returns an *http.MaxBytesError if any of the limits is
+// reached, or ErrDecompressionRatioExceeded if the ratio is exceeded, which
+// should be handled by the Handler.
+type DecompressHandler struct {
+	// Handler will be used with the request body decoded.
+	Handler http.Handler
+	// CompressedLimit is a maximum number of bytes that a compressed request
+	// body can have. If it is 0, there is no limit, unlike with
+	// MaxBodyBytesHandler Limit where 0 rejects requests with a body.
+	CompressedLimit int64
+	// DecompressedLimit is a maximum number of bytes that a decoded request
+	// body can have. If it is 0, there is no limit.
+	DecompressedLimit int64
+	// MaxRatio is a maximum allowed ratio between decompressed and compressed
+	// body sizes. If it is 0, the ratio is not checked.
+	MaxRatio float64
+	// Decoders map content coding names to their decoders. If it is nil,
+	// DefaultDecoders are used. Function All from the
+	// resenje.org/web/decoders package returns DefaultDecoders extended with
+	// br and zstd decoders.
+	Decoders map[string]DecoderFunc
+	// RequestEntityTooLargeHandler will be used if the Content-Length of the
+	// request is greater than CompressedLimit.
+	RequestEntityTooLargeHandler http.Handler
+	// UnsupportedMediaTypeHandler will be used if the request body is
+	// compressed with unsupported content coding.
+	UnsupportedMediaTypeHandler http.Handler
+}
+
+// ServeHTTP serves an HTTP response for a request.
+func (h DecompressHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	decoders := h.Decoders
+	if decoders == nil {
+		decoders = DefaultDecoders
+	}
+
+	encodings := contentEncodings(r.Header)
+	for _, e := range encodings {
+		if _, ok := decoders[e]; !ok {
+			h.unsupportedMediaType(w, r, decoders)
+			return
+		}
+	}
+
+	if h.CompressedLimit > 0 && r.ContentLength > h.CompressedLimit {
+		h.requestEntityTooLarge(w, r)
+		return
+	}
+
+	if len(encodings) == 0 || r.Body == nil || r.Body == http.NoBody {
+		if h.CompressedLimit > 0 && r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, h.CompressedLimit)
+		}
+		h.Handler.ServeHTTP(w, r)
+		return
+	}
+
+	compressed := &countingReader{r: r.Body}
+	var body io.Reader = compressed
+	if h.CompressedLimit > 0 {
+		compressed.r = http.MaxBytesReader(w, r.Body, h.CompressedLimit)
+	}
+	closers := []io.Closer{r.Body}
+	// Content codings are listed in the order in which they were applied.
+	for i := len(encodings) - 1; i >= 0; i-- {
+		d, err := decoders[encodings[i]](body)
+		if err != nil {
+			closeAll(closers)
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				h.requestEntityTooLarge(w, r)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		closers = append(closers, d)
+		body = d
+	}
+
+	rr := r.Clone(r.Context())
+	rr.Body = &decompressReader{
+		r:          body,
+		compressed: compressed,
+		limit:      h.DecompressedLimit,
+		maxRatio:   h.MaxRatio,
+		closers:    closers,
+	}
+	rr.ContentLength = -1
+	rr.Header.Del("Content-Encoding")
+	rr.Header.Del("Content-Length")
+
+	h.Handler.ServeHTTP(w, rr)
+}
+
+func (h DecompressHandler) requestEntityTooLarge(w http.ResponseWriter, r *http.Request) {
+	if h.RequestEntityTooLargeHandler != nil {
+		h.RequestEntityTooLargeHandler.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+}
+
+func (h DecompressHandler) unsupportedMediaType(w http.ResponseWriter, r *http.Request, decoders map[string]DecoderFunc) {
+	// Advertise supported codings as specified in RFC 7694.
+	accept := make([]string, 0, len(decoders))
+	for e := range decoders {
+		accept = append(accept, e)
+	}
+	sort.Strings(accept)
+	w.Header().Set("Accept-Encoding", strings.Join(accept, ", "))
+	if h.UnsupportedMediaTypeHandler != nil {
+		h.UnsupportedMediaTypeHandler.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+}
+
+// contentEncodings returns a list of lowercase content codings from the
+// Content-Encoding header values, excluding identity.
+func contentEncodings(header http.Header) (encodings []string) {
+	for _, v := range header.Values("Content-Encoding") {
+		for _, e := range strings.Split(v, ",") {
+			e = strings.ToLower(strings.TrimSpace(e))
+			if e == "" || e == "identity" {
+				continue
+			}
+			encodings = append(encodings, e)
+		}
+	}
+	return encodings
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type decompressReader struct {
+	r          io.Reader
+	compressed *countingReader
+	limit      int64
+	maxRatio   float64
+	n          int64
+	err        error
+	closers    []io.Closer
+}
+
+func (d *decompressReader) Read(p []byte) (n int, err error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if d.limit > 0 && int64(len(p)) > d.limit-d.n+1 {
+		// Read one byte more than allowed to detect that the limit is
+		// exceeded and not just reached.
+		p = p[:d.limit-d.n+1]
+	}
+	n, err = d.r.Read(p)
+	d.n += int64(n)
+	if d.limit > 0 && d.n > d.limit {
+		n -= int(d.n - d.limit)
+		d.n = d.limit
+		d.err = &http.MaxBytesError{Limit: d.limit}
+		return n, d.err
+	}
+	if d.maxRatio > 0 && d.n > decompressRatioMinSize && float64(d.n) > d.maxRatio*float64(d.compressed.n) {
+		d.err = fmt.Errorf("%w: %v", ErrDecompressionRatioExceeded, d.maxRatio)
+		return n, d.err
+	}
+	if err != nil {
+		d.err = err
+	}
+	return n, err
+}
+
+func (d *decompressReader) Close() error {
+	return closeAll(d.closers)
+}
+
+func closeAll(closers []io.Closer) (err error) {
+	for i := len(closers) - 1; i >= 0; i-- {
+		if e := closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func newGzipDecoder(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func newDeflateDecoder(r io.Reader) (io.ReadCloser, error) {
+	// HTTP deflate content coding is the zlib format as specified in RFC 9110.
+	return zlib.NewReader(r)
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecompressHandler(t *testing.T) {
+	data := strings.Repeat("resenje ", 100)
+
+	for _, tc := range []struct {
+		encoding string
+		encode   func(w io.Writer) io.WriteCloser
+	}{
+		{
+			encoding: "gzip",
+			encode:   func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		},
+		{
+			encoding: "deflate",
+			encode:   func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		},
+	} {
+		t.Run(tc.encoding, func(t *testing.T) {
+			body := compress(t, tc.encode, data)
+
+			var got, gotEncoding string
+			h := DecompressHandler{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, err := io.ReadAll(r.Body)
+					if err != nil {
+						t.Error(err)
+					}
+					got = string(b)
+					gotEncoding = r.Header.Get("Content-Encoding")
+				}),
+			}
+			r := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+			r.Header.Set("Content-Encoding", tc.encoding)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("expected status code %d, got %d", http.StatusOK, w.Code)
+			}
+			if got != data {
+				t.Errorf("expected body %q, got %q", data, got)
+			}
+			if gotEncoding != "" {
+				t.Errorf("expected no Content-Encoding header, got %q", gotEncoding)
+			}
+		})
+	}
+}
+
+func TestDecompressHandler_MultipleEncodings(t *testing.T) {
+	data := "resenje"
+	body := compress(t, func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }, data)
+	body = compress(t, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, string(body))
+
+	var got string
+	h := DecompressHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Error(err)
+			}
+			got = string(b)
+		}),
+	}
+	r := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+	r.Header.Set("Content-Encoding", "deflate, gzip")
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	if got != data {
+		t.Errorf("expected body %q, got %q", data, got)
+	}
+}
+
+func TestDecompressHandler_UnsupportedMediaType(t *testing.T) {
+	h := DecompressHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("handler called")
+		}),
+		Decoders: map[string]DecoderFunc{
+			"gzip": DefaultDecoders["gzip"],
+		},
+	}
+	r := httptest.NewRequest("POST", "/", strings.NewReader("data"))
+	r.Header.Set("Content-Encoding", "compress")
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status code %d, got %d", http.StatusUnsupportedMediaType, w.Code)
+	}
+	if v := w.Header().Get("Accept-Encoding"); v != "gzip" {
+		t.Errorf("expected Accept-Encoding header %q, got %q", "gzip", v)
+	}
+}
+
+func TestDecompressHandler_CompressedLimit(t *testing.T) {
+	body := compress(t, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, "resenje")
+
+	h := DecompressHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("handler called")
+		}),
+		CompressedLimit: 10,
+	}
+	r := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status code %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
+
+func TestDecompressHandler_DecompressedLimit(t *testing.T) {
+	data := strings.Repeat("0", 1000)
+	body := compress(t, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, data)
+
+	var got []byte
+	var gotErr error
+	h := DecompressHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, gotErr = io.ReadAll(r.Body)
+		}),
+		DecompressedLimit: 100,
+	}
+	r := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(gotErr, &maxBytesErr) {
+		t.Fatalf("expected http.MaxBytesError, got %v", gotErr)
+	}
+	if maxBytesErr.Limit != 100 {
+		t.Errorf("expected limit %v, got %v", 100, maxBytesErr.Limit)
+	}
+	if len(got) != 100 {
+		t.Errorf("expected %v read bytes, got %v", 100, len(got))
+	}
+}
+
+func TestDecompressHandler_MaxRatio(t *testing.T) {
+	data := strings.Repeat("0", 10*decompressRatioMinSize)
+	body := compress(t, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, data)
+
+	var gotErr error
+	h := DecompressHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, gotErr = io.ReadAll(r.Body)
+		}),
+		MaxRatio: 10,
+	}
+	r := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	if !errors.Is(gotErr, ErrDecompressionRatioExceeded) {
+		t.Errorf("expected %v error, got %v", ErrDecompressionRatioExceeded, gotErr)
+	}
+}
+
+func TestDecompressHandler_InvalidBody(t *testing.T) {
+	h := DecompressHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("handler called")
+		}),
+	}
+	r := httptest.NewRequest("POST", "/", strings.NewReader("not compressed"))
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func compress(t *testing.T, encode func(w io.Writer) io.WriteCloser, data string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	e := encode(&buf)
+	if _, err := io.WriteString(e, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
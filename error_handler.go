@@ -0,0 +1,185 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// HTTPError is an error that carries the HTTP response status code and the
+// message that is safe to be shown to clients. The wrapped error is private,
+// it is logged for internal errors, but never written to the response.
+type HTTPError struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+// NewHTTPError creates a new HTTPError. If the message is empty, the status
+// text is used as the public message.
+func NewHTTPError(status int, message string, err error) *HTTPError {
+	return &HTTPError{
+		Status:  status,
+		Message: message,
+		Err:     err,
+	}
+}
+
+func (e *HTTPError) Error() string {
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.Status)
+	}
+	if e.Err == nil {
+		return message
+	}
+	return message + ": " + e.Err.Error()
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// HandlerFunc is an HTTP handler function that returns an error instead of
+// writing the error response itself. It implements http.Handler interface
+// and renders returned errors with DefaultErrorRenderer. Use
+// ErrorRenderer.Handler to render errors with a different ErrorRenderer.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// ServeHTTP calls the function and renders the returned error.
+func (f HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	DefaultErrorRenderer.Handler(f).ServeHTTP(w, r)
+}
+
+// TemplateResponder renders templates as HTTP responses. It is implemented
+// by templates.Templates.
+type TemplateResponder interface {
+	RespondWithStatus(w http.ResponseWriter, name string, data any, status int)
+}
+
+// ErrorData is passed to the error template.
+type ErrorData struct {
+	Status  int
+	Title   string
+	Message string
+}
+
+// DefaultErrorRenderer is used by HandlerFunc.
+var DefaultErrorRenderer = &ErrorRenderer{}
+
+// ErrorRenderer writes error responses in the format that is negotiated with
+// the Accept request header. HTML is rendered with the template if Templates
+// field is set, JSON as RFC 9457 problem details and plain text otherwise.
+//
+// Errors of type HTTPError and Problem set the response status and the
+// public message. All other errors are written as Internal Server Error,
+// without exposing their messages. Errors with the status code 500 or higher
+// are logged.
+type ErrorRenderer struct {
+	// Templates is used to render HTML responses. HTML is not offered if it
+	// is nil.
+	Templates TemplateResponder
+	// TemplateName is the name of the template that is rendered with
+	// ErrorData. Default is "error".
+	TemplateName string
+	// Logger returns the logger for the request context. A function like
+	// logging.SlogFromContext can be used. Default is slog.Default().
+	Logger func(ctx context.Context) *slog.Logger
+}
+
+// Handler returns an http.Handler that calls the function and renders the
+// returned error.
+func (e *ErrorRenderer) Handler(f HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := f(w, r); err != nil {
+			e.RenderError(w, r, err)
+		}
+	})
+}
+
+// RenderError logs the error if it is an internal error and writes the
+// error response.
+func (e *ErrorRenderer) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	if status, _, _ := errorResponse(err); status >= http.StatusInternalServerError {
+		logger := slog.Default()
+		if e.Logger != nil {
+			logger = e.Logger(r.Context())
+		}
+		logger.ErrorContext(r.Context(), "http error", "method", r.Method, "url", r.URL.String(), "status", status, "error", err)
+	}
+	e.WriteError(w, r, err)
+}
+
+// WriteError writes the error response without logging the error. It can be
+// used with recovery.WithPanicErrorHandler, as the recovery Handler already
+// logs panics.
+func (e *ErrorRenderer) WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message, problem := errorResponse(err)
+
+	offers := []string{"text/plain", ProblemJSONContentType, "application/json"}
+	if e.Templates != nil {
+		offers = append(offers, "text/html")
+	}
+	contentType := NegotiateContentType(r.Header.Get("Accept"), offers)
+	switch {
+	case contentType == "text/html":
+		name := e.TemplateName
+		if name == "" {
+			name = "error"
+		}
+		e.Templates.RespondWithStatus(w, name, ErrorData{
+			Status:  status,
+			Title:   http.StatusText(status),
+			Message: message,
+		}, status)
+	case strings.Contains(contentType, "json"):
+		if problem == nil {
+			problem = NewProblem(status, message)
+			if message == problem.Title {
+				problem.Detail = ""
+			}
+		}
+		_ = problem.Write(w, ProblemJSONContentType)
+	default:
+		http.Error(w, message, status)
+	}
+}
+
+// errorResponse returns the status code and the public message for the
+// error, and the Problem if the error is one.
+func errorResponse(err error) (status int, message string, problem *Problem) {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.Status != 0 {
+		message := httpErr.Message
+		if message == "" {
+			message = http.StatusText(httpErr.Status)
+		}
+		return httpErr.Status, message, nil
+	}
+	if errors.As(err, &problem) {
+		status = problem.Status
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		message = problem.Detail
+		if message == "" {
+			message = problem.Title
+		}
+		if message == "" {
+			message = http.StatusText(status)
+		}
+		return status, message, problem
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge), nil
+	}
+	return http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil
+}
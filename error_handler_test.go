@@ -0,0 +1,138 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testTemplateResponder struct{}
+
+func (testTemplateResponder) RespondWithStatus(w http.ResponseWriter, name string, data any, status int) {
+	d := data.(ErrorData)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<%s>%d %s: %s", name, d.Status, d.Title, d.Message)
+}
+
+func TestErrorRenderer(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	renderer := &ErrorRenderer{
+		Templates: testTemplateResponder{},
+		Logger:    func(context.Context) *slog.Logger { return logger },
+	}
+
+	for _, tc := range []struct {
+		name        string
+		err         error
+		accept      string
+		status      int
+		contentType string
+		body        string
+		logged      bool
+	}{
+		{
+			name:        "http error text",
+			err:         NewHTTPError(http.StatusNotFound, "Page does not exist.", errors.New("no rows")),
+			status:      http.StatusNotFound,
+			contentType: "text/plain; charset=utf-8",
+			body:        "Page does not exist.\n",
+		},
+		{
+			name:        "http error json",
+			err:         fmt.Errorf("wrapped: %w", NewHTTPError(http.StatusConflict, "", nil)),
+			accept:      "application/json",
+			status:      http.StatusConflict,
+			contentType: ProblemJSONContentType,
+			body:        `{"status":409,"title":"Conflict","type":"about:blank"}` + "\n",
+		},
+		{
+			name:        "internal error html",
+			err:         errors.New("database password is wrong"),
+			accept:      "text/html,application/xhtml+xml,*/*;q=0.8",
+			status:      http.StatusInternalServerError,
+			contentType: "text/html; charset=utf-8",
+			body:        "<error>500 Internal Server Error: Internal Server Error",
+			logged:      true,
+		},
+		{
+			name:        "problem json",
+			err:         NewProblem(http.StatusForbidden, "Not enough credit."),
+			accept:      "application/*",
+			status:      http.StatusForbidden,
+			contentType: ProblemJSONContentType,
+			body:        `{"detail":"Not enough credit.","status":403,"title":"Forbidden","type":"about:blank"}` + "\n",
+		},
+		{
+			name:        "max bytes error",
+			err:         &http.MaxBytesError{Limit: 10},
+			accept:      "text/plain",
+			status:      http.StatusRequestEntityTooLarge,
+			contentType: "text/plain; charset=utf-8",
+			body:        "Request Entity Too Large\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logs.Reset()
+
+			r := httptest.NewRequest("GET", "/", nil)
+			if tc.accept != "" {
+				r.Header.Set("Accept", tc.accept)
+			}
+			w := httptest.NewRecorder()
+			renderer.Handler(func(w http.ResponseWriter, r *http.Request) error {
+				return tc.err
+			}).ServeHTTP(w, r)
+
+			if w.Code != tc.status {
+				t.Errorf("expected status code %d, got %d", tc.status, w.Code)
+			}
+			if v := w.Header().Get("Content-Type"); v != tc.contentType {
+				t.Errorf("expected content type %q, got %q", tc.contentType, v)
+			}
+			if v := w.Body.String(); v != tc.body {
+				t.Errorf("expected body %q, got %q", tc.body, v)
+			}
+			if logged := strings.Contains(logs.String(), tc.err.Error()); logged != tc.logged {
+				t.Errorf("expected logged %v, got %v: %s", tc.logged, logged, logs.String())
+			}
+		})
+	}
+}
+
+func TestHandlerFunc(t *testing.T) {
+	h := HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if r.URL.Path == "/ok" {
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+		return NewHTTPError(http.StatusBadRequest, "Invalid path.", nil)
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/ok", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if v := w.Body.String(); v != "Invalid path.\n" {
+		t.Errorf("expected body %q, got %q", "Invalid path.\n", v)
+	}
+}
@@ -8,6 +8,8 @@ package fileServer
 import (
 	"errors"
 	"net/http"
+
+	"resenje.org/web"
 )
 
 // Default file handlers in case of errors.
@@ -22,6 +24,12 @@ var (
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	})
 
+	// Handlers that respond with RFC 9457 problem details, used if
+	// Options.ProblemDetails is true.
+	ProblemNotFoundHandler            = web.NewProblem(http.StatusNotFound, "")
+	ProblemForbiddenHandler           = web.NewProblem(http.StatusForbidden, "")
+	ProblemInternalServerErrorHandler = web.NewProblem(http.StatusInternalServerError, "")
+
 	errNotFound       = errors.New("not found")
 	errNotRegularFile = errors.New("not a regular file")
 )
@@ -55,4 +63,7 @@ type Options struct {
 	ForbiddenHandler http.Handler
 	// InternalServerErrorHandler is used when an unexpected error occurs.
 	InternalServerErrorHandler http.Handler
+	// ProblemDetails sets RFC 9457 problem details responses for errors
+	// that do not have a handler set.
+	ProblemDetails bool
 }
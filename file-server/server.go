@@ -158,6 +158,10 @@ func (s Server) httpError(w http.ResponseWriter, r *http.Request, err error) {
 			s.NotFoundHandler.ServeHTTP(w, r)
 			return
 		}
+		if s.ProblemDetails {
+			ProblemNotFoundHandler.ServeHTTP(w, r)
+			return
+		}
 		DefaultNotFoundHandler.ServeHTTP(w, r)
 		return
 	}
@@ -166,6 +170,10 @@ func (s Server) httpError(w http.ResponseWriter, r *http.Request, err error) {
 			s.ForbiddenHandler.ServeHTTP(w, r)
 			return
 		}
+		if s.ProblemDetails {
+			ProblemForbiddenHandler.ServeHTTP(w, r)
+			return
+		}
 		DefaultForbiddenHandler.ServeHTTP(w, r)
 		return
 	}
@@ -173,6 +181,10 @@ func (s Server) httpError(w http.ResponseWriter, r *http.Request, err error) {
 		s.InternalServerErrorHandler.ServeHTTP(w, r)
 		return
 	}
+	if s.ProblemDetails {
+		ProblemInternalServerErrorHandler.ServeHTTP(w, r)
+		return
+	}
 	DefaultInternalServerErrorHandler.ServeHTTP(w, r)
 }
 
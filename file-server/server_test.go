@@ -121,6 +121,28 @@ func TestServerFileNotFoundCustom(t *testing.T) {
 	}
 }
 
+func TestServerFileNotFoundProblemDetails(t *testing.T) {
+	dir := t.TempDir()
+
+	r := httptest.NewRequest("", "/assets/missing-file", nil)
+	r.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+
+	New("/assets", dir, &Options{
+		ProblemDetails: true,
+	}).ServeHTTP(w, r)
+
+	code := w.Result().StatusCode
+	if code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, code)
+	}
+
+	contentType := w.Header().Get("Content-Type")
+	if contentType != "application/problem+xml" {
+		t.Errorf("expected content type %q, got %q", "application/problem+xml", contentType)
+	}
+}
+
 func TestServerDirNotFound(t *testing.T) {
 	dir := t.TempDir()
 
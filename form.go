@@ -5,27 +5,124 @@
 
 package web
 
+import (
+	"encoding/json"
+	"encoding/xml"
+)
+
 // FormErrors represent structure errors returned by API server to
-// request based on HTML form data.
+// request based on HTML form data. Errors are messages with texts and
+// optional codes and parameters that can be used to translate them.
 type FormErrors struct {
-	Errors      []string            `json:"errors,omitempty"`
-	FieldErrors map[string][]string `json:"field_errors,omitempty"`
+	Errors      []FormMessage            `json:"errors,omitempty"`
+	FieldErrors map[string][]FormMessage `json:"field_errors,omitempty"`
+}
+
+// FormMessage holds an error text together with the message code and
+// parameters that can be used to translate it.
+type FormMessage struct {
+	Code   string            `json:"code,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+	Text   string            `json:"text"`
+}
+
+// String returns the message text.
+func (m FormMessage) String() string {
+	return m.Text
+}
+
+// UnmarshalJSON decodes the message from a JSON object or from a JSON string
+// with only the text.
+func (m *FormMessage) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*m = FormMessage{}
+		return json.Unmarshal(data, &m.Text)
+	}
+	type formMessage FormMessage
+	return json.Unmarshal(data, (*formMessage)(m))
+}
+
+// MarshalXML implements xml.Marshaler interface. The code is encoded as the
+// attribute, and the text and parameters as child elements.
+func (m FormMessage) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if m.Code != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "code"}, Value: m.Code})
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := e.EncodeElement(m.Text, xml.StartElement{Name: xml.Name{Local: "text"}}); err != nil {
+		return err
+	}
+	if len(m.Params) > 0 {
+		if err := encodeProblemXMLValue(e, "params", m.Params); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
 }
 
 // AddError appends an error to a list of general errors.
 func (f *FormErrors) AddError(e string) {
-	f.Errors = append(f.Errors, e)
+	f.AddErrorMessage(FormMessage{Text: e})
+}
+
+// AddErrorMessage appends an error with the message code and parameters to
+// a list of general errors.
+func (f *FormErrors) AddErrorMessage(m FormMessage) {
+	f.Errors = append(f.Errors, m)
 }
 
 // AddFieldError appends an error to a list of field specific errors.
 func (f *FormErrors) AddFieldError(field, e string) {
+	f.AddFieldErrorMessage(field, FormMessage{Text: e})
+}
+
+// AddFieldErrorMessage appends an error with the message code and
+// parameters to a list of field specific errors.
+func (f *FormErrors) AddFieldErrorMessage(field string, m FormMessage) {
 	if f.FieldErrors == nil {
-		f.FieldErrors = map[string][]string{}
+		f.FieldErrors = map[string][]FormMessage{}
 	}
-	if _, ok := f.FieldErrors[field]; !ok {
-		f.FieldErrors[field] = []string{}
+	f.FieldErrors[field] = append(f.FieldErrors[field], m)
+}
+
+// Texts returns texts of general errors.
+func (f FormErrors) Texts() []string {
+	return formMessageTexts(f.Errors)
+}
+
+// FieldTexts returns texts of errors for a field.
+func (f FormErrors) FieldTexts(field string) []string {
+	return formMessageTexts(f.FieldErrors[field])
+}
+
+func formMessageTexts(messages []FormMessage) []string {
+	if messages == nil {
+		return nil
+	}
+	texts := make([]string, 0, len(messages))
+	for _, m := range messages {
+		texts = append(texts, m.Text)
+	}
+	return texts
+}
+
+// Localize returns a copy of FormErrors with texts of errors translated to
+// the locale by the message catalog.
+func (f FormErrors) Localize(c *MessageCatalog, locale string) FormErrors {
+	l := FormErrors{}
+	for _, m := range f.Errors {
+		m.Text = c.Format(locale, m)
+		l.AddErrorMessage(m)
+	}
+	for field, messages := range f.FieldErrors {
+		for _, m := range messages {
+			m.Text = c.Format(locale, m)
+			l.AddFieldErrorMessage(field, m)
+		}
 	}
-	f.FieldErrors[field] = append(f.FieldErrors[field], e)
+	return l
 }
 
 // HasErrors returns weather FormErrors instance contains at leas one error.
@@ -0,0 +1,789 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ValidatorFunc validates a field value with an optional parameter from the
+// validate struct tag. It returns a non-nil error with a message for the user
+// if the value is not valid. The rule name is used as the message code and
+// the parameter is available in message formats as {param}.
+type ValidatorFunc func(value any, param string) error
+
+// FormDecoder binds query parameters and url-encoded, multipart or JSON
+// request bodies into structs and validates them.
+//
+// Struct fields are bound by the name from the form struct tag, or the json
+// struct tag, or the field name, in that order. Nested struct fields are
+// addressed with a dot and slice elements with an index in brackets, for
+// example address.city or items[0].name. These paths are also used as keys
+// in FormErrors FieldErrors.
+//
+// Validation rules are defined by the validate struct tag as a comma separated
+// list of rules:
+//   - required - the value must not be empty
+//   - min=N, max=N - the minimal and maximal number of characters of a string,
+//     number of elements of a slice or the value of a number
+//   - len=N - the exact number of characters of a string or elements of a slice
+//   - email - the value must be an email address
+//   - oneof=a b c - the value must be one of space separated values
+//   - any name registered with RegisterValidator method
+//
+// A regular expression that a string value must match can be set with the
+// pattern struct tag. Rules other than required are not checked for empty
+// values.
+type FormDecoder struct {
+	// MaxMemory is passed to http.Request.ParseMultipartForm. If it is 0,
+	// 32 MB is used.
+	MaxMemory int64
+
+	validators map[string]ValidatorFunc
+	patterns   sync.Map // map[string]*regexp.Regexp
+}
+
+// DefaultFormDecoder is used by the DecodeForm function.
+var DefaultFormDecoder = NewFormDecoder()
+
+// NewFormDecoder constructs a new instance of FormDecoder.
+func NewFormDecoder() *FormDecoder {
+	return &FormDecoder{
+		validators: make(map[string]ValidatorFunc),
+	}
+}
+
+// RegisterValidator adds a custom validation rule that can be used in the
+// validate struct tag.
+func (d *FormDecoder) RegisterValidator(name string, fn ValidatorFunc) {
+	d.validators[name] = fn
+}
+
+// DecodeForm decodes and validates request data into v using the
+// DefaultFormDecoder.
+func DecodeForm(r *http.Request, v any) (errs FormErrors, err error) {
+	return DefaultFormDecoder.Decode(r, v)
+}
+
+// Decode binds request query parameters and the body into v, which must be a
+// pointer to a struct, and validates it. The body is decoded based on the
+// request Content-Type header. Invalid data is reported through returned
+// FormErrors, while the error is returned only if the data could not be
+// processed, for example if the request body is larger then allowed by
+// MaxBodyBytesHandler or if struct tags are not valid.
+func (d *FormDecoder) Decode(r *http.Request, v any) (errs FormErrors, err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errs, errors.New("web: decode form: value must be a non-nil pointer to a struct")
+	}
+
+	bindForm(rv.Elem(), r.URL.Query(), nil, &errs)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		if err := decodeJSON(r.Body, v, &errs); err != nil {
+			return errs, err
+		}
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			if isMaxBytesError(err) {
+				return errs, err
+			}
+			errs.AddErrorMessage(FormMessage{Code: "invalid_form", Text: "invalid form"})
+			return errs, nil
+		}
+		bindForm(rv.Elem(), r.PostForm, nil, &errs)
+	case "multipart/form-data":
+		maxMemory := d.MaxMemory
+		if maxMemory == 0 {
+			maxMemory = 32 << 20
+		}
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			if isMaxBytesError(err) {
+				return errs, err
+			}
+			errs.AddErrorMessage(FormMessage{Code: "invalid_form", Text: "invalid form"})
+			return errs, nil
+		}
+		bindForm(rv.Elem(), r.MultipartForm.Value, r.MultipartForm.File, &errs)
+	}
+
+	if err := d.Validate(v, &errs); err != nil {
+		return errs, err
+	}
+	return errs, nil
+}
+
+// Validate checks validation rules of struct fields of v, which must be a
+// struct or a pointer to a struct, and adds errors to errs. Fields that
+// already have errors are not validated.
+func (d *FormDecoder) Validate(v any, errs *FormErrors) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return errors.New("web: validate: value must be a struct")
+	}
+	return d.validateStruct(rv, "", errs)
+}
+
+func isMaxBytesError(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+func decodeJSON(body io.Reader, v any, errs *FormErrors) error {
+	if body == nil {
+		return nil
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	err = json.NewDecoder(bytes.NewReader(data)).Decode(v)
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		if path, ok := jsonFieldPath(data, reflect.TypeOf(v), typeErr.Offset); ok {
+			errs.AddFieldErrorMessage(path, formInvalidValueMessage)
+			return nil
+		}
+	}
+	errs.AddErrorMessage(FormMessage{Code: "invalid_json", Text: "invalid JSON"})
+	return nil
+}
+
+// jsonFieldPath returns the form field path of the JSON value that ends at
+// the offset, or contains it if it is an object or an array, with field
+// names resolved from the type v in the same way as the form values are
+// bound. Field paths reported by the json package are not used as they do
+// not include slice indexes in all Go versions.
+func jsonFieldPath(data []byte, t reflect.Type, offset int64) (path string, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	path, ok, err := walkJSON(dec, t, "", offset)
+	if err != nil {
+		return "", false
+	}
+	return path, ok
+}
+
+// walkJSON reads the next JSON value from the decoder and returns the path of
+// the first value within it that ends at or after the offset.
+func walkJSON(dec *json.Decoder, t reflect.Type, path string, offset int64) (string, bool, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", false, err
+	}
+	if dec.InputOffset() >= offset {
+		return path, true, nil
+	}
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return "", false, err
+			}
+			name, _ := key.(string)
+			ft, fieldPath := jsonField(t, name, path)
+			if p, ok, err := walkJSON(dec, ft, fieldPath, offset); ok || err != nil {
+				return p, ok, err
+			}
+		}
+	case json.Delim('['):
+		var et reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			et = t.Elem()
+		}
+		for i := 0; dec.More(); i++ {
+			if p, ok, err := walkJSON(dec, et, formIndexPath(path, i), offset); ok || err != nil {
+				return p, ok, err
+			}
+		}
+	default:
+		return "", false, nil
+	}
+	// Closing delimiter.
+	_, err = dec.Token()
+	return "", false, err
+}
+
+// jsonField returns the type and the form field path of the value with the
+// JSON object key, matching struct fields in the same way as the json
+// package, exactly and then case-insensitively.
+func jsonField(t reflect.Type, key, prefix string) (reflect.Type, string) {
+	if t == nil || t.Kind() != reflect.Struct {
+		if t != nil && t.Kind() == reflect.Map {
+			return t.Elem(), formPath(prefix, key)
+		}
+		return nil, formPath(prefix, key)
+	}
+	var fold *reflect.StructField
+	var foldPrefix string
+	var find func(t reflect.Type, prefix string) (*reflect.StructField, string)
+	find = func(t reflect.Type, prefix string) (*reflect.StructField, string) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() && !f.Anonymous {
+				continue
+			}
+			tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if tag == "-" {
+				continue
+			}
+			if f.Anonymous && tag == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					if name, explicit := formFieldName(f); explicit {
+						if found, p := find(ft, formPath(prefix, name)); found != nil {
+							return found, p
+						}
+					} else if found, p := find(ft, prefix); found != nil {
+						return found, p
+					}
+					continue
+				}
+			}
+			if !f.IsExported() {
+				continue
+			}
+			name := tag
+			if name == "" {
+				name = f.Name
+			}
+			if name == key {
+				return &f, prefix
+			}
+			if fold == nil && strings.EqualFold(name, key) {
+				fold, foldPrefix = &f, prefix
+			}
+		}
+		return nil, ""
+	}
+	f, fieldPrefix := find(t, prefix)
+	if f == nil {
+		if fold == nil {
+			return nil, formPath(prefix, key)
+		}
+		f, fieldPrefix = fold, foldPrefix
+	}
+	name, _ := formFieldName(*f)
+	return f.Type, formPath(fieldPrefix, name)
+}
+
+// maxFormSliceIndex limits the size of slices allocated from indexed form
+// keys.
+const maxFormSliceIndex = 1000
+
+var (
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType     = reflect.TypeOf([]*multipart.FileHeader(nil))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+
+	errFormInvalidValue     = errors.New("invalid value")
+	formInvalidValueMessage = FormMessage{Code: "invalid_value", Text: "invalid value"}
+
+	formTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04", "2006-01-02"}
+)
+
+type formBinder struct {
+	values url.Values
+	files  map[string][]*multipart.FileHeader
+	errs   *FormErrors
+}
+
+func bindForm(v reflect.Value, values url.Values, files map[string][]*multipart.FileHeader, errs *FormErrors) {
+	if len(values) == 0 && len(files) == 0 {
+		return
+	}
+	formBinder{values: values, files: files, errs: errs}.bindStruct(v, "")
+}
+
+func (b formBinder) bindStruct(v reflect.Value, prefix string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, explicit := formFieldName(f)
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && !explicit && f.Type.Kind() == reflect.Struct {
+			b.bindStruct(v.Field(i), prefix)
+			continue
+		}
+		b.bindField(v.Field(i), formPath(prefix, name))
+	}
+}
+
+func (b formBinder) bindField(v reflect.Value, path string) {
+	switch v.Type() {
+	case fileHeaderType:
+		if fs := b.files[path]; len(fs) > 0 {
+			v.Set(reflect.ValueOf(fs[0]))
+		}
+		return
+	case fileHeadersType:
+		if fs := b.files[path]; len(fs) > 0 {
+			v.Set(reflect.ValueOf(fs))
+		}
+		return
+	}
+
+	if isFormScalar(v.Type()) {
+		values, ok := b.values[path]
+		if !ok || len(values) == 0 {
+			return
+		}
+		if err := setFormValue(v, values[0]); err != nil {
+			b.errs.AddFieldErrorMessage(path, formInvalidValueMessage)
+		}
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !b.hasPrefix(path) {
+			return
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		b.bindField(v.Elem(), path)
+	case reflect.Struct:
+		b.bindStruct(v, path)
+	case reflect.Slice:
+		b.bindSlice(v, path)
+	}
+}
+
+func (b formBinder) bindSlice(v reflect.Value, path string) {
+	elemType := v.Type().Elem()
+	if isFormScalar(elemType) {
+		if values, ok := b.values[path]; ok {
+			s := reflect.MakeSlice(v.Type(), len(values), len(values))
+			for i, value := range values {
+				if err := setFormValue(s.Index(i), value); err != nil {
+					b.errs.AddFieldErrorMessage(formIndexPath(path, i), formInvalidValueMessage)
+				}
+			}
+			v.Set(s)
+			return
+		}
+	}
+
+	maxIndex := -1
+	prefix := path + "["
+	for key := range b.values {
+		if i, ok := formKeyIndex(key, prefix); ok && i > maxIndex {
+			maxIndex = i
+		}
+	}
+	for key := range b.files {
+		if i, ok := formKeyIndex(key, prefix); ok && i > maxIndex {
+			maxIndex = i
+		}
+	}
+	if maxIndex < 0 {
+		return
+	}
+	if maxIndex >= maxFormSliceIndex {
+		b.errs.AddFieldErrorMessage(path, FormMessage{
+			Code:   "index_too_large",
+			Params: map[string]string{"limit": strconv.Itoa(maxFormSliceIndex)},
+			Text:   "index too large",
+		})
+		return
+	}
+	s := reflect.MakeSlice(v.Type(), maxIndex+1, maxIndex+1)
+	for i := 0; i <= maxIndex; i++ {
+		b.bindField(s.Index(i), formIndexPath(path, i))
+	}
+	v.Set(s)
+}
+
+// hasPrefix returns true if there are any values or files for the path or
+// its nested fields.
+func (b formBinder) hasPrefix(path string) bool {
+	match := func(key string) bool {
+		return key == path ||
+			strings.HasPrefix(key, path+".") ||
+			strings.HasPrefix(key, path+"[")
+	}
+	for key := range b.values {
+		if match(key) {
+			return true
+		}
+	}
+	for key := range b.files {
+		if match(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func formKeyIndex(key, prefix string) (int, bool) {
+	rest, ok := strings.CutPrefix(key, prefix)
+	if !ok {
+		return 0, false
+	}
+	n, _, ok := strings.Cut(rest, "]")
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 0 {
+		return 0, false
+	}
+	return i, true
+}
+
+func formFieldName(f reflect.StructField) (name string, explicit bool) {
+	for _, tag := range []string{"form", "json"} {
+		if v, ok := f.Tag.Lookup(tag); ok {
+			name, _, _ = strings.Cut(v, ",")
+			if name != "" {
+				return name, true
+			}
+		}
+	}
+	return f.Name, false
+}
+
+func formPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func formIndexPath(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+func isFormScalar(t reflect.Type) bool {
+	if t == timeType || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Pointer:
+		return isFormScalar(t.Elem())
+	}
+	return false
+}
+
+func setFormValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setFormValue(v.Elem(), s)
+	}
+	if v.Type() == timeType {
+		if s == "" {
+			return nil
+		}
+		for _, layout := range formTimeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				v.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return errFormInvalidValue
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			return errFormInvalidValue
+		}
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+		return nil
+	}
+	if s == "" {
+		// Empty values of non-string types are left as zero values and
+		// are reported by the required rule if needed.
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if s == "on" {
+			// HTML checkbox default value.
+			v.SetBool(true)
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errFormInvalidValue
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return errFormInvalidValue
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return errFormInvalidValue
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return errFormInvalidValue
+		}
+		v.SetFloat(n)
+	}
+	return nil
+}
+
+func (d *FormDecoder) validateStruct(v reflect.Value, prefix string, errs *FormErrors) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, explicit := formFieldName(f)
+		if name == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		path := formPath(prefix, name)
+		if f.Anonymous && !explicit && f.Type.Kind() == reflect.Struct {
+			path = prefix
+		}
+
+		if _, ok := errs.FieldErrors[path]; !ok {
+			if err := d.validateField(fv, path, f.Tag.Get("validate"), f.Tag.Get("pattern"), errs); err != nil {
+				return err
+			}
+		}
+		if err := d.validateNested(fv, path, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *FormDecoder) validateNested(v reflect.Value, path string, errs *FormErrors) error {
+	if isFormScalar(v.Type()) {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return d.validateNested(v.Elem(), path, errs)
+	case reflect.Struct:
+		return d.validateStruct(v, path, errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := d.validateNested(v.Index(i), formIndexPath(path, i), errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *FormDecoder) validateField(v reflect.Value, path, rules, pattern string, errs *FormErrors) error {
+	if rules == "" && pattern == "" {
+		return nil
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v = reflect.Zero(v.Type().Elem())
+			break
+		}
+		v = v.Elem()
+	}
+	empty := v.IsZero() || (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0
+
+	for _, rule := range strings.Split(rules, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "" {
+			continue
+		}
+		if name == "required" {
+			if empty {
+				errs.AddFieldErrorMessage(path, FormMessage{Code: "required", Text: "required"})
+				return nil
+			}
+			continue
+		}
+		if empty {
+			continue
+		}
+		m, err := d.checkRule(v, name, param)
+		if err != nil {
+			return fmt.Errorf("web: validate %s: %w", path, err)
+		}
+		if m.Text != "" {
+			errs.AddFieldErrorMessage(path, m)
+			return nil
+		}
+	}
+
+	if pattern != "" && !empty && v.Kind() == reflect.String {
+		re, err := d.pattern(pattern)
+		if err != nil {
+			return fmt.Errorf("web: validate %s: %w", path, err)
+		}
+		if !re.MatchString(v.String()) {
+			errs.AddFieldErrorMessage(path, FormMessage{Code: "pattern", Text: "invalid format"})
+		}
+	}
+	return nil
+}
+
+// checkRule returns a message with non-empty Text if the value is not valid.
+func (d *FormDecoder) checkRule(v reflect.Value, name, param string) (m FormMessage, err error) {
+	switch name {
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return m, fmt.Errorf("invalid %s rule parameter %q", name, param)
+		}
+		size, unit, ok := formValueSize(v)
+		if !ok {
+			return m, fmt.Errorf("%s rule is not supported for %s", name, v.Type())
+		}
+		switch {
+		case name == "min" && size < limit:
+			return formSizeMessage(name, "at least", param, unit), nil
+		case name == "max" && size > limit:
+			return formSizeMessage(name, "at most", param, unit), nil
+		case name == "len" && size != limit:
+			return formSizeMessage(name, "exactly", param, unit), nil
+		}
+		return m, nil
+	case "email":
+		if v.Kind() != reflect.String {
+			return m, fmt.Errorf("email rule is not supported for %s", v.Type())
+		}
+		if a, err := mail.ParseAddress(v.String()); err != nil || a.Address != v.String() {
+			return FormMessage{Code: "email", Text: "invalid email address"}, nil
+		}
+		return m, nil
+	case "oneof":
+		options := strings.Fields(param)
+		s := fmt.Sprint(v.Interface())
+		for _, o := range options {
+			if o == s {
+				return m, nil
+			}
+		}
+		list := strings.Join(options, ", ")
+		return FormMessage{
+			Code:   "oneof",
+			Params: map[string]string{"options": list},
+			Text:   "must be one of: " + list,
+		}, nil
+	}
+	fn, ok := d.validators[name]
+	if !ok {
+		return m, fmt.Errorf("unknown validation rule %q", name)
+	}
+	if err := fn(v.Interface(), param); err != nil {
+		return FormMessage{
+			Code:   name,
+			Params: map[string]string{"param": param},
+			Text:   err.Error(),
+		}, nil
+	}
+	return m, nil
+}
+
+func (d *FormDecoder) pattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := d.patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	d.patterns.Store(pattern, re)
+	return re, nil
+}
+
+// formValueSize returns the number of characters of a string, the number of
+// elements of a slice or the value of a number.
+func formValueSize(v reflect.Value) (size float64, unit string, ok bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), "characters", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), "items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "", true
+	}
+	return 0, "", false
+}
+
+// formSizeMessage returns a message for min, max and len rules. Message code
+// is the rule name with the unit suffix, for example "min_characters".
+func formSizeMessage(rule, comparison, param, unit string) FormMessage {
+	m := FormMessage{
+		Code:   rule,
+		Params: map[string]string{"limit": param},
+	}
+	switch unit {
+	case "characters":
+		m.Text = fmt.Sprintf("must be %s %s characters long", comparison, param)
+	case "items":
+		m.Text = fmt.Sprintf("must have %s %s items", comparison, param)
+	default:
+		m.Text = fmt.Sprintf("must be %s %s", comparison, param)
+	}
+	if unit != "" {
+		m.Code += "_" + unit
+	}
+	return m
+}
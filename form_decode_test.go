@@ -0,0 +1,345 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testFormAddress struct {
+	City    string `form:"city" validate:"required"`
+	Country string `form:"country" validate:"len=2"`
+}
+
+type testFormItem struct {
+	Name     string `json:"name" validate:"required,max=5"`
+	Quantity int    `json:"quantity" validate:"min=1,max=10"`
+}
+
+type testForm struct {
+	Name     string           `form:"name" validate:"required,min=2,max=10"`
+	Email    string           `form:"email" validate:"required,email"`
+	Age      *int             `form:"age" validate:"min=18"`
+	Role     string           `form:"role" validate:"oneof=admin user"`
+	Code     string           `form:"code" pattern:"^[A-Z]{3}$"`
+	Tags     []string         `form:"tags" validate:"max=3"`
+	Agree    bool             `form:"agree"`
+	Born     time.Time        `form:"born"`
+	Address  testFormAddress  `form:"address"`
+	Billing  *testFormAddress `form:"billing"`
+	Items    []testFormItem   `form:"items"`
+	Internal string           `form:"-"`
+}
+
+func TestDecodeForm_URLEncoded(t *testing.T) {
+	values := url.Values{
+		"name":              {"Janoš"},
+		"email":             {"janos@resenje.org"},
+		"age":               {"40"},
+		"role":              {"admin"},
+		"code":              {"ABC"},
+		"tags":              {"a", "b"},
+		"agree":             {"on"},
+		"born":              {"2000-01-02"},
+		"address.city":      {"Novi Sad"},
+		"address.country":   {"RS"},
+		"items[1].name":     {"pear"},
+		"items[0].name":     {"apple"},
+		"items[0].quantity": {"2"},
+		"items[1].quantity": {"3"},
+		"Internal":          {"secret"},
+	}
+	r := httptest.NewRequest("POST", "/", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var f testForm
+	errs, err := DecodeForm(r, &f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs.HasErrors() {
+		t.Fatalf("unexpected errors %+v", errs)
+	}
+
+	age := 40
+	want := testForm{
+		Name:    "Janoš",
+		Email:   "janos@resenje.org",
+		Age:     &age,
+		Role:    "admin",
+		Code:    "ABC",
+		Tags:    []string{"a", "b"},
+		Agree:   true,
+		Born:    time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC),
+		Address: testFormAddress{City: "Novi Sad", Country: "RS"},
+		Items: []testFormItem{
+			{Name: "apple", Quantity: 2},
+			{Name: "pear", Quantity: 3},
+		},
+	}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("expected %+v, got %+v", want, f)
+	}
+}
+
+func TestDecodeForm_Validation(t *testing.T) {
+	values := url.Values{
+		"name":              {"J"},
+		"email":             {"janos"},
+		"age":               {"17"},
+		"role":              {"guest"},
+		"code":              {"abc"},
+		"tags":              {"a", "b", "c", "d"},
+		"born":              {"yesterday"},
+		"address.country":   {"SRB"},
+		"billing.country":   {"RS"},
+		"items[0].name":     {"watermelon"},
+		"items[0].quantity": {"11"},
+		"items[1].quantity": {"x"},
+	}
+	r := httptest.NewRequest("POST", "/?name=ignored", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var f testForm
+	errs, err := DecodeForm(r, &f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"name":              {"must be at least 2 characters long"},
+		"email":             {"invalid email address"},
+		"age":               {"must be at least 18"},
+		"role":              {"must be one of: admin, user"},
+		"code":              {"invalid format"},
+		"tags":              {"must have at most 3 items"},
+		"born":              {"invalid value"},
+		"address.city":      {"required"},
+		"address.country":   {"must be exactly 2 characters long"},
+		"billing.city":      {"required"},
+		"items[0].name":     {"must be at most 5 characters long"},
+		"items[0].quantity": {"must be at most 10"},
+		"items[1].name":     {"required"},
+		"items[1].quantity": {"invalid value"},
+	}
+	if got := fieldTexts(errs); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestDecodeForm_JSON(t *testing.T) {
+	type form struct {
+		Page  int            `form:"page" validate:"min=1"`
+		Items []testFormItem `json:"items" validate:"required"`
+	}
+
+	r := httptest.NewRequest("POST", "/?page=2", strings.NewReader(`{"items":[{"name":"apple","quantity":20}]}`))
+	r.Header.Set("Content-Type", "application/json")
+
+	var f form
+	errs, err := DecodeForm(r, &f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Page != 2 {
+		t.Errorf("expected page %v, got %v", 2, f.Page)
+	}
+	want := map[string][]string{
+		"items[0].quantity": {"must be at most 10"},
+	}
+	if got := fieldTexts(errs); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader(`{"items":[{"name":"apple","quantity":"many"}]}`))
+	r.Header.Set("Content-Type", "application/json")
+	errs, err = DecodeForm(r, &form{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[string][]string{
+		"items[0].quantity": {"invalid value"},
+	}
+	if got := fieldTexts(errs); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader(`{"Items": [{"name": "apple", "quantity": 1}, {"NAME": ["pear"]}]}`))
+	r.Header.Set("Content-Type", "application/json")
+	errs, err = DecodeForm(r, &form{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[string][]string{
+		"items[1].name": {"invalid value"},
+	}
+	if got := fieldTexts(errs); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader(`{"items":`))
+	r.Header.Set("Content-Type", "application/json")
+	errs, err = DecodeForm(r, &form{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(errs.Texts(), []string{"invalid JSON"}) {
+		t.Errorf("expected invalid JSON error, got %v", errs)
+	}
+}
+
+func TestJSONFieldPath(t *testing.T) {
+	type base struct {
+		ID int `json:"id"`
+	}
+	type form struct {
+		base
+		Title  string         `form:"title" json:"name"`
+		Tags   []string       `json:"tags"`
+		Attrs  map[string]int `json:"attrs"`
+		Groups [][]int        `json:"groups"`
+	}
+	for _, tc := range []struct {
+		body string
+		want string
+	}{
+		{body: `{"id": "x"}`, want: "id"},
+		{body: `{"name": 1}`, want: "title"},
+		{body: `{"tags": ["a", "b", 3]}`, want: "tags[2]"},
+		{body: `{"attrs": {"size": "large"}}`, want: "attrs.size"},
+		{body: `{"groups": [[1], [2, {}]]}`, want: "groups[1][1]"},
+		{body: `{"tags": {"a": "b"}}`, want: "tags"},
+	} {
+		var v form
+		err := json.Unmarshal([]byte(tc.body), &v)
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			t.Fatalf("%s: expected type error, got %v", tc.body, err)
+		}
+		got, ok := jsonFieldPath([]byte(tc.body), reflect.TypeOf(&v), typeErr.Offset)
+		if !ok || got != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.body, tc.want, got)
+		}
+	}
+}
+
+func TestDecodeForm_Multipart(t *testing.T) {
+	type form struct {
+		Title  string                  `form:"title" validate:"required"`
+		Avatar *multipart.FileHeader   `form:"avatar"`
+		Files  []*multipart.FileHeader `form:"files"`
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("title", "resenje"); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"avatar", "files", "files"} {
+		fw, err := mw.CreateFormFile(field, field+".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(fw, field); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var f form
+	errs, err := DecodeForm(r, &f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs.HasErrors() {
+		t.Fatalf("unexpected errors %+v", errs)
+	}
+	if f.Title != "resenje" {
+		t.Errorf("expected title %q, got %q", "resenje", f.Title)
+	}
+	if f.Avatar == nil || f.Avatar.Filename != "avatar.txt" {
+		t.Errorf("unexpected avatar %+v", f.Avatar)
+	}
+	if len(f.Files) != 2 {
+		t.Errorf("expected %v files, got %v", 2, len(f.Files))
+	}
+}
+
+func TestDecodeForm_CustomValidator(t *testing.T) {
+	d := NewFormDecoder()
+	d.RegisterValidator("prefix", func(value any, param string) error {
+		if !strings.HasPrefix(value.(string), param) {
+			return errors.New("must start with " + param)
+		}
+		return nil
+	})
+
+	type form struct {
+		ID string `form:"id" validate:"required,prefix=usr_"`
+	}
+
+	r := httptest.NewRequest("GET", "/?id=123", nil)
+	var f form
+	errs, err := d.Decode(r, &f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"id": {"must start with usr_"}}
+	if got := fieldTexts(errs); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	type invalid struct {
+		ID string `form:"id" validate:"unknown"`
+	}
+	if _, err := d.Decode(r, &invalid{}); err == nil {
+		t.Error("expected error for unknown rule")
+	}
+}
+
+func TestDecodeForm_MaxBodyBytes(t *testing.T) {
+	var gotErr error
+	h := MaxBodyBytesHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var f testForm
+			_, gotErr = DecodeForm(r, &f)
+		}),
+		Limit: 10,
+	}
+	r := httptest.NewRequest("POST", "/", strings.NewReader("name=resenje.org"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.ContentLength = -1
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(gotErr, &maxBytesErr) {
+		t.Errorf("expected http.MaxBytesError, got %v", gotErr)
+	}
+}
+
+// fieldTexts returns texts of field errors by fields.
+func fieldTexts(errs FormErrors) map[string][]string {
+	texts := make(map[string][]string, len(errs.FieldErrors))
+	for field := range errs.FieldErrors {
+		texts[field] = errs.FieldTexts(field)
+	}
+	return texts
+}
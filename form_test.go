@@ -5,7 +5,11 @@
 
 package web
 
-import "testing"
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
 
 func TestFormError(t *testing.T) {
 	e := FormErrors{}
@@ -19,12 +23,12 @@ func TestFormError(t *testing.T) {
 	if !e.HasErrors() {
 		t.Error("expected true from HasErrors")
 	}
-	if e.Errors[0] != text {
-		t.Errorf("expected %q, got %q", text, e.Errors[0])
+	if e.Errors[0].Text != text {
+		t.Errorf("expected %q, got %q", text, e.Errors[0].Text)
 	}
 	e.AddError(text2)
-	if e.Errors[1] != text2 {
-		t.Errorf("expected %q, got %q", text2, e.Errors[1])
+	if e.Errors[1].Text != text2 {
+		t.Errorf("expected %q, got %q", text2, e.Errors[1].Text)
 	}
 }
 
@@ -37,11 +41,84 @@ func TestFormError_Field(t *testing.T) {
 	if !e.HasErrors() {
 		t.Error("expected true from HasErrors")
 	}
-	if e.FieldErrors[field][0] != text {
-		t.Errorf("expected %q, got %q", text, e.FieldErrors[field][0])
+	if e.FieldErrors[field][0].Text != text {
+		t.Errorf("expected %q, got %q", text, e.FieldErrors[field][0].Text)
 	}
 	e.AddFieldError(field2, text2)
-	if e.FieldErrors[field2][0] != text2 {
-		t.Errorf("expected %q, got %q", text2, e.FieldErrors[field2][0])
+	if e.FieldErrors[field2][0].Text != text2 {
+		t.Errorf("expected %q, got %q", text2, e.FieldErrors[field2][0].Text)
+	}
+}
+
+func TestFormError_Messages(t *testing.T) {
+	e := FormErrors{}
+	e.AddFieldErrorMessage("name", FormMessage{Code: "required", Text: "required"})
+	e.AddFieldError("name", "plain")
+	e.AddErrorMessage(FormMessage{Code: "invalid_form", Text: "invalid form"})
+	e.AddErrorMessage(FormMessage{Code: "too_long", Params: map[string]string{"max": "10"}, Text: "too long"})
+
+	if want := []string{"required", "plain"}; !reflect.DeepEqual(e.FieldTexts("name"), want) {
+		t.Errorf("expected field texts %q, got %q", want, e.FieldTexts("name"))
+	}
+
+	// Direct changes to the slices keep codes together with texts.
+	e.Errors = append([]FormMessage{{Text: "first"}}, e.Errors...)
+	e.Errors = append(e.Errors[:1], e.Errors[2:]...)
+	e.FieldErrors["name"][0], e.FieldErrors["name"][1] = e.FieldErrors["name"][1], e.FieldErrors["name"][0]
+	delete(e.FieldErrors, "missing")
+
+	want := FormErrors{
+		Errors: []FormMessage{
+			{Text: "first"},
+			{Code: "too_long", Params: map[string]string{"max": "10"}, Text: "too long"},
+		},
+		FieldErrors: map[string][]FormMessage{
+			"name": {
+				{Text: "plain"},
+				{Code: "required", Text: "required"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(e, want) {
+		t.Errorf("expected %+v, got %+v", want, e)
+	}
+	if want := []string{"first", "too long"}; !reflect.DeepEqual(e.Texts(), want) {
+		t.Errorf("expected texts %q, got %q", want, e.Texts())
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON := `{"errors":[{"text":"first"},{"code":"too_long","params":{"max":"10"},"text":"too long"}],"field_errors":{"name":[{"text":"plain"},{"code":"required","text":"required"}]}}`
+	if string(b) != wantJSON {
+		t.Errorf("expected json %s, got %s", wantJSON, b)
+	}
+
+	var decoded FormErrors
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Errorf("expected decoded %+v, got %+v", want, decoded)
+	}
+}
+
+func TestFormMessage_UnmarshalJSON(t *testing.T) {
+	var e FormErrors
+	if err := json.Unmarshal([]byte(`{"errors":["invalid form"],"field_errors":{"name":["required",{"code":"pattern","text":"invalid format"}]}}`), &e); err != nil {
+		t.Fatal(err)
+	}
+	want := FormErrors{
+		Errors: []FormMessage{{Text: "invalid form"}},
+		FieldErrors: map[string][]FormMessage{
+			"name": {{Text: "required"}, {Code: "pattern", Text: "invalid format"}},
+		},
+	}
+	if !reflect.DeepEqual(e, want) {
+		t.Errorf("expected %+v, got %+v", want, e)
+	}
+	if err := json.Unmarshal([]byte(`{"errors":[1]}`), &e); err == nil {
+		t.Error("expected error for invalid message")
 	}
 }
@@ -0,0 +1,160 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LocaleHandler chooses the locale of the request from the list of supported
+// locales and stores it in the request context. The locale is taken from the
+// URL path prefix, query parameter, cookie or Accept-Language header, in
+// that order, and the first supported locale is used if none of them
+// matches.
+//
+// Content-Language header is set to the chosen locale, and Vary header
+// lists request headers that the choice depends on.
+type LocaleHandler struct {
+	Handler http.Handler
+
+	// Locales are supported locales. The first one is the default.
+	Locales []string
+	// PathPrefix enables the locale as the first URL path segment, as in
+	// "/en/about". The prefix is removed from the URL path before Handler is
+	// called.
+	PathPrefix bool
+	// Redirect redirects GET and HEAD requests without the locale path
+	// prefix to the URL with the prefix of the chosen locale, and the ones
+	// with the prefix that is not in its canonical form, like "/EN/about",
+	// to the canonical URL. It is used only with PathPrefix.
+	Redirect bool
+	// QueryParameter is the name of the URL query parameter with the locale.
+	QueryParameter string
+	// CookieName is the name of the cookie with the locale. If the locale is
+	// chosen with the query parameter, it is stored in this cookie.
+	CookieName string
+}
+
+// ServeHTTP serves an HTTP response for a request.
+func (h LocaleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var defaultLocale string
+	if len(h.Locales) > 0 {
+		defaultLocale = h.Locales[0]
+	}
+
+	if h.PathPrefix {
+		prefix, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if locale, ok := h.supported(prefix); ok {
+			if h.Redirect && prefix != locale && isSafeMethod(r.Method) {
+				h.redirect(w, r, locale, "/"+rest, http.StatusMovedPermanently)
+				return
+			}
+			rr := new(http.Request)
+			*rr = *r
+			rr.URL = new(url.URL)
+			*rr.URL = *r.URL
+			rr.URL.Path = "/" + rest
+			rr.URL.RawPath = ""
+			h.serve(w, rr, locale)
+			return
+		}
+	}
+
+	locale, ok := "", false
+	if h.QueryParameter != "" {
+		if locale, ok = h.supported(r.URL.Query().Get(h.QueryParameter)); ok && h.CookieName != "" {
+			http.SetCookie(w, &http.Cookie{
+				Name:     h.CookieName,
+				Value:    locale,
+				Path:     "/",
+				Expires:  time.Now().AddDate(1, 0, 0),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+	}
+	if !ok && h.CookieName != "" {
+		w.Header().Add("Vary", "Cookie")
+		if c, err := r.Cookie(h.CookieName); err == nil {
+			locale, ok = h.supported(c.Value)
+		}
+	}
+	if !ok {
+		w.Header().Add("Vary", "Accept-Language")
+		for _, tag := range ParseAcceptLanguage(r.Header.Get("Accept-Language")) {
+			if tag == "*" {
+				break
+			}
+			if locale, ok = matchLocale(tag, h.Locales); ok {
+				break
+			}
+		}
+	}
+	if !ok {
+		locale = defaultLocale
+	}
+
+	if h.PathPrefix && h.Redirect && locale != "" && isSafeMethod(r.Method) {
+		h.redirect(w, r, locale, r.URL.Path, http.StatusFound)
+		return
+	}
+	h.serve(w, r, locale)
+}
+
+func (h LocaleHandler) serve(w http.ResponseWriter, r *http.Request, locale string) {
+	if locale != "" {
+		w.Header().Set("Content-Language", locale)
+		r = r.WithContext(NewLocaleContext(r.Context(), locale))
+	}
+	if h.Handler != nil {
+		h.Handler.ServeHTTP(w, r)
+	}
+}
+
+func (h LocaleHandler) redirect(w http.ResponseWriter, r *http.Request, locale, path string, code int) {
+	u := "/" + locale + path
+	if r.URL.RawQuery != "" {
+		u += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, u, code)
+}
+
+// supported returns the supported locale that is equal to the provided one,
+// ignoring the case and the separator.
+func (h LocaleHandler) supported(locale string) (string, bool) {
+	if locale == "" {
+		return "", false
+	}
+	locale = normalizeLocale(locale)
+	for _, l := range h.Locales {
+		if normalizeLocale(l) == locale {
+			return l, true
+		}
+	}
+	return "", false
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+type localeContextKey struct{}
+
+// NewLocaleContext returns a context that contains the locale.
+func NewLocaleContext(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeContextKey{}, locale)
+}
+
+// LocaleFromContext returns the locale stored in the context by
+// LocaleHandler or NewLocaleContext.
+func LocaleFromContext(ctx context.Context) string {
+	locale, _ := ctx.Value(localeContextKey{}).(string)
+	return locale
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocaleHandler(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(LocaleFromContext(r.Context()) + " " + r.URL.Path))
+	})
+
+	for _, tc := range []struct {
+		name            string
+		handler         LocaleHandler
+		url             string
+		cookie          string
+		acceptLanguage  string
+		status          int
+		body            string
+		location        string
+		contentLanguage string
+		vary            []string
+		setCookie       string
+	}{
+		{
+			name:            "default",
+			handler:         LocaleHandler{Locales: []string{"en", "sr-Latn"}},
+			url:             "/about",
+			status:          http.StatusOK,
+			body:            "en /about",
+			contentLanguage: "en",
+			vary:            []string{"Accept-Language"},
+		},
+		{
+			name:            "accept language",
+			handler:         LocaleHandler{Locales: []string{"en", "sr-Latn"}},
+			url:             "/about",
+			acceptLanguage:  "de, sr;q=0.8, en;q=0.5",
+			status:          http.StatusOK,
+			body:            "sr-Latn /about",
+			contentLanguage: "sr-Latn",
+			vary:            []string{"Accept-Language"},
+		},
+		{
+			name:            "cookie",
+			handler:         LocaleHandler{Locales: []string{"en", "sr-Latn"}, CookieName: "locale"},
+			url:             "/about",
+			cookie:          "sr-latn",
+			acceptLanguage:  "en",
+			status:          http.StatusOK,
+			body:            "sr-Latn /about",
+			contentLanguage: "sr-Latn",
+			vary:            []string{"Cookie"},
+		},
+		{
+			name:            "query parameter",
+			handler:         LocaleHandler{Locales: []string{"en", "sr-Latn"}, CookieName: "locale", QueryParameter: "lang"},
+			url:             "/about?lang=sr_latn",
+			cookie:          "en",
+			status:          http.StatusOK,
+			body:            "sr-Latn /about",
+			contentLanguage: "sr-Latn",
+			setCookie:       "sr-Latn",
+		},
+		{
+			name:            "path prefix",
+			handler:         LocaleHandler{Locales: []string{"en", "sr-Latn"}, PathPrefix: true, Redirect: true},
+			url:             "/sr-Latn/about",
+			acceptLanguage:  "en",
+			status:          http.StatusOK,
+			body:            "sr-Latn /about",
+			contentLanguage: "sr-Latn",
+		},
+		{
+			name:           "path prefix redirect",
+			handler:        LocaleHandler{Locales: []string{"en", "sr-Latn"}, PathPrefix: true, Redirect: true},
+			url:            "/about?page=2",
+			acceptLanguage: "sr",
+			status:         http.StatusFound,
+			location:       "/sr-Latn/about?page=2",
+			vary:           []string{"Accept-Language"},
+		},
+		{
+			name:     "canonical redirect",
+			handler:  LocaleHandler{Locales: []string{"en", "sr-Latn"}, PathPrefix: true, Redirect: true},
+			url:      "/SR-latn/about",
+			status:   http.StatusMovedPermanently,
+			location: "/sr-Latn/about",
+		},
+		{
+			name:            "path prefix without redirect",
+			handler:         LocaleHandler{Locales: []string{"en", "sr-Latn"}, PathPrefix: true},
+			url:             "/about",
+			status:          http.StatusOK,
+			body:            "en /about",
+			contentLanguage: "en",
+			vary:            []string{"Accept-Language"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tc.url, nil)
+			if tc.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "locale", Value: tc.cookie})
+			}
+			if tc.acceptLanguage != "" {
+				r.Header.Set("Accept-Language", tc.acceptLanguage)
+			}
+			w := httptest.NewRecorder()
+
+			h := tc.handler
+			h.Handler = handler
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.status {
+				t.Errorf("expected status code %d, got %d", tc.status, w.Code)
+			}
+			if tc.body != "" {
+				if v := w.Body.String(); v != tc.body {
+					t.Errorf("expected body %q, got %q", tc.body, v)
+				}
+			}
+			if v := w.Header().Get("Location"); v != tc.location {
+				t.Errorf("expected location %q, got %q", tc.location, v)
+			}
+			if v := w.Header().Get("Content-Language"); v != tc.contentLanguage {
+				t.Errorf("expected content language %q, got %q", tc.contentLanguage, v)
+			}
+			if v := w.Header().Values("Vary"); len(v) != len(tc.vary) || (len(v) > 0 && v[0] != tc.vary[0]) {
+				t.Errorf("expected vary %v, got %v", tc.vary, v)
+			}
+			var setCookie string
+			for _, c := range w.Result().Cookies() {
+				if c.Name == "locale" {
+					setCookie = c.Value
+				}
+			}
+			if setCookie != tc.setCookie {
+				t.Errorf("expected cookie %q, got %q", tc.setCookie, setCookie)
+			}
+		})
+	}
+}
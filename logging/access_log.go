@@ -13,20 +13,27 @@ import (
 	"time"
 
 	"github.com/felixge/httpsnoop"
+
+	"resenje.org/web"
 )
 
 type AccessLogOptions struct {
 	RealIPHeaderName string
 	PreHook          http.HandlerFunc
 	PostHook         func(code int, duration time.Duration, written int64)
-	LogMessage       string
+	// PostRequestHook is called after the request is served, like PostHook,
+	// with the request which can be used to get the route pattern with
+	// web.RoutePattern function for metrics labels.
+	PostRequestHook func(r *http.Request, code int, duration time.Duration, written int64)
+	LogMessage      string
 }
 
 // NewHandler returns a handler that logs HTTP requests.
 // It logs information about remote address, X-Forwarded-For or X-Real-Ip,
 // HTTP method, request URI, HTTP protocol, HTTP response status, total bytes
 // written to http.ResponseWriter, response duration, HTTP referrer and
-// HTTP client user agent.
+// HTTP client user agent. If the request is served by web.Router, the matched
+// route pattern is logged as well.
 func NewAccessLogHandler(h http.Handler, logger *slog.Logger, o *AccessLogOptions) http.Handler {
 	if o == nil {
 		o = new(AccessLogOptions)
@@ -47,6 +54,8 @@ func NewAccessLogHandler(h http.Handler, logger *slog.Logger, o *AccessLogOption
 			o.PreHook(w, r)
 		}
 
+		r = r.WithContext(web.NewRouteContext(r.Context()))
+
 		m := httpsnoop.CaptureMetrics(h, w, r)
 
 		ip, _, err := net.SplitHostPort(r.RemoteAddr)
@@ -67,11 +76,16 @@ func NewAccessLogHandler(h http.Handler, logger *slog.Logger, o *AccessLogOption
 			slog.String("ips", strings.Join(ips, ", ")),
 			slog.String("method", r.Method),
 			slog.String("uri", r.RequestURI),
+		}
+		if route := web.RoutePattern(r); route != "" {
+			attrs = append(attrs, slog.String("route", route))
+		}
+		attrs = append(attrs,
 			slog.String("proto", r.Proto),
 			slog.Int("status", status),
 			slog.Int64("response size", m.Written),
 			slog.String("duration", m.Duration.String()),
-		}
+		)
 
 		if referrer := r.Referer(); referrer != "" {
 			attrs = append(attrs, slog.String("referer", referrer))
@@ -99,5 +113,8 @@ func NewAccessLogHandler(h http.Handler, logger *slog.Logger, o *AccessLogOption
 		if o.PostHook != nil {
 			o.PostHook(m.Code, m.Duration, m.Written)
 		}
+		if o.PostRequestHook != nil {
+			o.PostRequestHook(r, m.Code, m.Duration, m.Written)
+		}
 	})
 }
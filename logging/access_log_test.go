@@ -12,7 +12,9 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"resenje.org/web"
 	"resenje.org/web/logging"
 )
 
@@ -102,3 +104,26 @@ func TestAccessLog(t *testing.T) {
 		})
 	}
 }
+
+func TestAccessLog_route(t *testing.T) {
+	router := web.NewRouter()
+	router.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("test data"))
+	})
+
+	var buf bytes.Buffer
+	var route string
+	logging.NewAccessLogHandler(router, slog.New(slog.NewTextHandler(&buf, nil)), &logging.AccessLogOptions{
+		PostRequestHook: func(r *http.Request, code int, duration time.Duration, written int64) {
+			route = web.RoutePattern(r)
+		},
+	}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/42", nil))
+
+	pattern := `method=GET uri=/users/42 route=/users/{id} proto=HTTP/1.1 status=200`
+	if got := buf.String(); !strings.Contains(got, pattern) {
+		t.Errorf("got %v, want %v", got, pattern)
+	}
+	if route != "/users/{id}" {
+		t.Errorf("got route %q, want %q", route, "/users/{id}")
+	}
+}
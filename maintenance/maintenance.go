@@ -12,6 +12,8 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+
+	"resenje.org/web"
 )
 
 // Values for HTTP Content-Type header.
@@ -158,8 +160,9 @@ type Service struct {
 	JSON Response
 	Text Response
 
-	store  Store
-	logger *slog.Logger
+	store    Store
+	problems bool
+	logger   *slog.Logger
 }
 
 // Option is a function that sets optional parameters to the Handler.
@@ -169,6 +172,11 @@ type Option func(*Service)
 // is not used, handler defaults to MemoryStore.
 func WithStore(store Store) Option { return func(o *Service) { o.store = store } }
 
+// WithProblemDetails sets JSONHandler to respond with RFC 9457 problem
+// details during maintenance and JSON API handlers to respond with problem
+// details on errors. Responses set by the JSON field have a precedence.
+func WithProblemDetails(yes bool) Option { return func(o *Service) { o.problems = yes } }
+
 // WithLogger sets the function that will perform message logging.
 // Default is slog.Default().
 func WithLogger(l *slog.Logger) Option { return func(o *Service) { o.logger = l } }
@@ -189,6 +197,27 @@ func New(options ...Option) (s *Service) {
 	return
 }
 
+// Handler is a HTTP middleware that responds during maintenance with HTML,
+// JSON or Text response, depending on the request Accept header. Text
+// response is used if the client does not prefer any format.
+func (s Service) Handler(h http.Handler) http.Handler {
+	htmlHandler := s.HTMLHandler(h)
+	jsonHandler := s.JSONHandler(h)
+	textHandler := s.TextHandler(h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch web.NegotiateContentType(r.Header.Get("Accept"), negotiationOffers) {
+		case "text/html":
+			htmlHandler.ServeHTTP(w, r)
+		case "application/json", web.ProblemJSONContentType:
+			jsonHandler.ServeHTTP(w, r)
+		default:
+			textHandler.ServeHTTP(w, r)
+		}
+	})
+}
+
+var negotiationOffers = []string{"text/plain", "text/html", "application/json", web.ProblemJSONContentType}
+
 // HTMLHandler is a HTTP middleware that should be used
 // alongide HTML pages.
 func (s Service) HTMLHandler(h http.Handler) http.Handler {
@@ -224,6 +253,10 @@ func (s Service) JSONHandler(h http.Handler) http.Handler {
 				s.JSON.Handler.ServeHTTP(w, r)
 				return
 			}
+			if s.problems && s.JSON.Body == "" {
+				web.NewProblem(http.StatusServiceUnavailable, "The service is under maintenance.").ServeHTTP(w, r)
+				return
+			}
 			w.Header().Set("Content-Type", JSONContentType)
 			w.WriteHeader(http.StatusServiceUnavailable)
 			fmt.Fprintln(w, s.JSON.Body)
@@ -266,7 +299,7 @@ func (s Service) StatusHandler(w http.ResponseWriter, r *http.Request) {
 	on, err := s.store.Status()
 	if err != nil {
 		s.logger.Error("maintenance status", "error", err)
-		jsonInternalServerErrorResponse(w)
+		s.internalServerErrorResponse(w, r)
 		return
 	}
 	jsonStatusResponse(w, on)
@@ -279,7 +312,7 @@ func (s Service) OnHandler(w http.ResponseWriter, r *http.Request) {
 	changed, err := s.store.On()
 	if err != nil {
 		s.logger.Error("maintenance on", "error", err)
-		jsonInternalServerErrorResponse(w)
+		s.internalServerErrorResponse(w, r)
 		return
 	}
 	if changed {
@@ -295,7 +328,7 @@ func (s Service) OffHandler(w http.ResponseWriter, r *http.Request) {
 	changed, err := s.store.Off()
 	if err != nil {
 		s.logger.Error("maintenance off", "error", err)
-		jsonInternalServerErrorResponse(w)
+		s.internalServerErrorResponse(w, r)
 		return
 	}
 	if changed {
@@ -316,6 +349,14 @@ func jsonCreatedResponse(w http.ResponseWriter) {
 	fmt.Fprintln(w, `{"message":"Created","code":201}`)
 }
 
+func (s Service) internalServerErrorResponse(w http.ResponseWriter, r *http.Request) {
+	if s.problems {
+		web.NewProblem(http.StatusInternalServerError, "").ServeHTTP(w, r)
+		return
+	}
+	jsonInternalServerErrorResponse(w)
+}
+
 func jsonInternalServerErrorResponse(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", JSONContentType)
 	w.WriteHeader(http.StatusInternalServerError)
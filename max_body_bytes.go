@@ -6,48 +6,176 @@
 package web
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/textproto"
+	"sort"
+	"strings"
 )
 
 // MaxBodyBytesHandler blocks requests with body size greater then specified, by
 // responding with  a request entity too large 513 HTTP response.
 // It is a wrapper around http.MaxBytesReader to also check Content-Length header
 // and and multipart form requests.
+//
+// The limit is enforced lazily, while the Handler reads the request body, and
+// the body is not parsed in advance. Reading over the limit returns an
+// *http.MaxBytesError which the Handler should handle. If the Handler does not
+// write any response after the limit is reached, the request entity too large
+// response is written.
 type MaxBodyBytesHandler struct {
 	// Handler will be used if limit is not reached.
 	Handler http.Handler
 	// Limit is a maximum number of bytes that a request body can have.
+	// It is used for requests that do not match any of the Rules. If it is
+	// 0, requests with a body are rejected, unlike with the limits of
+	// DecompressHandler where 0 means no limit.
 	Limit int64
-	// BodyFunc response will be written as the response.
+	// Rules define limits for specific requests. The first matching rule is
+	// used.
+	Rules []MaxBodyBytesRule
+	// BodyFunc response will be written as the response. If it is nil, the
+	// HTTP status text is written.
 	BodyFunc func(r *http.Request) (string, error)
 	// ContentType will be used as a value for
 	ContentType string
+	// BodyFuncs are used instead of BodyFunc and ContentType if the request
+	// Accept header allows any of the content types which are the keys of
+	// the map.
+	BodyFuncs map[string]func(r *http.Request) (string, error)
 	// ErrorHandler will be used if there is an error from BodyFunc. If it is nil,
 	// a panic will occur.
 	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
 }
 
+// MaxBodyBytesRule defines a limit for requests that match all of its non-empty
+// criteria.
+type MaxBodyBytesRule struct {
+	// PathPrefix is a prefix that the request URL path must have.
+	PathPrefix string
+	// Methods is a list of HTTP methods.
+	Methods []string
+	// ContentTypes is a list of media types, such as application/json, or
+	// media ranges, such as multipart/*, of the request Content-Type header.
+	ContentTypes []string
+	// Limit is a maximum number of bytes that a request body can have. If it
+	// is 0, requests with a body are rejected, as with MaxBodyBytesHandler
+	// Limit.
+	Limit int64
+	// PartLimit is a maximum number of bytes of a multipart form value. If it
+	// is 0, values are limited only by Limit.
+	PartLimit int64
+	// FileLimit is a maximum number of bytes of a multipart form file. If it
+	// is 0, files are limited only by Limit.
+	FileLimit int64
+}
+
+func (rule MaxBodyBytesRule) match(r *http.Request) bool {
+	if rule.PathPrefix != "" && !strings.HasPrefix(r.URL.Path, rule.PathPrefix) {
+		return false
+	}
+	if len(rule.Methods) > 0 && !containsFold(rule.Methods, r.Method) {
+		return false
+	}
+	if len(rule.ContentTypes) > 0 {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == "" {
+			return false
+		}
+		for _, t := range rule.ContentTypes {
+			if matchMediaType(strings.ToLower(t), mediaType) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// MultipartPartTooLargeError is returned by the request body reader when a
+// part of a multipart form is larger than the limit defined by
+// MaxBodyBytesRule PartLimit or FileLimit.
+type MultipartPartTooLargeError struct {
+	Field    string
+	Filename string
+	Limit    int64
+}
+
+func (e *MultipartPartTooLargeError) Error() string {
+	if e.Filename != "" {
+		return fmt.Sprintf("multipart file %q of field %q too large", e.Filename, e.Field)
+	}
+	return fmt.Sprintf("multipart field %q too large", e.Field)
+}
+
+// Unwrap returns an *http.MaxBytesError so that all body size errors can be
+// checked in the same way.
+func (e *MultipartPartTooLargeError) Unwrap() error {
+	return &http.MaxBytesError{Limit: e.Limit}
+}
+
 func (h MaxBodyBytesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.ContentLength > h.Limit {
+	rule := MaxBodyBytesRule{Limit: h.Limit}
+	for _, rl := range h.Rules {
+		if rl.match(r) {
+			rule = rl
+			break
+		}
+	}
+
+	if r.ContentLength > rule.Limit {
 		h.requestEntityTooLarge(w, r)
 		return
 	}
-	r.Body = http.MaxBytesReader(w, r.Body, h.Limit)
+	if r.Body == nil {
+		h.Handler.ServeHTTP(w, r)
+		return
+	}
 
-	if err := r.ParseMultipartForm(1024); r.Body == nil && err != nil {
+	body := &maxBodyBytesReader{ReadCloser: http.MaxBytesReader(w, r.Body, rule.Limit)}
+	if rule.PartLimit > 0 || rule.FileLimit > 0 {
+		mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+			body.ReadCloser = newMultipartLimitReader(body.ReadCloser, params["boundary"], rule.PartLimit, rule.FileLimit)
+		}
+	}
+	r.Body = body
+
+	rw := NewResponseStatusRecorder(w)
+	h.Handler.ServeHTTP(rw, r)
+	if body.limitReached && rw.Status() == 0 {
 		h.requestEntityTooLarge(w, r)
-		return
 	}
-	h.Handler.ServeHTTP(w, r)
 }
 
 func (h MaxBodyBytesHandler) requestEntityTooLarge(w http.ResponseWriter, r *http.Request) {
-	if h.ContentType != "" {
-		w.Header().Set("Content-Type", h.ContentType)
+	bodyFunc, contentType := h.BodyFunc, h.ContentType
+	if len(h.BodyFuncs) > 0 {
+		offers := make([]string, 0, len(h.BodyFuncs))
+		for t := range h.BodyFuncs {
+			offers = append(offers, t)
+		}
+		sort.Strings(offers)
+		if accept := r.Header.Get("Accept"); accept != "" {
+			if t := NegotiateContentType(accept, offers); t != "" {
+				bodyFunc, contentType = h.BodyFuncs[t], t
+			}
+		}
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
 	}
 	w.WriteHeader(http.StatusRequestEntityTooLarge)
-	body, err := h.BodyFunc(r)
+	if bodyFunc == nil {
+		fmt.Fprintln(w, http.StatusText(http.StatusRequestEntityTooLarge))
+		return
+	}
+	body, err := bodyFunc(r)
 	if err != nil {
 		if h.ErrorHandler == nil {
 			panic(err)
@@ -57,3 +185,148 @@ func (h MaxBodyBytesHandler) requestEntityTooLarge(w http.ResponseWriter, r *htt
 	}
 	fmt.Fprintln(w, body)
 }
+
+// maxBodyBytesReader records if any of the body size limits is reached.
+type maxBodyBytesReader struct {
+	io.ReadCloser
+	limitReached bool
+}
+
+func (r *maxBodyBytesReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && !r.limitReached {
+		var maxBytesErr *http.MaxBytesError
+		r.limitReached = errors.As(err, &maxBytesErr)
+	}
+	return n, err
+}
+
+const (
+	multipartStatePreamble = iota
+	multipartStateHeader
+	multipartStateBody
+	multipartStateEpilogue
+)
+
+// multipartHeaderLimit is the maximum number of bytes of part headers that
+// are kept to detect the form field name and filename.
+const multipartHeaderLimit = 16 * 1024
+
+var errMultipartHeaderTooLarge = errors.New("multipart part header too large")
+
+// multipartLimitReader passes the multipart body through, scanning it for
+// part delimiters in order to limit the size of every part without buffering
+// or parsing the whole body in advance.
+type multipartLimitReader struct {
+	io.ReadCloser
+	delim     []byte
+	partLimit int64
+	fileLimit int64
+
+	state   int
+	matched int
+	header  []byte
+	size    int64
+	limit   int64
+	field   string
+	file    string
+	err     error
+}
+
+func newMultipartLimitReader(r io.ReadCloser, boundary string, partLimit, fileLimit int64) *multipartLimitReader {
+	return &multipartLimitReader{
+		ReadCloser: r,
+		delim:      []byte("\r\n--" + boundary),
+		partLimit:  partLimit,
+		fileLimit:  fileLimit,
+		// The first delimiter is not required to be preceded by CRLF.
+		matched: 2,
+	}
+}
+
+func (r *multipartLimitReader) Read(p []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err = r.ReadCloser.Read(p)
+	// Data after the limit violation is not returned, so that the consumer
+	// does not parse a complete body and ignore the error.
+	for i, c := range p[:n] {
+		if r.state == multipartStateEpilogue {
+			break
+		}
+		if r.state == multipartStateHeader {
+			if err := r.scanHeader(c); err != nil {
+				r.err = err
+				return i, r.err
+			}
+			continue
+		}
+		if r.state == multipartStateBody {
+			r.size++
+		}
+		if c == r.delim[r.matched] {
+			r.matched++
+		} else if c == r.delim[0] {
+			r.matched = 1
+		} else {
+			r.matched = 0
+		}
+		if r.matched == len(r.delim) {
+			r.state = multipartStateHeader
+			r.matched = 0
+			r.header = r.header[:0]
+			continue
+		}
+		if r.state == multipartStateBody && r.limit > 0 && r.size-int64(r.matched) > r.limit {
+			r.err = &MultipartPartTooLargeError{
+				Field:    r.field,
+				Filename: r.file,
+				Limit:    r.limit,
+			}
+			return i, r.err
+		}
+	}
+	return n, err
+}
+
+func (r *multipartLimitReader) scanHeader(c byte) error {
+	if len(r.header) >= multipartHeaderLimit {
+		return errMultipartHeaderTooLarge
+	}
+	r.header = append(r.header, c)
+	if bytes.Equal(r.header, []byte("--")) {
+		// Close delimiter.
+		r.state = multipartStateEpilogue
+		return nil
+	}
+	if !bytes.HasSuffix(r.header, []byte("\r\n\r\n")) {
+		return nil
+	}
+	// Skip the transport padding and CRLF after the delimiter.
+	i := bytes.Index(r.header, []byte("\r\n"))
+	h, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(r.header[i+2:]))).ReadMIMEHeader()
+	if err != nil {
+		return err
+	}
+	r.field, r.file = "", ""
+	if _, params, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil {
+		r.field, r.file = params["name"], params["filename"]
+	}
+	r.limit = r.partLimit
+	if r.file != "" {
+		r.limit = r.fileLimit
+	}
+	r.size = 0
+	r.state = multipartStateBody
+	return nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, e := range list {
+		if strings.EqualFold(e, s) {
+			return true
+		}
+	}
+	return false
+}
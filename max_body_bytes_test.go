@@ -9,9 +9,12 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestMaxBodyBytesHandler_Pass(t *testing.T) {
@@ -64,6 +67,61 @@ func TestMaxBodyBytesHandler_Block(t *testing.T) {
 	}
 }
 
+func TestMaxBodyBytesHandler_ZeroLimit(t *testing.T) {
+	h := MaxBodyBytesHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := io.Copy(io.Discard, r.Body); err != nil {
+				return
+			}
+			_, _ = w.Write([]byte("ok"))
+		}),
+	}
+
+	for _, tc := range []struct {
+		name   string
+		body   io.Reader
+		status int
+	}{
+		{name: "without body", body: nil, status: http.StatusOK},
+		{name: "empty body", body: strings.NewReader(""), status: http.StatusOK},
+		{name: "with body", body: strings.NewReader("1"), status: http.StatusRequestEntityTooLarge},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/", tc.body))
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.status, w.Code)
+		}
+	}
+}
+
+type maxBodyBytesDeadlineWriter struct {
+	http.ResponseWriter
+	deadlineSet bool
+}
+
+func (w *maxBodyBytesDeadlineWriter) SetReadDeadline(time.Time) error {
+	w.deadlineSet = true
+	return nil
+}
+
+func TestMaxBodyBytesHandler_ResponseController(t *testing.T) {
+	h := MaxBodyBytesHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := http.NewResponseController(w).SetReadDeadline(time.Now().Add(time.Minute)); err != nil {
+				t.Error(err)
+			}
+		}),
+		Limit: 10,
+	}
+	w := &maxBodyBytesDeadlineWriter{ResponseWriter: httptest.NewRecorder()}
+
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader("1")))
+
+	if !w.deadlineSet {
+		t.Error("expected read deadline to be set on the wrapped response writer")
+	}
+}
+
 func TestMaxBodyBytesHandler_PanicError(t *testing.T) {
 	h := MaxBodyBytesHandler{
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -117,3 +175,240 @@ func TestMaxBodyBytesHandler_CustomError(t *testing.T) {
 		t.Errorf("expected %v error, got %v", errTestMaxBodyBytesHandler, e)
 	}
 }
+
+func TestMaxBodyBytesHandler_NilBodyFunc(t *testing.T) {
+	h := MaxBodyBytesHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		Limit:   10,
+	}
+	r := httptest.NewRequest("POST", "/", bytes.NewReader([]byte("12345678901")))
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status code %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	want := http.StatusText(http.StatusRequestEntityTooLarge) + "\n"
+	if w.Body.String() != want {
+		t.Errorf("expected response body %q, got %q", want, w.Body.String())
+	}
+}
+
+func TestMaxBodyBytesHandler_Lazy(t *testing.T) {
+	var gotErr error
+	h := MaxBodyBytesHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, gotErr = io.Copy(io.Discard, r.Body)
+		}),
+		Limit: 10,
+	}
+	r := httptest.NewRequest("POST", "/", bytes.NewReader([]byte("12345678901")))
+	r.ContentLength = -1
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(gotErr, &maxBytesErr) {
+		t.Errorf("expected http.MaxBytesError, got %v", gotErr)
+	}
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status code %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
+
+func TestMaxBodyBytesHandler_Rules(t *testing.T) {
+	h := MaxBodyBytesHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := io.Copy(io.Discard, r.Body); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}),
+		Limit: 5,
+		Rules: []MaxBodyBytesRule{
+			{
+				PathPrefix:   "/upload/",
+				Methods:      []string{"POST", "PUT"},
+				ContentTypes: []string{"multipart/*"},
+				Limit:        100,
+			},
+			{
+				ContentTypes: []string{"application/json"},
+				Limit:        20,
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		size        int
+		status      int
+	}{
+		{"default pass", "POST", "/", "text/plain", 5, http.StatusOK},
+		{"default block", "POST", "/", "text/plain", 6, http.StatusRequestEntityTooLarge},
+		{"upload pass", "PUT", "/upload/file", "multipart/form-data; boundary=x", 100, http.StatusOK},
+		{"upload block", "POST", "/upload/file", "multipart/form-data; boundary=x", 101, http.StatusRequestEntityTooLarge},
+		{"upload method mismatch", "PATCH", "/upload/file", "multipart/form-data; boundary=x", 6, http.StatusRequestEntityTooLarge},
+		{"upload path mismatch", "POST", "/", "multipart/form-data; boundary=x", 6, http.StatusRequestEntityTooLarge},
+		{"json pass", "POST", "/api", "application/json; charset=utf-8", 20, http.StatusOK},
+		{"json block", "POST", "/upload/file", "application/json", 21, http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.path, bytes.NewReader(bytes.Repeat([]byte("0"), tc.size)))
+			r.Header.Set("Content-Type", tc.contentType)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.status {
+				t.Errorf("expected status code %d, got %d", tc.status, w.Code)
+			}
+		})
+	}
+}
+
+func TestMaxBodyBytesHandler_MultipartLimits(t *testing.T) {
+	newBody := func(value, file string) (body *bytes.Buffer, contentType string) {
+		body = new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		if err := mw.WriteField("name", value); err != nil {
+			t.Fatal(err)
+		}
+		fw, err := mw.CreateFormFile("file", "test.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(fw, file); err != nil {
+			t.Fatal(err)
+		}
+		if err := mw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return body, mw.FormDataContentType()
+	}
+
+	for _, tc := range []struct {
+		name      string
+		value     string
+		file      string
+		wantField string
+		wantFile  string
+	}{
+		{
+			name:  "pass",
+			value: "0123456789",
+			file:  strings.Repeat("0", 100),
+		},
+		{
+			name:      "value too large",
+			value:     "01234567890",
+			file:      strings.Repeat("0", 100),
+			wantField: "name",
+		},
+		{
+			name:      "file too large",
+			value:     "0123456789",
+			file:      strings.Repeat("0", 101),
+			wantField: "file",
+			wantFile:  "test.txt",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotErr error
+			var gotValue string
+			h := MaxBodyBytesHandler{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					gotErr = r.ParseMultipartForm(1024)
+					gotValue = r.FormValue("name")
+				}),
+				Rules: []MaxBodyBytesRule{
+					{
+						ContentTypes: []string{"multipart/form-data"},
+						Limit:        1024,
+						PartLimit:    10,
+						FileLimit:    100,
+					},
+				},
+			}
+			body, contentType := newBody(tc.value, tc.file)
+			r := httptest.NewRequest("POST", "/", body)
+			r.Header.Set("Content-Type", contentType)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			if tc.wantField == "" {
+				if gotErr != nil {
+					t.Fatal(gotErr)
+				}
+				if gotValue != tc.value {
+					t.Errorf("expected value %q, got %q", tc.value, gotValue)
+				}
+				return
+			}
+			var partErr *MultipartPartTooLargeError
+			if !errors.As(gotErr, &partErr) {
+				t.Fatalf("expected MultipartPartTooLargeError, got %v", gotErr)
+			}
+			if partErr.Field != tc.wantField {
+				t.Errorf("expected field %q, got %q", tc.wantField, partErr.Field)
+			}
+			if partErr.Filename != tc.wantFile {
+				t.Errorf("expected filename %q, got %q", tc.wantFile, partErr.Filename)
+			}
+			if w.Code != http.StatusRequestEntityTooLarge {
+				t.Errorf("expected status code %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+			}
+		})
+	}
+}
+
+func TestMaxBodyBytesHandler_BodyFuncs(t *testing.T) {
+	h := MaxBodyBytesHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		Limit:   1,
+		BodyFunc: func(r *http.Request) (string, error) {
+			return "too large", nil
+		},
+		ContentType: "text/plain",
+		BodyFuncs: map[string]func(r *http.Request) (string, error){
+			"application/json": func(r *http.Request) (string, error) {
+				return `{"message":"too large"}`, nil
+			},
+			"text/html": func(r *http.Request) (string, error) {
+				return "<p>too large</p>", nil
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"", "text/plain", "too large\n"},
+		{"application/json", "application/json", `{"message":"too large"}` + "\n"},
+		{"text/html, application/json;q=0.9", "text/html", "<p>too large</p>\n"},
+		{"text/*;q=0.5, application/*", "application/json", `{"message":"too large"}` + "\n"},
+		{"image/png", "text/plain", "too large\n"},
+	} {
+		t.Run(tc.accept, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader("12"))
+			r.Header.Set("Accept", tc.accept)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			if v := w.Header().Get("Content-Type"); v != tc.contentType {
+				t.Errorf("expected Content-Type header %q, got %q", tc.contentType, v)
+			}
+			if w.Body.String() != tc.body {
+				t.Errorf("expected response body %q, got %q", tc.body, w.Body.String())
+			}
+		})
+	}
+}
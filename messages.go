@@ -0,0 +1,331 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MessageCatalog holds translations of message codes for locales. Message
+// formats may reference parameters by their names in curly braces, for
+// example "must be at least {limit} characters long". Messages can have
+// plural forms keyed by plural categories, as returned by PluralCategory.
+type MessageCatalog struct {
+	defaultLocale string
+	messages      map[string]map[string]string
+	plurals       map[string]map[string]map[string]string
+	mu            sync.RWMutex
+}
+
+// NewMessageCatalog creates a new MessageCatalog with the locale that is
+// used when no other locale matches.
+func NewMessageCatalog(defaultLocale string) *MessageCatalog {
+	return &MessageCatalog{
+		defaultLocale: normalizeLocale(defaultLocale),
+		messages:      map[string]map[string]string{},
+		plurals:       map[string]map[string]map[string]string{},
+	}
+}
+
+// Add adds message formats for a locale, keyed by message codes. Locales
+// are case-insensitive and kept in lowercase.
+func (c *MessageCatalog) Add(locale string, messages map[string]string) {
+	locale = normalizeLocale(locale)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, ok := c.messages[locale]
+	if !ok {
+		m = make(map[string]string, len(messages))
+		c.messages[locale] = m
+	}
+	for code, format := range messages {
+		m[code] = format
+	}
+}
+
+// AddPlural adds plural forms of the message for a locale, keyed by plural
+// categories, such as "one", "few" and "other".
+func (c *MessageCatalog) AddPlural(locale, code string, forms map[string]string) {
+	locale = normalizeLocale(locale)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, ok := c.plurals[locale]
+	if !ok {
+		m = make(map[string]map[string]string)
+		c.plurals[locale] = m
+	}
+	f, ok := m[code]
+	if !ok {
+		f = make(map[string]string, len(forms))
+		m[code] = f
+	}
+	for category, format := range forms {
+		f[category] = format
+	}
+}
+
+// LoadFS adds message formats from JSON or gettext PO files in the
+// filesystem that match the pattern. The name of every file without the
+// extension is used as the locale, for example "locales/sr-Latn.json".
+//
+// JSON files must contain an object that maps message codes to formats, or
+// to objects with plural forms keyed by plural categories:
+//
+//	{"welcome": "Welcome, {name}!", "apples": {"one": "{count} apple", "other": "{count} apples"}}
+//
+// In PO files, message IDs are used as codes and plural translations are
+// assigned to plural categories of the locale in the order returned by
+// PluralCategories. Fuzzy and untranslated messages are skipped.
+func (c *MessageCatalog) LoadFS(fsys fs.FS, pattern string) error {
+	files, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		name := path.Base(file)
+		ext := path.Ext(name)
+		locale := strings.TrimSuffix(name, ext)
+		if strings.EqualFold(ext, ".po") {
+			if err := c.addPO(locale, b); err != nil {
+				return fmt.Errorf("parse messages file %s: %w", file, err)
+			}
+			continue
+		}
+		var messages map[string]json.RawMessage
+		if err := json.Unmarshal(b, &messages); err != nil {
+			return fmt.Errorf("decode messages file %s: %w", file, err)
+		}
+		formats := make(map[string]string, len(messages))
+		for code, m := range messages {
+			var format string
+			if err := json.Unmarshal(m, &format); err == nil {
+				formats[code] = format
+				continue
+			}
+			var forms map[string]string
+			if err := json.Unmarshal(m, &forms); err != nil {
+				return fmt.Errorf("decode messages file %s: message %s: %w", file, code, err)
+			}
+			c.AddPlural(locale, code, forms)
+		}
+		c.Add(locale, formats)
+	}
+	return nil
+}
+
+// DefaultLocale returns the locale that is used when no other locale
+// matches.
+func (c *MessageCatalog) DefaultLocale() string {
+	return c.defaultLocale
+}
+
+// Locales returns a sorted list of locales that have messages.
+func (c *MessageCatalog) Locales() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	locales := make([]string, 0, len(c.messages))
+	for locale := range c.messages {
+		locales = append(locales, locale)
+	}
+	for locale := range c.plurals {
+		if _, ok := c.messages[locale]; !ok {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Negotiate returns the locale from the catalog that best matches the
+// Accept-Language HTTP header value. Locales are matched exactly or by their
+// primary language subtag. The default locale is returned if there is no
+// match.
+func (c *MessageCatalog) Negotiate(acceptLanguage string) string {
+	locales := c.Locales()
+	for _, tag := range ParseAcceptLanguage(acceptLanguage) {
+		if tag == "*" {
+			break
+		}
+		if locale, ok := matchLocale(tag, locales); ok {
+			return locale
+		}
+	}
+	return c.defaultLocale
+}
+
+// Format returns the text of the message translated to the locale. If there
+// is no translation for the message code in the locale, its primary language
+// or the default locale, the message Text is returned.
+func (c *MessageCatalog) Format(locale string, m FormMessage) string {
+	if m.Code == "" {
+		return m.Text
+	}
+	format, ok := c.lookup(normalizeLocale(locale), m.Code)
+	if !ok {
+		if m.Text != "" {
+			return m.Text
+		}
+		return m.Code
+	}
+	return formatMessage(format, m.Params)
+}
+
+// FormatPlural returns the text of the message translated to the locale in
+// the plural form for the count n, which is also available as the "count"
+// parameter. If the message has no plural forms, it is formatted as with
+// the Format method.
+func (c *MessageCatalog) FormatPlural(locale string, m FormMessage, n int) string {
+	params := make(map[string]string, len(m.Params)+1)
+	params["count"] = strconv.Itoa(n)
+	for name, value := range m.Params {
+		params[name] = value
+	}
+	m.Params = params
+
+	locale = normalizeLocale(locale)
+	formsLocale, forms, ok := c.lookupPlural(locale, m.Code)
+	if !ok {
+		return c.Format(locale, m)
+	}
+	format, ok := forms[PluralCategory(formsLocale, n)]
+	if !ok {
+		format, ok = forms["other"]
+	}
+	if !ok {
+		return c.Format(locale, m)
+	}
+	return formatMessage(format, m.Params)
+}
+
+// Lookup returns the message format for the locale or its primary language,
+// without falling back to the default locale.
+func (c *MessageCatalog) Lookup(locale, code string) (format string, ok bool) {
+	locale = normalizeLocale(locale)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, l := range []string{locale, localeBase(locale)} {
+		if format, ok := c.messages[l][code]; ok {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// Has returns true if the message or its plural forms are translated to the
+// locale, without falling back to its primary language or the default
+// locale.
+func (c *MessageCatalog) Has(locale, code string) bool {
+	locale = normalizeLocale(locale)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if _, ok := c.messages[locale][code]; ok {
+		return true
+	}
+	_, ok := c.plurals[locale][code]
+	return ok
+}
+
+func (c *MessageCatalog) lookup(locale, code string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, l := range []string{locale, localeBase(locale), c.defaultLocale} {
+		if format, ok := c.messages[l][code]; ok {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+func (c *MessageCatalog) lookupPlural(locale, code string) (string, map[string]string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, l := range []string{locale, localeBase(locale), c.defaultLocale} {
+		if forms, ok := c.plurals[l][code]; ok {
+			return l, forms, true
+		}
+	}
+	return "", nil, false
+}
+
+// formatMessage replaces parameter names in curly braces with their values.
+func formatMessage(format string, params map[string]string) string {
+	if len(params) == 0 {
+		return format
+	}
+	replacements := make([]string, 0, 2*len(params))
+	for name, value := range params {
+		replacements = append(replacements, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(replacements...).Replace(format)
+}
+
+// ParseAcceptLanguage returns language tags from the Accept-Language HTTP
+// header value, ordered by their quality values. Tags are lowercased and tags
+// with the zero quality value are omitted.
+func ParseAcceptLanguage(header string) (tags []string) {
+	for _, a := range ParseAccept(header) {
+		if a.Q <= 0 {
+			continue
+		}
+		tags = append(tags, normalizeLocale(a.Value))
+	}
+	return tags
+}
+
+// matchLocale returns the locale from the list that matches the language tag
+// exactly, by its primary language subtag, or the first one with the same
+// primary language subtag.
+func matchLocale(tag string, locales []string) (string, bool) {
+	tag = normalizeLocale(tag)
+	for _, locale := range locales {
+		if normalizeLocale(locale) == tag {
+			return locale, true
+		}
+	}
+	base := localeBase(tag)
+	for _, locale := range locales {
+		if normalizeLocale(locale) == base {
+			return locale, true
+		}
+	}
+	for _, locale := range locales {
+		if localeBase(normalizeLocale(locale)) == base {
+			return locale, true
+		}
+	}
+	return "", false
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+func localeBase(locale string) string {
+	base, _, _ := strings.Cut(locale, "-")
+	return base
+}
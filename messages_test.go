@@ -0,0 +1,202 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		want   []string
+	}{
+		{header: "", want: nil},
+		{header: "sr", want: []string{"sr"}},
+		{header: "en-US,en;q=0.8,sr-Latn;q=0.9", want: []string{"en-us", "sr-latn", "en"}},
+		{header: "de;q=0, fr ; q=0.5, *;q=0.1", want: []string{"fr", "*"}},
+		{header: "en_GB;q=invalid,it", want: []string{"it"}},
+	} {
+		got := ParseAcceptLanguage(tc.header)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: expected %v, got %v", tc.header, tc.want, got)
+		}
+	}
+}
+
+func TestMessageCatalog(t *testing.T) {
+	c := NewMessageCatalog("en")
+	err := c.LoadFS(fstest.MapFS{
+		"locales/en.json":      {Data: []byte(`{"required": "This field is required.", "min_characters": "Use at least {limit} characters."}`)},
+		"locales/sr-Latn.json": {Data: []byte(`{"required": "Obavezno polje."}`)},
+		"locales/README":       {Data: []byte("not loaded")},
+	}, "locales/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := c.Locales(), []string{"en", "sr-latn"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected locales %v, got %v", want, got)
+	}
+
+	for header, want := range map[string]string{
+		"":                     "en",
+		"sr-Latn":              "sr-latn",
+		"sr":                   "sr-latn",
+		"de, sr-Cyrl;q=0.5":    "sr-latn",
+		"de, en;q=0.1, sr;q=0": "en",
+		"*":                    "en",
+	} {
+		if got := c.Negotiate(header); got != want {
+			t.Errorf("%q: expected locale %q, got %q", header, want, got)
+		}
+	}
+
+	minMessage := FormMessage{Code: "min_characters", Params: map[string]string{"limit": "8"}, Text: "must be at least 8 characters long"}
+	for _, tc := range []struct {
+		locale string
+		m      FormMessage
+		want   string
+	}{
+		{locale: "sr-latn", m: FormMessage{Code: "required", Text: "required"}, want: "Obavezno polje."},
+		{locale: "sr-Latn", m: minMessage, want: "Use at least 8 characters."},
+		{locale: "en", m: FormMessage{Code: "unknown", Text: "unknown error"}, want: "unknown error"},
+		{locale: "en", m: FormMessage{Text: "plain"}, want: "plain"},
+	} {
+		if got := c.Format(tc.locale, tc.m); got != tc.want {
+			t.Errorf("%s %s: expected %q, got %q", tc.locale, tc.m.Code, tc.want, got)
+		}
+	}
+}
+
+func TestFormErrors_Localize(t *testing.T) {
+	c := NewMessageCatalog("en")
+	c.Add("sr", map[string]string{
+		"required":       "obavezno",
+		"min_characters": "najmanje {limit} znaka",
+		"invalid_form":   "neispravan formular",
+	})
+
+	values := url.Values{"name": {"J"}}
+	r := httptest.NewRequest("POST", "/", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	errs, err := DecodeForm(r, &testForm{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs.AddError("custom error")
+	errs.AddErrorMessage(FormMessage{Code: "invalid_form", Text: "invalid form"})
+
+	got := errs.Localize(c, c.Negotiate("sr-RS"))
+	if want := []string{"najmanje 2 znaka"}; !reflect.DeepEqual(got.FieldTexts("name"), want) {
+		t.Errorf("expected name errors %v, got %v", want, got.FieldTexts("name"))
+	}
+	if want := []string{"obavezno"}; !reflect.DeepEqual(got.FieldTexts("email"), want) {
+		t.Errorf("expected email errors %v, got %v", want, got.FieldTexts("email"))
+	}
+	if want := []string{"custom error", "neispravan formular"}; !reflect.DeepEqual(got.Texts(), want) {
+		t.Errorf("expected errors %v, got %v", want, got.Texts())
+	}
+	if m := got.FieldErrors["name"]; len(m) != 1 || m[0].Code != "min_characters" || m[0].Params["limit"] != "2" {
+		t.Errorf("unexpected name messages %+v", m)
+	}
+}
+
+func TestMessageCatalog_plurals(t *testing.T) {
+	c := NewMessageCatalog("en")
+	err := c.LoadFS(fstest.MapFS{
+		"locales/en.json": {Data: []byte(`{"apples": {"one": "{count} apple", "other": "{count} apples"}}`)},
+		"locales/sr.po": {Data: []byte(`# Serbian translations
+msgid ""
+msgstr ""
+"Language: sr\n"
+
+msgid "welcome"
+msgstr "Dobrodošli, "
+"{name}!"
+
+#, fuzzy
+msgid "draft"
+msgstr "nacrt"
+
+msgctxt "menu"
+msgid "open"
+msgstr "otvori"
+
+msgid "apples"
+msgid_plural "apples"
+msgstr[0] "{count} jabuka"
+msgstr[1] "{count} jabuke"
+msgstr[2] "{count} jabuka"
+`)},
+	}, "locales/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		locale string
+		n      int
+		want   string
+	}{
+		{locale: "en", n: 1, want: "1 apple"},
+		{locale: "en", n: 2, want: "2 apples"},
+		{locale: "sr-Latn", n: 21, want: "21 jabuka"},
+		{locale: "sr", n: 3, want: "3 jabuke"},
+		{locale: "sr", n: 12, want: "12 jabuka"},
+		{locale: "de", n: 0, want: "0 apples"},
+	} {
+		if got := c.FormatPlural(tc.locale, FormMessage{Code: "apples"}, tc.n); got != tc.want {
+			t.Errorf("%s %d: expected %q, got %q", tc.locale, tc.n, tc.want, got)
+		}
+	}
+
+	if got, want := c.Format("sr", FormMessage{Code: "welcome", Params: map[string]string{"name": "Ana"}}), "Dobrodošli, Ana!"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	for _, code := range []string{"draft", "open"} {
+		if c.Has("sr", code) {
+			t.Errorf("expected %q not to be loaded", code)
+		}
+	}
+	if !c.Has("sr", "apples") {
+		t.Error("expected plural message to be loaded")
+	}
+	if _, ok := c.Lookup("de", "welcome"); ok {
+		t.Error("expected lookup not to fall back to the default locale")
+	}
+}
+
+func TestPluralCategory(t *testing.T) {
+	for _, tc := range []struct {
+		locale string
+		n      int
+		want   string
+	}{
+		{locale: "en", n: 1, want: "one"},
+		{locale: "en-US", n: 0, want: "other"},
+		{locale: "fr", n: 0, want: "one"},
+		{locale: "ja", n: 1, want: "other"},
+		{locale: "ru", n: 21, want: "one"},
+		{locale: "ru", n: 22, want: "few"},
+		{locale: "ru", n: 11, want: "many"},
+		{locale: "sr_Latn", n: 5, want: "other"},
+		{locale: "pl", n: 22, want: "few"},
+		{locale: "pl", n: 21, want: "many"},
+		{locale: "cs", n: 4, want: "few"},
+		{locale: "sl", n: 102, want: "two"},
+		{locale: "ar", n: 11, want: "many"},
+	} {
+		if got := PluralCategory(tc.locale, tc.n); got != tc.want {
+			t.Errorf("%s %d: expected %q, got %q", tc.locale, tc.n, tc.want, got)
+		}
+	}
+}
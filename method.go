@@ -16,6 +16,32 @@ import (
 // If Handler is not found, a method not allowed HTTP response is returned
 // with specified body and Content-Type header.
 func HandleMethods(methods map[string]http.Handler, body string, contentType string, w http.ResponseWriter, r *http.Request) {
+	handleMethods(methods, w, r, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprintln(w, body)
+	})
+}
+
+// HandleMethodsProblem uses a corresponding Handler based on HTTP request
+// method. If Handler is not found, a method not allowed problem details
+// response is returned.
+func HandleMethodsProblem(methods map[string]http.Handler, w http.ResponseWriter, r *http.Request) {
+	handleMethods(methods, w, r, func(w http.ResponseWriter, r *http.Request) {
+		p := NewProblem(http.StatusMethodNotAllowed, fmt.Sprintf("Method %s is not allowed.", r.Method))
+		p.ServeHTTP(w, r)
+	})
+}
+
+// HandleMethodsWithHandler uses a corresponding Handler based on HTTP
+// request method. If Handler is not found, the methodNotAllowed handler is
+// used to write the response, for example a Responder Handler that
+// negotiates the response format.
+func HandleMethodsWithHandler(methods map[string]http.Handler, methodNotAllowed http.Handler, w http.ResponseWriter, r *http.Request) {
+	handleMethods(methods, w, r, methodNotAllowed.ServeHTTP)
+}
+
+func handleMethods(methods map[string]http.Handler, w http.ResponseWriter, r *http.Request, methodNotAllowed http.HandlerFunc) {
 	if handler, ok := methods[r.Method]; ok {
 		handler.ServeHTTP(w, r)
 	} else {
@@ -28,9 +54,7 @@ func HandleMethods(methods map[string]http.Handler, body string, contentType str
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 		} else {
-			w.Header().Set("Content-Type", contentType)
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			fmt.Fprintln(w, body)
+			methodNotAllowed(w, r)
 		}
 	}
 }
@@ -0,0 +1,215 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AcceptValue is a single element of Accept, Accept-Language,
+// Accept-Encoding or Accept-Charset HTTP header values.
+type AcceptValue struct {
+	// Value is a lowercased media range, language range, content coding or
+	// charset.
+	Value string
+	// Q is the quality value, 1 if it is not specified.
+	Q float64
+	// Params holds media range parameters, excluding the quality value.
+	Params map[string]string
+}
+
+// specificity returns a number that is higher for more specific values, so
+// that "text/html;level=1" is more specific than "text/html" which is more
+// specific than "text/*" or "*/*".
+func (a AcceptValue) specificity() int {
+	if a.Value == "*" || a.Value == "*/*" {
+		return 0
+	}
+	if t, sub, ok := strings.Cut(a.Value, "/"); ok {
+		if t == "*" || sub == "*" {
+			return 1
+		}
+		return 2 + len(a.Params)
+	}
+	return 1 + strings.Count(a.Value, "-")
+}
+
+// ParseAccept parses the value of Accept, Accept-Language, Accept-Encoding or
+// Accept-Charset HTTP headers. Returned values are ordered by the quality
+// value and specificity, from the most preferred ones. Values with invalid
+// quality values are omitted, while the ones with zero quality values are
+// kept, as they explicitly mark values that are not acceptable.
+func ParseAccept(header string) (values []AcceptValue) {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		value, rest, _ := strings.Cut(part, ";")
+		a := AcceptValue{
+			Value: strings.ToLower(strings.TrimSpace(value)),
+			Q:     1,
+		}
+		if strings.Contains(a.Value, "/") {
+			mediaType, params, err := mime.ParseMediaType(part)
+			if err != nil {
+				continue
+			}
+			a.Value = mediaType
+			if len(params) > 0 {
+				a.Params = params
+			}
+		} else if rest != "" {
+			a.Params = make(map[string]string)
+			for _, p := range strings.Split(rest, ";") {
+				name, v, _ := strings.Cut(p, "=")
+				a.Params[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(v)
+			}
+		}
+		if q, ok := a.Params["q"]; ok {
+			v, err := strconv.ParseFloat(q, 64)
+			if err != nil || v < 0 || v > 1 {
+				continue
+			}
+			a.Q = v
+			delete(a.Params, "q")
+			if len(a.Params) == 0 {
+				a.Params = nil
+			}
+		}
+		if a.Value == "" {
+			continue
+		}
+		values = append(values, a)
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		if values[i].Q != values[j].Q {
+			return values[i].Q > values[j].Q
+		}
+		return values[i].specificity() > values[j].specificity()
+	})
+	return values
+}
+
+// Negotiate returns the offer that best matches the named Accept,
+// Accept-Language, Accept-Encoding or Accept-Charset request header. If the
+// header is not set, the first offer is returned, and if none of the offers
+// are acceptable, an empty string is returned. Offers are in the order of
+// the server preference, which is used when offers are equally acceptable.
+func Negotiate(header http.Header, name string, offers []string) string {
+	value := header.Get(name)
+	switch http.CanonicalHeaderKey(name) {
+	case "Accept":
+		return NegotiateContentType(value, offers)
+	case "Accept-Language":
+		return NegotiateLanguage(value, offers)
+	case "Accept-Encoding":
+		return NegotiateEncoding(value, offers)
+	}
+	return NegotiateCharset(value, offers)
+}
+
+// NegotiateContentType returns the offered content type that best matches
+// the Accept header value. Offers may contain parameters, such as
+// "text/html; charset=utf-8".
+func NegotiateContentType(accept string, offers []string) string {
+	return negotiate(accept, offers, func(a AcceptValue, offer string) bool {
+		mediaType, params, err := mime.ParseMediaType(offer)
+		if err != nil || !(a.Value == "*" || matchMediaType(a.Value, mediaType)) {
+			return false
+		}
+		for k, v := range a.Params {
+			if !strings.EqualFold(params[k], v) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// NegotiateLanguage returns the offered language tag that best matches the
+// Accept-Language header value. Language ranges match tags that are equal
+// or that start with the range followed by "-", so that "en" matches
+// "en-US".
+func NegotiateLanguage(acceptLanguage string, offers []string) string {
+	return negotiate(acceptLanguage, offers, func(a AcceptValue, offer string) bool {
+		offer = strings.ToLower(offer)
+		return a.Value == "*" || a.Value == offer || strings.HasPrefix(offer, a.Value+"-")
+	})
+}
+
+// NegotiateEncoding returns the offered content coding that best matches the
+// Accept-Encoding header value. The "identity" coding is acceptable unless
+// it is explicitly excluded.
+func NegotiateEncoding(acceptEncoding string, offers []string) string {
+	if strings.TrimSpace(acceptEncoding) != "" {
+		identity := "identity;q=0.001"
+		for _, a := range ParseAccept(acceptEncoding) {
+			if a.Value == "identity" || a.Value == "*" {
+				identity = ""
+				break
+			}
+		}
+		if identity != "" {
+			acceptEncoding += "," + identity
+		}
+	}
+	return negotiate(acceptEncoding, offers, matchToken)
+}
+
+// NegotiateCharset returns the offered charset that best matches the
+// Accept-Charset header value.
+func NegotiateCharset(acceptCharset string, offers []string) string {
+	return negotiate(acceptCharset, offers, matchToken)
+}
+
+func matchToken(a AcceptValue, offer string) bool {
+	return a.Value == "*" || strings.EqualFold(a.Value, offer)
+}
+
+// negotiate returns the offer with the highest quality value of the most
+// specific matching value from the header.
+func negotiate(header string, offers []string, match func(a AcceptValue, offer string) bool) string {
+	if strings.TrimSpace(header) == "" {
+		if len(offers) == 0 {
+			return ""
+		}
+		return offers[0]
+	}
+	values := ParseAccept(header)
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, offer := range offers {
+		q, specificity := 0.0, -1
+		for _, a := range values {
+			if s := a.specificity(); s > specificity && match(a, offer) {
+				q, specificity = a.Q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// matchMediaType returns true if the media type matches the media range which
+// can contain wildcards.
+func matchMediaType(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(mediaRange, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return false
+}
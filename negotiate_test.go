@@ -0,0 +1,68 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseAccept(t *testing.T) {
+	got := ParseAccept("text/*;q=0.3, text/html;q=0.7, text/html;level=1, text/html;level=2;q=0.4, */*;q=0.5, invalid;q=x")
+	want := []AcceptValue{
+		{Value: "text/html", Q: 1, Params: map[string]string{"level": "1"}},
+		{Value: "text/html", Q: 0.7},
+		{Value: "*/*", Q: 0.5},
+		{Value: "text/html", Q: 0.4, Params: map[string]string{"level": "2"}},
+		{Value: "text/*", Q: 0.3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	got = ParseAccept("en, sr-Latn-RS;q=0.8, *;q=0")
+	want = []AcceptValue{
+		{Value: "en", Q: 1},
+		{Value: "sr-latn-rs", Q: 0.8},
+		{Value: "*", Q: 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		value  string
+		offers []string
+		want   string
+	}{
+		{name: "Accept", value: "", offers: []string{"text/html", "application/json"}, want: "text/html"},
+		{name: "Accept", value: "application/json", offers: []string{"text/html", "application/json"}, want: "application/json"},
+		{name: "Accept", value: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", offers: []string{"application/json", "text/html; charset=utf-8"}, want: "text/html; charset=utf-8"},
+		{name: "Accept", value: "*/*", offers: []string{"application/json", "text/html"}, want: "application/json"},
+		{name: "Accept", value: "text/*, text/plain;q=0", offers: []string{"text/plain", "text/html"}, want: "text/html"},
+		{name: "Accept", value: "image/*", offers: []string{"text/plain", "text/html"}, want: ""},
+		{name: "Accept", value: "text/html;level=1, text/html;q=0.5", offers: []string{"text/html", "text/html;level=1"}, want: "text/html;level=1"},
+		{name: "Accept-Language", value: "sr, en;q=0.5", offers: []string{"en-US", "sr-Latn"}, want: "sr-Latn"},
+		{name: "Accept-Language", value: "de, *;q=0.1", offers: []string{"en", "fr"}, want: "en"},
+		{name: "Accept-Language", value: "de", offers: []string{"en", "fr"}, want: ""},
+		{name: "Accept-Encoding", value: "gzip;q=0.5, br", offers: []string{"gzip", "br"}, want: "br"},
+		{name: "Accept-Encoding", value: "gzip", offers: []string{"zstd", "identity"}, want: "identity"},
+		{name: "Accept-Encoding", value: "gzip, identity;q=0", offers: []string{"zstd", "identity"}, want: ""},
+		{name: "Accept-Charset", value: "iso-8859-5, UTF-8;q=0.8", offers: []string{"utf-8"}, want: "utf-8"},
+	} {
+		header := http.Header{}
+		if tc.value != "" {
+			header.Set(tc.name, tc.value)
+		}
+		if got := Negotiate(header, tc.name, tc.offers); got != tc.want {
+			t.Errorf("%s %q %v: expected %q, got %q", tc.name, tc.value, tc.offers, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+// pluralRule holds plural categories of a language, in the order used by
+// gettext plural forms, and the function that selects one of them for a
+// non-negative integer.
+type pluralRule struct {
+	categories []string
+	category   func(n int) string
+}
+
+var (
+	pluralRuleOther = pluralRule{
+		categories: []string{"other"},
+		category:   func(int) string { return "other" },
+	}
+	pluralRuleOneOther = pluralRule{
+		categories: []string{"one", "other"},
+		category: func(n int) string {
+			if n == 1 {
+				return "one"
+			}
+			return "other"
+		},
+	}
+	pluralRuleZeroOneOther = pluralRule{
+		categories: []string{"one", "other"},
+		category: func(n int) string {
+			if n == 0 || n == 1 {
+				return "one"
+			}
+			return "other"
+		},
+	}
+	pluralRuleEastSlavic = pluralRule{
+		categories: []string{"one", "few", "many"},
+		category: func(n int) string {
+			switch {
+			case n%10 == 1 && n%100 != 11:
+				return "one"
+			case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+				return "few"
+			}
+			return "many"
+		},
+	}
+	pluralRuleSouthSlavic = pluralRule{
+		categories: []string{"one", "few", "other"},
+		category: func(n int) string {
+			switch {
+			case n%10 == 1 && n%100 != 11:
+				return "one"
+			case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+				return "few"
+			}
+			return "other"
+		},
+	}
+	pluralRulePolish = pluralRule{
+		categories: []string{"one", "few", "many"},
+		category: func(n int) string {
+			switch {
+			case n == 1:
+				return "one"
+			case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+				return "few"
+			}
+			return "many"
+		},
+	}
+	pluralRuleWestSlavic = pluralRule{
+		categories: []string{"one", "few", "other"},
+		category: func(n int) string {
+			switch {
+			case n == 1:
+				return "one"
+			case n >= 2 && n <= 4:
+				return "few"
+			}
+			return "other"
+		},
+	}
+	pluralRuleSlovenian = pluralRule{
+		categories: []string{"one", "two", "few", "other"},
+		category: func(n int) string {
+			switch n % 100 {
+			case 1:
+				return "one"
+			case 2:
+				return "two"
+			case 3, 4:
+				return "few"
+			}
+			return "other"
+		},
+	}
+	pluralRuleArabic = pluralRule{
+		categories: []string{"zero", "one", "two", "few", "many", "other"},
+		category: func(n int) string {
+			switch {
+			case n == 0:
+				return "zero"
+			case n == 1:
+				return "one"
+			case n == 2:
+				return "two"
+			case n%100 >= 3 && n%100 <= 10:
+				return "few"
+			case n%100 >= 11:
+				return "many"
+			}
+			return "other"
+		},
+	}
+)
+
+// pluralRules are plural rules for integers from CLDR by primary language
+// subtags. Languages that are not listed use the English rule.
+var pluralRules = map[string]pluralRule{
+	"ja": pluralRuleOther,
+	"zh": pluralRuleOther,
+	"ko": pluralRuleOther,
+	"vi": pluralRuleOther,
+	"th": pluralRuleOther,
+	"id": pluralRuleOther,
+	"ms": pluralRuleOther,
+	"fr": pluralRuleZeroOneOther,
+	"pt": pluralRuleZeroOneOther,
+	"hi": pluralRuleZeroOneOther,
+	"ru": pluralRuleEastSlavic,
+	"uk": pluralRuleEastSlavic,
+	"be": pluralRuleEastSlavic,
+	"sr": pluralRuleSouthSlavic,
+	"hr": pluralRuleSouthSlavic,
+	"bs": pluralRuleSouthSlavic,
+	"pl": pluralRulePolish,
+	"cs": pluralRuleWestSlavic,
+	"sk": pluralRuleWestSlavic,
+	"sl": pluralRuleSlovenian,
+	"ar": pluralRuleArabic,
+}
+
+func pluralRuleFor(locale string) pluralRule {
+	if r, ok := pluralRules[localeBase(normalizeLocale(locale))]; ok {
+		return r
+	}
+	return pluralRuleOneOther
+}
+
+// PluralCategory returns the CLDR plural category, such as "one", "few" or
+// "other", of the non-negative integer for the locale.
+func PluralCategory(locale string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+	return pluralRuleFor(locale).category(n)
+}
+
+// PluralCategories returns plural categories of the locale in the order of
+// gettext plural forms.
+func PluralCategories(locale string) []string {
+	return append([]string(nil), pluralRuleFor(locale).categories...)
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// poEntry is a single message from a gettext PO file.
+type poEntry struct {
+	id       string
+	plural   string
+	str      map[int]string
+	fuzzy    bool
+	obsolete bool
+}
+
+// addPO adds messages from the gettext PO file content.
+func (c *MessageCatalog) addPO(locale string, data []byte) error {
+	entries, err := parsePO(data)
+	if err != nil {
+		return err
+	}
+	categories := PluralCategories(locale)
+	messages := make(map[string]string)
+	for _, e := range entries {
+		if e.id == "" || e.fuzzy || e.obsolete {
+			continue
+		}
+		if e.plural == "" {
+			if s := e.str[0]; s != "" {
+				messages[e.id] = s
+			}
+			continue
+		}
+		forms := make(map[string]string)
+		for i, category := range categories {
+			if s := e.str[i]; s != "" {
+				forms[category] = s
+			}
+		}
+		if len(forms) > 0 {
+			c.AddPlural(locale, e.id, forms)
+		}
+	}
+	c.Add(locale, messages)
+	return nil
+}
+
+// parsePO parses entries of a gettext PO file. Entries with message
+// contexts are omitted.
+func parsePO(data []byte) (entries []poEntry, err error) {
+	var (
+		e       poEntry
+		context bool
+		started bool
+		// field is the keyword of the last string, to which continuation
+		// strings are appended, and index is the msgstr plural index.
+		field string
+		index int
+	)
+	flush := func() {
+		if started && !context {
+			entries = append(entries, e)
+		}
+		e = poEntry{}
+		context, started, field = false, false, ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		s := strings.TrimSpace(scanner.Text())
+		if rest, ok := strings.CutPrefix(s, "#~"); ok {
+			e.obsolete = true
+			s = strings.TrimSpace(rest)
+		}
+		switch {
+		case s == "":
+			flush()
+			continue
+		case strings.HasPrefix(s, "#,"):
+			if started {
+				flush()
+			}
+			for _, flag := range strings.Split(s[2:], ",") {
+				if strings.TrimSpace(flag) == "fuzzy" {
+					e.fuzzy = true
+				}
+			}
+			continue
+		case strings.HasPrefix(s, "#"):
+			continue
+		}
+
+		keyword, value := "", s
+		if !strings.HasPrefix(s, `"`) {
+			keyword, value, _ = strings.Cut(s, " ")
+		}
+		v, err := strconv.Unquote(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		switch {
+		case keyword == "":
+			if field == "" {
+				return nil, fmt.Errorf("line %d: unexpected string", line)
+			}
+		case keyword == "msgctxt" || keyword == "msgid":
+			if e.str != nil {
+				flush()
+			}
+			started = true
+			if keyword == "msgctxt" {
+				context = true
+			}
+			field = keyword
+		case keyword == "msgid_plural":
+			field = keyword
+		case keyword == "msgstr":
+			field, index = keyword, 0
+		case strings.HasPrefix(keyword, "msgstr[") && strings.HasSuffix(keyword, "]"):
+			index, err = strconv.Atoi(keyword[len("msgstr[") : len(keyword)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid plural index: %w", line, err)
+			}
+			field = "msgstr"
+		default:
+			return nil, fmt.Errorf("line %d: unknown keyword %q", line, keyword)
+		}
+
+		switch field {
+		case "msgid":
+			e.id += v
+		case "msgid_plural":
+			e.plural += v
+		case "msgstr":
+			if e.str == nil {
+				e.str = make(map[int]string)
+			}
+			e.str[index] += v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return entries, nil
+}
@@ -0,0 +1,297 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Content types of problem details responses.
+const (
+	ProblemJSONContentType = "application/problem+json"
+	ProblemXMLContentType  = "application/problem+xml"
+)
+
+// problemXMLNamespace is the XML namespace for problem details defined in
+// RFC 9457.
+const problemXMLNamespace = "urn:ietf:rfc:7807"
+
+// Problem holds problem details for HTTP APIs as defined in RFC 9457. Members
+// from Extensions are serialized alongside standard members.
+//
+// Problem implements http.Handler interface and writes itself as JSON or XML,
+// depending on the request Accept header. It also implements the error
+// interface, so that it can be returned as an error that carries the HTTP
+// response information.
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]any
+}
+
+// NewProblem creates a new Problem with the "about:blank" type and the title
+// set to the text of the HTTP status code.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// FormErrorsProblem converts FormErrors into a validation problem with the
+// Bad Request status. General and field errors are set as "errors" and
+// "field_errors" extension members, the same as FormErrors JSON encoding.
+func FormErrorsProblem(errs FormErrors) *Problem {
+	p := NewProblem(http.StatusBadRequest, "The request contains invalid data.")
+	p.Extensions = make(map[string]any, 2)
+	if len(errs.Errors) > 0 {
+		p.Extensions["errors"] = errs.Errors
+	}
+	if len(errs.FieldErrors) > 0 {
+		p.Extensions["field_errors"] = errs.FieldErrors
+	}
+	return p
+}
+
+// Error returns the title and the detail of the problem.
+func (p *Problem) Error() string {
+	title := p.Title
+	if title == "" {
+		title = http.StatusText(p.Status)
+	}
+	if p.Detail == "" {
+		return title
+	}
+	return title + ": " + p.Detail
+}
+
+// ServeHTTP writes the problem to the response with the Status code. XML is
+// written only if the client prefers it over JSON.
+func (p *Problem) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	contentType := ProblemJSONContentType
+	if strings.Contains(NegotiateContentType(r.Header.Get("Accept"), problemContentTypes), "xml") {
+		contentType = ProblemXMLContentType
+	}
+	_ = p.Write(w, contentType)
+}
+
+var problemContentTypes = []string{
+	ProblemJSONContentType,
+	ProblemXMLContentType,
+	"application/json",
+	"application/xml",
+	"text/xml",
+}
+
+// Write writes the problem to the response with the Status code, encoded as
+// JSON or as XML if the content type is ProblemXMLContentType.
+func (p *Problem) Write(w http.ResponseWriter, contentType string) error {
+	var (
+		b   []byte
+		err error
+	)
+	if contentType == ProblemXMLContentType {
+		b, err = xml.Marshal(p)
+		b = append([]byte(xml.Header), b...)
+	} else {
+		contentType = ProblemJSONContentType
+		b, err = json.Marshal(p)
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return err
+	}
+	status := p.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	for k, v := range p.members() {
+		m[k] = v
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*p = Problem{}
+	for k, v := range m {
+		var dst any
+		switch k {
+		case "type":
+			dst = &p.Type
+		case "title":
+			dst = &p.Title
+		case "status":
+			dst = &p.Status
+		case "detail":
+			dst = &p.Detail
+		case "instance":
+			dst = &p.Instance
+		default:
+			var e any
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if p.Extensions == nil {
+				p.Extensions = make(map[string]any)
+			}
+			p.Extensions[k] = e
+			continue
+		}
+		// Members with invalid types are ignored as required by RFC 9457.
+		_ = json.Unmarshal(v, dst)
+	}
+	return nil
+}
+
+// MarshalXML implements xml.Marshaler interface. Extension arrays are encoded
+// with "i" elements as described in RFC 9457 Appendix B.
+func (p *Problem) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	start := xml.StartElement{Name: xml.Name{Space: problemXMLNamespace, Local: "problem"}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	members := p.members()
+	for _, k := range []string{"type", "title", "status", "detail", "instance"} {
+		if v, ok := members[k]; ok {
+			if err := encodeProblemXMLValue(e, k, v); err != nil {
+				return err
+			}
+		}
+	}
+	keys := make([]string, 0, len(p.Extensions))
+	for k := range p.Extensions {
+		if _, ok := members[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := encodeProblemXMLValue(e, k, p.Extensions[k]); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+func (p *Problem) members() map[string]any {
+	m := make(map[string]any, 5)
+	if p.Type != "" {
+		m["type"] = p.Type
+	}
+	if p.Title != "" {
+		m["title"] = p.Title
+	}
+	if p.Status != 0 {
+		m["status"] = p.Status
+	}
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return m
+}
+
+// encodeProblemXMLValue encodes the value as the element with the name. If
+// the name is not a valid XML name, for example a form field path, the value
+// is encoded as the "i" element with the name in the "key" attribute.
+func encodeProblemXMLValue(e *xml.Encoder, name string, v any) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !isXMLName(name) {
+		start = xml.StartElement{
+			Name: xml.Name{Local: "i"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}},
+		}
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := encodeProblemXMLValue(e, "i", rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			if err := encodeProblemXMLValue(e, k.String(), rv.MapIndex(k).Interface()); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	case reflect.Struct:
+		return e.EncodeElement(rv.Interface(), start)
+	}
+	return e.EncodeElement(fmt.Sprint(rv.Interface()), start)
+}
+
+func isXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case i > 0 && (c >= '0' && c <= '9' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
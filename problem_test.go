@@ -0,0 +1,110 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestProblem_JSON(t *testing.T) {
+	p := NewProblem(http.StatusForbidden, "Your current balance is 30, but that costs 50.")
+	p.Type = "https://example.com/probs/out-of-credit"
+	p.Title = "You do not have enough credit."
+	p.Instance = "/account/12345/msgs/abc"
+	p.Extensions = map[string]any{
+		"balance": 30,
+		"status":  "ignored",
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status code %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if v := w.Header().Get("Content-Type"); v != ProblemJSONContentType {
+		t.Errorf("expected content type %q, got %q", ProblemJSONContentType, v)
+	}
+	want := `{"balance":30,"detail":"Your current balance is 30, but that costs 50.","instance":"/account/12345/msgs/abc","status":403,"title":"You do not have enough credit.","type":"https://example.com/probs/out-of-credit"}` + "\n"
+	if v := w.Body.String(); v != want {
+		t.Errorf("expected body %q, got %q", want, v)
+	}
+
+	var got Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	p.Extensions = map[string]any{"balance": float64(30)}
+	if !reflect.DeepEqual(&got, p) {
+		t.Errorf("expected %+v, got %+v", p, &got)
+	}
+}
+
+func TestProblem_XML(t *testing.T) {
+	errs := FormErrors{}
+	errs.AddError("invalid form")
+	errs.AddFieldError("items[0].name", "required")
+	errs.AddFieldErrorMessage("name", FormMessage{Code: "min_characters", Params: map[string]string{"limit": "2"}, Text: "too short"})
+	p := FormErrorsProblem(errs)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/json;q=0.5, application/xml")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if v := w.Header().Get("Content-Type"); v != ProblemXMLContentType {
+		t.Errorf("expected content type %q, got %q", ProblemXMLContentType, v)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<problem xmlns="urn:ietf:rfc:7807">` +
+		`<type>about:blank</type><title>Bad Request</title><status>400</status><detail>The request contains invalid data.</detail>` +
+		`<errors><i><text>invalid form</text></i></errors>` +
+		`<field_errors><i key="items[0].name"><i><text>required</text></i></i>` +
+		`<name><i code="min_characters"><text>too short</text><params><limit>2</limit></params></i></name></field_errors>` +
+		`</problem>` + "\n"
+	if v := w.Body.String(); v != want {
+		t.Errorf("expected body %q, got %q", want, v)
+	}
+}
+
+func TestProblem_Error(t *testing.T) {
+	if v := NewProblem(http.StatusNotFound, "").Error(); v != "Not Found" {
+		t.Errorf("expected %q, got %q", "Not Found", v)
+	}
+	if v := (&Problem{Status: http.StatusConflict, Detail: "exists"}).Error(); v != "Conflict: exists" {
+		t.Errorf("expected %q, got %q", "Conflict: exists", v)
+	}
+}
+
+func TestHandleMethodsProblem(t *testing.T) {
+	methods := map[string]http.Handler{
+		"GET":  http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		"POST": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	}
+	r := httptest.NewRequest("DELETE", "/", nil)
+	w := httptest.NewRecorder()
+
+	HandleMethodsProblem(methods, w, r)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status code %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+	if v := w.Header().Get("Allow"); v != "GET, POST" {
+		t.Errorf("expected Allow header %q, got %q", "GET, POST", v)
+	}
+	want := `{"detail":"Method DELETE is not allowed.","status":405,"title":"Method Not Allowed","type":"about:blank"}` + "\n"
+	if v := w.Body.String(); v != want {
+		t.Errorf("expected body %q, got %q", want, v)
+	}
+}
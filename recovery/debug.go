@@ -0,0 +1,149 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package recovery
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// DebugError is implemented by errors that provide additional information
+// for the debug page set by WithDebug option.
+type DebugError interface {
+	error
+	// DebugAttrs returns attributes that are listed on the page.
+	DebugAttrs() []slog.Attr
+	// DebugSource returns the filename, the line and the content of the
+	// source file in which the error occurred. Source lines are not shown if
+	// the filename is empty.
+	DebugSource() (filename string, line int, content []byte)
+}
+
+// debugSourceContext is the number of lines shown before and after the line
+// in which the error occurred.
+const debugSourceContext = 5
+
+type debugSourceLine struct {
+	Number  int
+	Text    string
+	Current bool
+}
+
+type debugPageData struct {
+	Label  string
+	Error  string
+	Type   string
+	Method string
+	URL    string
+	Attrs  []slog.Attr
+	File   string
+	Source []debugSourceLine
+	Stack  string
+}
+
+var debugPageTemplate = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Internal Server Error</title>
+<style>
+body { margin: 0; font-family: sans-serif; color: #222; background: #fafafa; }
+header { padding: 1.5em 2em; color: #fff; background: #b3261e; }
+header h1 { margin: 0 0 .5em; font-size: 1.1em; font-weight: normal; }
+header p { margin: 0; font-family: monospace; font-size: 1.2em; white-space: pre-wrap; }
+section { padding: 1em 2em; }
+h2 { font-size: 1em; text-transform: uppercase; color: #666; }
+table { border-collapse: collapse; }
+th { padding: .2em 1em .2em 0; text-align: left; font-weight: normal; color: #666; }
+td { font-family: monospace; }
+pre { margin: 0; padding: 1em; overflow: auto; background: #fff; border: 1px solid #ddd; }
+.source span { display: block; }
+.source .current { background: #fde0dc; }
+.source i { display: inline-block; width: 4em; color: #999; font-style: normal; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{with .Label}}{{.}}: {{end}}{{.Type}}</h1>
+<p>{{.Error}}</p>
+</header>
+<section>
+<h2>Request</h2>
+<table>
+<tr><th>Method</th><td>{{.Method}}</td></tr>
+<tr><th>URL</th><td>{{.URL}}</td></tr>
+{{- range .Attrs}}
+<tr><th>{{.Key}}</th><td>{{.Value}}</td></tr>
+{{- end}}
+</table>
+</section>
+{{- if .Source}}
+<section>
+<h2>{{.File}}</h2>
+<pre class="source">
+{{- range .Source}}<span{{if .Current}} class="current"{{end}}><i>{{.Number}}</i>{{.Text}}</span>{{end -}}
+</pre>
+</section>
+{{- end}}
+<section>
+<h2>Stack</h2>
+<pre>{{.Stack}}</pre>
+</section>
+</body>
+</html>
+`))
+
+// writeDebugPage writes the HTML page with details about the panic error.
+func writeDebugPage(w http.ResponseWriter, r *http.Request, err error, stack []byte, label string) {
+	data := debugPageData{
+		Label:  label,
+		Error:  err.Error(),
+		Type:   fmt.Sprintf("%T", err),
+		Method: r.Method,
+		URL:    r.URL.String(),
+		Stack:  string(stack),
+	}
+	var de DebugError
+	if errors.As(err, &de) {
+		data.Type = fmt.Sprintf("%T", de)
+		data.Attrs = de.DebugAttrs()
+		if filename, line, content := de.DebugSource(); filename != "" {
+			data.File = filename
+			data.Source = debugSourceLines(content, line)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := debugPageTemplate.Execute(&buf, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusInternalServerError)
+	_, _ = buf.WriteTo(w)
+}
+
+// debugSourceLines returns lines of the content around the line.
+func debugSourceLines(content []byte, line int) []debugSourceLine {
+	lines := strings.Split(string(content), "\n")
+	start := max(line-debugSourceContext, 1)
+	end := min(line+debugSourceContext, len(lines))
+	var list []debugSourceLine
+	for n := start; n <= end; n++ {
+		list = append(list, debugSourceLine{
+			Number:  n,
+			Text:    lines[n-1],
+			Current: n == line,
+		})
+	}
+	return list
+}
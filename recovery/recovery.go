@@ -10,6 +10,8 @@ import (
 	"log/slog"
 	"net/http"
 	"runtime/debug"
+
+	"resenje.org/web"
 )
 
 // Handler implements http.Handler interface that will recover from panic
@@ -20,6 +22,9 @@ type Handler struct {
 	panicBody            string
 	panicContentType     string
 	panicResponseHandler http.Handler
+	panicErrorHandler    func(w http.ResponseWriter, r *http.Request, err error)
+	problems             bool
+	debug                bool
 	logger               *slog.Logger
 	notifier             Notifier
 }
@@ -50,6 +55,30 @@ func WithPanicResponseHandler(h http.Handler) Option {
 	return func(o *Handler) { o.panicResponseHandler = h }
 }
 
+// WithPanicErrorHandler sets the function that writes the response on
+// panic event with the recovered value converted to an error. It can be used
+// with web.ErrorRenderer WriteError method so that panics and errors returned
+// by web.HandlerFunc are rendered in the same way. If
+// WithPanicResponseHandler is defined, this option is ignored. This option
+// has a precedence upon WithProblemDetails and WithPanicResponse.
+func WithPanicErrorHandler(fn func(w http.ResponseWriter, r *http.Request, err error)) Option {
+	return func(o *Handler) { o.panicErrorHandler = fn }
+}
+
+// WithProblemDetails sets the RFC 9457 problem details response with the
+// Internal Server Error status on panic event. If WithPanicResponseHandler
+// is defined, this option is ignored. This option has a precedence upon
+// WithPanicResponse.
+func WithProblemDetails(yes bool) Option { return func(o *Handler) { o.problems = yes } }
+
+// WithDebug sets the HTML response on panic event with the error, the
+// request, the stack trace and, for errors that implement DebugError like
+// templates.ExecuteError, the additional information and the source lines
+// where the error occurred. It exposes internal details of the application
+// and must be enabled only in development. This option has a precedence upon
+// all other response options.
+func WithDebug(yes bool) Option { return func(o *Handler) { o.debug = yes } }
+
 // WithLogger sets the function that will perform message logging.
 // Default is slog.Default().
 func WithLogger(l *slog.Logger) Option {
@@ -73,14 +102,21 @@ func New(handler http.Handler, options ...Option) (h *Handler) {
 	return
 }
 
-// ServeHTTP implements http.Handler interface.
+// ServeHTTP implements http.Handler interface. Panics with
+// http.ErrAbortHandler are not recovered, so that the server aborts the
+// response.
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	defer func() {
 		if err := recover(); err != nil {
+			if err == http.ErrAbortHandler {
+				// Let the server abort the response without logging.
+				panic(err)
+			}
+			stack := debug.Stack()
 			debugMsg := fmt.Sprintf(
 				"%s\n\n%#v\n\n%#v",
-				debug.Stack(),
+				stack,
 				r.URL,
 				r.Header,
 			)
@@ -112,11 +148,26 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				}()
 			}
 
+			if h.debug {
+				writeDebugPage(w, r, panicError(err), stack, h.label)
+				return
+			}
+
 			if h.panicResponseHandler != nil {
 				h.panicResponseHandler.ServeHTTP(w, r)
 				return
 			}
 
+			if h.panicErrorHandler != nil {
+				h.panicErrorHandler(w, r, panicError(err))
+				return
+			}
+
+			if h.problems {
+				web.NewProblem(http.StatusInternalServerError, "").ServeHTTP(w, r)
+				return
+			}
+
 			if h.panicContentType != "" {
 				w.Header().Set("Content-Type", h.panicContentType)
 			}
@@ -130,6 +181,14 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.handler.ServeHTTP(w, r)
 }
 
+// panicError converts a value recovered from panic to an error.
+func panicError(v any) error {
+	if err, ok := v.(error); ok {
+		return err
+	}
+	return fmt.Errorf("panic: %v", v)
+}
+
 // Notifier defines functionalities required for sending notifications.
 type Notifier interface {
 	Notify(subject, body string) error
@@ -7,6 +7,7 @@ package recovery
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"log"
 	"log/slog"
@@ -14,6 +15,8 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"resenje.org/web"
 )
 
 var (
@@ -113,3 +116,110 @@ func TestHandlerNotifier(t *testing.T) {
 		t.Errorf("got %q, expected %q", body, "runtime/debug.Stack")
 	}
 }
+
+func TestHandlerProblemDetails(t *testing.T) {
+	log.SetOutput(io.Discard)
+
+	recovery := New(panicHandler, WithPanicResponse("ignored", "text/plain"), WithProblemDetails(true))
+	recorder := httptest.NewRecorder()
+	recovery.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, recorder.Code)
+	}
+	if v := recorder.Header().Get("Content-Type"); v != "application/problem+json" {
+		t.Errorf("expected content type %q, got %q", "application/problem+json", v)
+	}
+	want := `{"status":500,"title":"Internal Server Error","type":"about:blank"}` + "\n"
+	if v := recorder.Body.String(); v != want {
+		t.Errorf("expected body %q, got %q", want, v)
+	}
+}
+
+func TestHandlerPanicErrorHandler(t *testing.T) {
+	log.SetOutput(io.Discard)
+
+	renderer := &web.ErrorRenderer{}
+	recovery := New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(web.NewHTTPError(http.StatusServiceUnavailable, "Try again later.", nil))
+	}), WithPanicErrorHandler(renderer.WriteError))
+	recorder := httptest.NewRecorder()
+	recovery.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status code %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+	if v := recorder.Body.String(); v != "Try again later.\n" {
+		t.Errorf("expected body %q, got %q", "Try again later.\n", v)
+	}
+
+	recovery = New(panicHandler, WithPanicErrorHandler(renderer.WriteError))
+	recorder = httptest.NewRecorder()
+	recovery.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, recorder.Code)
+	}
+	if v := recorder.Body.String(); v != "Internal Server Error\n" {
+		t.Errorf("expected body %q, got %q", "Internal Server Error\n", v)
+	}
+}
+
+type testDebugError struct{}
+
+func (testDebugError) Error() string { return "template <failed>" }
+
+func (testDebugError) DebugAttrs() []slog.Attr {
+	return []slog.Attr{slog.String("template", "page")}
+}
+
+func (testDebugError) DebugSource() (string, int, []byte) {
+	return "page.html", 3, []byte("one\ntwo\n{{.Foo}}\nfour")
+}
+
+func TestHandlerDebug(t *testing.T) {
+	log.SetOutput(io.Discard)
+
+	recovery := New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(fmt.Errorf("render: %w", testDebugError{}))
+	}), WithPanicResponse("ignored", "text/plain"), WithDebug(true))
+	recorder := httptest.NewRecorder()
+	recovery.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, recorder.Code)
+	}
+	if v := recorder.Header().Get("Content-Type"); v != "text/html; charset=utf-8" {
+		t.Errorf("expected content type %q, got %q", "text/html; charset=utf-8", v)
+	}
+	body := recorder.Body.String()
+	for _, want := range []string{
+		"render: template &lt;failed&gt;",
+		"<tr><th>template</th><td>page</td></tr>",
+		"<h2>page.html</h2>",
+		`<span class="current"><i>3</i>{{.Foo}}</span>`,
+		"<span><i>4</i>four</span>",
+		"runtime/debug.Stack",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected body to contain %q, got %q", want, body)
+		}
+	}
+}
+
+func TestHandlerAbort(t *testing.T) {
+	var buf bytes.Buffer
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("expected panic %v, got %v", http.ErrAbortHandler, err)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("expected no log, got %q", buf.String())
+		}
+	}()
+
+	New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}), WithLogger(slog.New(slog.NewTextHandler(&buf, nil)))).ServeHTTP(httptest.NewRecorder(), req)
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Renderer writes data in a format of its content type.
+type Renderer struct {
+	// ContentType is the value for Content-Type header, and it is used as
+	// an offer in the content negotiation.
+	ContentType string
+	// Render writes data to the writer.
+	Render func(w io.Writer, r *http.Request, data any) error
+}
+
+// Renderers for common formats.
+var (
+	JSONRenderer = Renderer{
+		ContentType: "application/json; charset=utf-8",
+		Render: func(w io.Writer, _ *http.Request, data any) error {
+			return json.NewEncoder(w).Encode(data)
+		},
+	}
+	XMLRenderer = Renderer{
+		ContentType: "application/xml; charset=utf-8",
+		Render: func(w io.Writer, _ *http.Request, data any) error {
+			if _, err := io.WriteString(w, xml.Header); err != nil {
+				return err
+			}
+			return xml.NewEncoder(w).Encode(data)
+		},
+	}
+	TextRenderer = Renderer{
+		ContentType: "text/plain; charset=utf-8",
+		Render: func(w io.Writer, _ *http.Request, data any) error {
+			_, err := fmt.Fprintln(w, data)
+			return err
+		},
+	}
+)
+
+// TemplateRenderer returns a Renderer that executes a named template with
+// data as HTML. It can be used with templates.Templates.
+func TemplateRenderer(t interface {
+	Render(name string, data any) (string, error)
+}, name string) Renderer {
+	return Renderer{
+		ContentType: "text/html; charset=utf-8",
+		Render: func(w io.Writer, _ *http.Request, data any) error {
+			s, err := t.Render(name, data)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, s)
+			return err
+		},
+	}
+}
+
+// Responder writes responses with the Renderer that best matches the
+// request Accept header.
+type Responder struct {
+	// Renderers are ordered by the server preference, the first one is used
+	// if the request has no Accept header.
+	Renderers []Renderer
+	// NotAcceptableHandler is used when none of the renderers match the
+	// Accept header. If it is nil, the first renderer is used, as clients
+	// usually prefer any response to the Not Acceptable one.
+	NotAcceptableHandler http.Handler
+	// ErrorHandler will be used if there is an error from Renderer. If it is
+	// nil, a panic will occur.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Respond renders data with the negotiated Renderer and writes it with the
+// status code. Data is rendered before the response is written, so that
+// rendering errors can be handled by ErrorHandler.
+func (rs Responder) Respond(w http.ResponseWriter, r *http.Request, status int, data any) {
+	w.Header().Add("Vary", "Accept")
+
+	renderer, ok := rs.renderer(r)
+	if !ok {
+		if rs.NotAcceptableHandler != nil {
+			rs.NotAcceptableHandler.ServeHTTP(w, r)
+			return
+		}
+		if len(rs.Renderers) == 0 {
+			http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+			return
+		}
+		renderer = rs.Renderers[0]
+	}
+
+	var buf bytes.Buffer
+	if err := renderer.Render(&buf, r, data); err != nil {
+		if rs.ErrorHandler == nil {
+			panic(err)
+		}
+		rs.ErrorHandler(w, r, err)
+		return
+	}
+	if renderer.ContentType != "" {
+		w.Header().Set("Content-Type", renderer.ContentType)
+	}
+	if status > 0 {
+		w.WriteHeader(status)
+	}
+	_, _ = buf.WriteTo(w)
+}
+
+// Handler returns an http.Handler that responds with the status code and
+// data. It can be used for error pages with ResponseReplaceHandler or
+// HandleMethodsWithHandler.
+func (rs Responder) Handler(status int, data any) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rs.Respond(w, r, status, data)
+	})
+}
+
+func (rs Responder) renderer(r *http.Request) (Renderer, bool) {
+	offers := make([]string, 0, len(rs.Renderers))
+	for _, renderer := range rs.Renderers {
+		offers = append(offers, renderer.ContentType)
+	}
+	contentType := NegotiateContentType(r.Header.Get("Accept"), offers)
+	for _, renderer := range rs.Renderers {
+		if renderer.ContentType == contentType {
+			return renderer, true
+		}
+	}
+	return Renderer{}, false
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testTemplateRenderer struct{}
+
+func (testTemplateRenderer) Render(name string, data any) (string, error) {
+	if data == nil {
+		return "", errors.New("no data")
+	}
+	return "<p>" + name + ": " + data.(string) + "</p>", nil
+}
+
+func TestResponder(t *testing.T) {
+	responder := Responder{
+		Renderers: []Renderer{
+			TextRenderer,
+			TemplateRenderer(testTemplateRenderer{}, "message"),
+			JSONRenderer,
+		},
+	}
+
+	for _, tc := range []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{accept: "", contentType: "text/plain; charset=utf-8", body: "Not Found\n"},
+		{accept: "text/html", contentType: "text/html; charset=utf-8", body: "<p>message: Not Found</p>"},
+		{accept: "application/json", contentType: "application/json; charset=utf-8", body: "\"Not Found\"\n"},
+		{accept: "image/png", contentType: "text/plain; charset=utf-8", body: "Not Found\n"},
+	} {
+		h := ResponseReplaceHandler(http.NotFoundHandler(), map[int]http.Handler{
+			http.StatusNotFound: responder.Handler(http.StatusNotFound, "Not Found"),
+		})
+		r := httptest.NewRequest("GET", "/", nil)
+		if tc.accept != "" {
+			r.Header.Set("Accept", tc.accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%q: expected status code %d, got %d", tc.accept, http.StatusNotFound, w.Code)
+		}
+		if v := w.Header().Get("Content-Type"); v != tc.contentType {
+			t.Errorf("%q: expected content type %q, got %q", tc.accept, tc.contentType, v)
+		}
+		if v := w.Header().Get("Vary"); v != "Accept" {
+			t.Errorf("%q: expected Vary header %q, got %q", tc.accept, "Accept", v)
+		}
+		if v := w.Body.String(); v != tc.body {
+			t.Errorf("%q: expected body %q, got %q", tc.accept, tc.body, v)
+		}
+	}
+}
+
+func TestResponder_NotAcceptable(t *testing.T) {
+	var gotErr error
+	responder := Responder{
+		Renderers: []Renderer{TemplateRenderer(testTemplateRenderer{}, "message")},
+		NotAcceptableHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotAcceptable)
+		}),
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			gotErr = err
+			w.WriteHeader(http.StatusInternalServerError)
+		},
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	responder.Respond(w, r, http.StatusOK, "data")
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("expected status code %d, got %d", http.StatusNotAcceptable, w.Code)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	responder.Respond(w, r, http.StatusOK, nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	if gotErr == nil || gotErr.Error() != "no data" {
+		t.Errorf("expected error %q, got %v", "no data", gotErr)
+	}
+}
+
+func TestHandleMethodsWithHandler(t *testing.T) {
+	methods := map[string]http.Handler{
+		"GET": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	}
+	responder := Responder{Renderers: []Renderer{TextRenderer, JSONRenderer}}
+
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	HandleMethodsWithHandler(methods, responder.Handler(http.StatusMethodNotAllowed, map[string]any{"message": "Method Not Allowed", "code": 405}), w, r)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status code %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+	if v := w.Header().Get("Allow"); v != "GET" {
+		t.Errorf("expected Allow header %q, got %q", "GET", v)
+	}
+	b, _ := io.ReadAll(w.Body)
+	if v := string(b); v != `{"code":405,"message":"Method Not Allowed"}`+"\n" {
+		t.Errorf("unexpected body %q", v)
+	}
+}
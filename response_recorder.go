@@ -63,6 +63,13 @@ func (r *ResponseStatusRecorder) ResponseBodySize() int {
 	return r.size
 }
 
+// Unwrap returns the wrapped http.ResponseWriter, so that
+// http.ResponseController can access its methods, like setting deadlines or
+// enabling full duplex.
+func (r *ResponseStatusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func (r *ResponseStatusRecorder) Flush() {
 	f, ok := r.ResponseWriter.(http.Flusher)
 	if !ok {
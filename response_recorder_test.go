@@ -6,9 +6,11 @@
 package web_test
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"resenje.org/web"
 )
@@ -97,3 +99,36 @@ func TestResponseStatusRecorder_writeHeaderAfterWrite(t *testing.T) {
 		t.Errorf("git status %v, want %v", status, http.StatusOK)
 	}
 }
+
+type deadlineResponseWriter struct {
+	http.ResponseWriter
+	deadline time.Time
+}
+
+func (w *deadlineResponseWriter) SetWriteDeadline(deadline time.Time) error {
+	w.deadline = deadline
+	return nil
+}
+
+func TestResponseStatusRecorder_unwrap(t *testing.T) {
+	w := &deadlineResponseWriter{ResponseWriter: httptest.NewRecorder()}
+
+	rec := web.NewResponseStatusRecorder(w)
+
+	if got := rec.Unwrap(); got != w {
+		t.Errorf("expected unwrapped writer %v, got %v", w, got)
+	}
+
+	deadline := time.Now().Add(time.Minute)
+	if err := http.NewResponseController(rec).SetWriteDeadline(deadline); err != nil {
+		t.Fatal(err)
+	}
+	if !w.deadline.Equal(deadline) {
+		t.Errorf("expected deadline %v, got %v", deadline, w.deadline)
+	}
+
+	err := http.NewResponseController(web.NewResponseStatusRecorder(httptest.NewRecorder())).SetWriteDeadline(deadline)
+	if !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("expected error %v, got %v", http.ErrNotSupported, err)
+	}
+}
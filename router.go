@@ -0,0 +1,511 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Router is an HTTP request multiplexer that matches requests by host, path
+// and method.
+//
+// Patterns have the form "[METHOD ][HOST]/[PATH]", for example
+// "/users/{id}", "GET api.example.com/users/{id}" or
+// "*.example.com/files/{path...}". Hosts can be exact or wildcards that match
+// any subdomain. Path segments in curly braces are parameters that match a
+// single segment and a parameter with "..." suffix as the last segment
+// matches the rest of the path. Static segments have a precedence over
+// parameters, and parameters over the rest of the path. Routes with exact
+// hosts have a precedence over the ones with wildcard hosts, which have a
+// precedence over routes without hosts.
+//
+// Routes with methods respond automatically to HEAD requests if GET is
+// handled, to OPTIONS requests with the Allow header and with Method Not
+// Allowed to other methods. Routes without methods handle all methods.
+//
+// Routes must be registered before the Router serves requests.
+type Router struct {
+	// NotFoundHandler is used when no route matches the request. Default is
+	// http.NotFoundHandler.
+	NotFoundHandler http.Handler
+	// MethodNotAllowedHandler is used when the route does not handle the
+	// request method. The Allow header is set before it is called. Default
+	// writes the status text.
+	MethodNotAllowedHandler http.Handler
+
+	root       *Router
+	routes     *routerTable
+	host       string
+	path       string
+	middleware []func(http.Handler) http.Handler
+}
+
+// NewRouter creates a new Router.
+func NewRouter() *Router {
+	r := &Router{
+		routes: &routerTable{
+			hosts: make(map[string]*routeNode),
+			any:   new(routeNode),
+			names: make(map[string]*Route),
+		},
+	}
+	r.root = r
+	return r
+}
+
+// Group returns a Router that registers routes on the same Router with the
+// prefix pattern and middleware. The prefix has the same form as patterns
+// without the method, for example "/admin" or "api.example.com/v1".
+// Middleware is applied with ChainHandlers, after the middleware of the
+// parent group.
+func (rt *Router) Group(prefix string, middleware ...func(http.Handler) http.Handler) *Router {
+	host, path := splitRoutePattern(prefix)
+	if host != "" && rt.host != "" {
+		panic(fmt.Sprintf("web: router group %q: host is already set to %q", prefix, rt.host))
+	}
+	if host == "" {
+		host = rt.host
+	}
+	return &Router{
+		root:       rt.root,
+		routes:     rt.routes,
+		host:       host,
+		path:       strings.TrimSuffix(rt.path, "/") + strings.TrimSuffix(path, "/"),
+		middleware: append(append([]func(http.Handler) http.Handler(nil), rt.middleware...), middleware...),
+	}
+}
+
+// Handle registers the handler for the pattern. If the pattern has a method,
+// the handler handles only that method. It panics if a handler for the same
+// pattern and method is already registered, or if the same path is already
+// registered with different parameter names.
+func (rt *Router) Handle(pattern string, h http.Handler) *Route {
+	method, rest, ok := strings.Cut(pattern, " ")
+	if !ok || strings.HasPrefix(pattern, "/") {
+		return rt.handle(pattern, "", h)
+	}
+	return rt.handle(strings.TrimSpace(rest), method, h)
+}
+
+// HandleFunc registers the handler function for the pattern.
+func (rt *Router) HandleFunc(pattern string, h func(w http.ResponseWriter, r *http.Request)) *Route {
+	return rt.Handle(pattern, http.HandlerFunc(h))
+}
+
+// HandleMethods registers handlers for HTTP methods for the pattern, which
+// must not have a method.
+func (rt *Router) HandleMethods(pattern string, methods map[string]http.Handler) *Route {
+	keys := make([]string, 0, len(methods))
+	for method := range methods {
+		keys = append(keys, method)
+	}
+	sort.Strings(keys)
+	var route *Route
+	for _, method := range keys {
+		route = rt.handle(pattern, method, methods[method])
+	}
+	return route
+}
+
+// URL returns the path of the named route with parameters provided as
+// name and value pairs, for example URL("user", "id", 42). Values are
+// formatted with fmt.Sprint. It can be used as a template function.
+func (rt *Router) URL(name string, params ...any) (string, error) {
+	route, ok := rt.routes.names[name]
+	if !ok {
+		return "", fmt.Errorf("web: unknown route %q", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("web: route %q: odd number of parameters", name)
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[fmt.Sprint(params[i])] = fmt.Sprint(params[i+1])
+	}
+	var b strings.Builder
+	for _, s := range route.segments {
+		b.WriteString("/")
+		name, catchAll, isParam := parseRouteParam(s)
+		if !isParam {
+			b.WriteString(s)
+			continue
+		}
+		v, ok := values[name]
+		if !ok {
+			return "", fmt.Errorf("web: route %q: missing parameter %q", route.name, name)
+		}
+		if !catchAll {
+			b.WriteString(url.PathEscape(v))
+			continue
+		}
+		parts := strings.Split(v, "/")
+		for i, p := range parts {
+			parts[i] = url.PathEscape(p)
+		}
+		b.WriteString(strings.Join(parts, "/"))
+	}
+	return b.String(), nil
+}
+
+// ServeHTTP dispatches the request to the handler of the matched route.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	root := rt.root
+	route, values := root.routes.match(r)
+	if route == nil {
+		if root.NotFoundHandler != nil {
+			root.NotFoundHandler.ServeHTTP(w, r)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	info, ok := r.Context().Value(routeContextKey{}).(*routeInfo)
+	if !ok {
+		info = new(routeInfo)
+		r = r.WithContext(context.WithValue(r.Context(), routeContextKey{}, info))
+	}
+	info.name = route.name
+	info.pattern = route.pattern
+	info.params = make(map[string]string, len(values))
+	for i, v := range values {
+		info.params[route.params[i]] = v
+	}
+
+	if h, ok := route.handler(r.Method); ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Allow", strings.Join(route.allow(), ", "))
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if root.MethodNotAllowedHandler != nil {
+		root.MethodNotAllowedHandler.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+func (rt *Router) handle(pattern, method string, h http.Handler) *Route {
+	if h == nil {
+		panic(fmt.Sprintf("web: router pattern %q: nil handler", pattern))
+	}
+	host, path := splitRoutePattern(pattern)
+	if !strings.HasPrefix(path, "/") {
+		panic(fmt.Sprintf("web: router pattern %q: path must start with a slash", pattern))
+	}
+	if host != "" && rt.host != "" {
+		panic(fmt.Sprintf("web: router pattern %q: host is already set to %q", pattern, rt.host))
+	}
+	if host == "" {
+		host = rt.host
+	}
+	path = rt.path + path
+	if len(rt.middleware) > 0 {
+		h = ChainHandlers(append(append([]func(http.Handler) http.Handler(nil), rt.middleware...), FinalHandler(h))...)
+	}
+	return rt.routes.add(strings.ToLower(host), path, strings.ToUpper(method), h)
+}
+
+// Route is a registered route.
+type Route struct {
+	name     string
+	pattern  string
+	segments []string
+	params   []string
+	methods  map[string]http.Handler
+	all      http.Handler
+	names    map[string]*Route
+}
+
+// Name sets the name of the route that is used to build its URL with
+// Router.URL method. It panics if the name is already used.
+func (r *Route) Name(name string) *Route {
+	if other, ok := r.names[name]; ok && other != r {
+		panic(fmt.Sprintf("web: route name %q is already used for %q", name, other.pattern))
+	}
+	if r.name != "" {
+		delete(r.names, r.name)
+	}
+	r.name = name
+	r.names[name] = r
+	return r
+}
+
+// Pattern returns the route pattern without the method.
+func (r *Route) Pattern() string {
+	return r.pattern
+}
+
+func (r *Route) handler(method string) (http.Handler, bool) {
+	if r.all != nil {
+		return r.all, true
+	}
+	if h, ok := r.methods[method]; ok {
+		return h, true
+	}
+	if method == http.MethodHead {
+		if h, ok := r.methods[http.MethodGet]; ok {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+func (r *Route) allow() []string {
+	allow := make([]string, 0, len(r.methods)+2)
+	for method := range r.methods {
+		allow = append(allow, method)
+	}
+	if _, ok := r.methods[http.MethodGet]; ok {
+		if _, ok := r.methods[http.MethodHead]; !ok {
+			allow = append(allow, http.MethodHead)
+		}
+	}
+	if _, ok := r.methods[http.MethodOptions]; !ok {
+		allow = append(allow, http.MethodOptions)
+	}
+	sort.Strings(allow)
+	return allow
+}
+
+type routerTable struct {
+	hosts     map[string]*routeNode
+	wildcards []wildcardHost
+	any       *routeNode
+	names     map[string]*Route
+}
+
+type wildcardHost struct {
+	suffix string
+	node   *routeNode
+}
+
+func (t *routerTable) add(host, path, method string, h http.Handler) *Route {
+	var root *routeNode
+	switch {
+	case host == "":
+		root = t.any
+	case strings.HasPrefix(host, "*."):
+		suffix := host[1:]
+		for _, w := range t.wildcards {
+			if w.suffix == suffix {
+				root = w.node
+				break
+			}
+		}
+		if root == nil {
+			root = new(routeNode)
+			t.wildcards = append(t.wildcards, wildcardHost{suffix: suffix, node: root})
+			// More specific wildcards are matched first.
+			sort.SliceStable(t.wildcards, func(i, j int) bool {
+				return len(t.wildcards[i].suffix) > len(t.wildcards[j].suffix)
+			})
+		}
+	default:
+		root = t.hosts[host]
+		if root == nil {
+			root = new(routeNode)
+			t.hosts[host] = root
+		}
+	}
+
+	segments := strings.Split(path[1:], "/")
+	n := root
+	var params []string
+	for i, s := range segments {
+		name, catchAll, isParam := parseRouteParam(s)
+		switch {
+		case !isParam:
+			if n.static == nil {
+				n.static = make(map[string]*routeNode)
+			}
+			child := n.static[s]
+			if child == nil {
+				child = new(routeNode)
+				n.static[s] = child
+			}
+			n = child
+		case catchAll:
+			if i != len(segments)-1 {
+				panic(fmt.Sprintf("web: router pattern %s%s: %s must be the last segment", host, path, s))
+			}
+			if n.catchAll == nil {
+				n.catchAll = new(routeNode)
+			}
+			n = n.catchAll
+			params = append(params, name)
+		default:
+			if n.param == nil {
+				n.param = new(routeNode)
+			}
+			n = n.param
+			params = append(params, name)
+		}
+	}
+
+	if n.route == nil {
+		n.route = &Route{
+			pattern:  host + path,
+			segments: segments,
+			params:   params,
+			methods:  make(map[string]http.Handler),
+			names:    t.names,
+		}
+	}
+	route := n.route
+	if !slices.Equal(route.params, params) {
+		panic(fmt.Sprintf("web: router pattern %s %s parameter names conflict with %s", method, host+path, route.pattern))
+	}
+	conflict := route.all != nil
+	if method == "" {
+		conflict = conflict || len(route.methods) > 0
+	} else {
+		_, exists := route.methods[method]
+		conflict = conflict || exists
+	}
+	if conflict {
+		panic(fmt.Sprintf("web: router pattern %s %s conflicts with %s", method, host+path, route.pattern))
+	}
+	if method == "" {
+		route.all = h
+	} else {
+		route.methods[method] = h
+	}
+	return route
+}
+
+func (t *routerTable) match(r *http.Request) (*Route, []string) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	segments := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	for i, s := range segments {
+		if v, err := url.PathUnescape(s); err == nil {
+			segments[i] = v
+		}
+	}
+
+	if n, ok := t.hosts[host]; ok {
+		if route, values := n.match(segments, nil); route != nil {
+			return route, values
+		}
+	}
+	for _, w := range t.wildcards {
+		if strings.HasSuffix(host, w.suffix) && len(host) > len(w.suffix) {
+			if route, values := w.node.match(segments, nil); route != nil {
+				return route, values
+			}
+		}
+	}
+	return t.any.match(segments, nil)
+}
+
+type routeNode struct {
+	static   map[string]*routeNode
+	param    *routeNode
+	catchAll *routeNode
+	route    *Route
+}
+
+func (n *routeNode) match(segments, values []string) (*Route, []string) {
+	if len(segments) == 0 {
+		if n.route != nil {
+			return n.route, values
+		}
+		return nil, nil
+	}
+	s := segments[0]
+	if child, ok := n.static[s]; ok {
+		if route, v := child.match(segments[1:], values); route != nil {
+			return route, v
+		}
+	}
+	if n.param != nil && s != "" {
+		if route, v := n.param.match(segments[1:], append(values[:len(values):len(values)], s)); route != nil {
+			return route, v
+		}
+	}
+	if n.catchAll != nil && n.catchAll.route != nil {
+		return n.catchAll.route, append(values[:len(values):len(values)], strings.Join(segments, "/"))
+	}
+	return nil, nil
+}
+
+func splitRoutePattern(pattern string) (host, path string) {
+	i := strings.Index(pattern, "/")
+	if i < 0 {
+		return pattern, ""
+	}
+	return pattern[:i], pattern[i:]
+}
+
+func parseRouteParam(segment string) (name string, catchAll, ok bool) {
+	if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+		return "", false, false
+	}
+	name = segment[1 : len(segment)-1]
+	name, catchAll = strings.CutSuffix(name, "...")
+	return name, catchAll, true
+}
+
+type routeContextKey struct{}
+
+type routeInfo struct {
+	name    string
+	pattern string
+	params  map[string]string
+}
+
+// NewRouteContext returns a context in which Router stores the information
+// about the matched route. Middleware that is executed before the Router,
+// such as access logging or metrics, can use it to get the route pattern
+// with RoutePattern function after the request is served.
+func NewRouteContext(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(routeContextKey{}).(*routeInfo); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, routeContextKey{}, new(routeInfo))
+}
+
+// RoutePattern returns the pattern of the route matched by Router, for
+// example "/users/{id}". It is suitable as a low cardinality label for
+// metrics and logs.
+func RoutePattern(r *http.Request) string {
+	if info, ok := r.Context().Value(routeContextKey{}).(*routeInfo); ok {
+		return info.pattern
+	}
+	return ""
+}
+
+// RouteName returns the name of the route matched by Router.
+func RouteName(r *http.Request) string {
+	if info, ok := r.Context().Value(routeContextKey{}).(*routeInfo); ok {
+		return info.name
+	}
+	return ""
+}
+
+// PathParam returns the value of the path parameter of the route matched
+// by Router.
+func PathParam(r *http.Request, name string) string {
+	if info, ok := r.Context().Value(routeContextKey{}).(*routeInfo); ok {
+		return info.params[name]
+	}
+	return ""
+}
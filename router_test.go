@@ -0,0 +1,169 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func routerTestHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s %s id=%s path=%s", name, RouteName(r), RoutePattern(r), PathParam(r, "id"), PathParam(r, "path"))
+	})
+}
+
+func TestRouter(t *testing.T) {
+	router := NewRouter()
+	router.Handle("GET /", routerTestHandler("index"))
+	router.Handle("GET /users/{id}", routerTestHandler("user")).Name("user")
+	router.Handle("POST /users/{id}", routerTestHandler("update user"))
+	router.Handle("/users/me", routerTestHandler("me"))
+	router.Handle("/files/{path...}", routerTestHandler("files")).Name("files")
+	router.Handle("GET api.example.com/users/{id}", routerTestHandler("api user"))
+	router.Handle("GET *.example.com/users/{id}", routerTestHandler("tenant user"))
+
+	for _, tc := range []struct {
+		method string
+		url    string
+		status int
+		body   string
+		allow  string
+	}{
+		{method: "GET", url: "/", status: http.StatusOK, body: "index  / id= path="},
+		{method: "GET", url: "/users/42", status: http.StatusOK, body: "user user /users/{id} id=42 path="},
+		{method: "HEAD", url: "/users/42", status: http.StatusOK, body: "user user /users/{id} id=42 path="},
+		{method: "POST", url: "/users/a%2Fb", status: http.StatusOK, body: "update user user /users/{id} id=a/b path="},
+		{method: "DELETE", url: "/users/me", status: http.StatusOK, body: "me  /users/me id= path="},
+		{method: "GET", url: "/files/a/b.txt", status: http.StatusOK, body: "files files /files/{path...} id= path=a/b.txt"},
+		{method: "GET", url: "/files/", status: http.StatusOK, body: "files files /files/{path...} id= path="},
+		{method: "GET", url: "http://api.example.com:8080/users/1", status: http.StatusOK, body: "api user  api.example.com/users/{id} id=1 path="},
+		{method: "GET", url: "http://a.b.example.com/users/2", status: http.StatusOK, body: "tenant user  *.example.com/users/{id} id=2 path="},
+		{method: "GET", url: "http://example.com/users/3", status: http.StatusOK, body: "user user /users/{id} id=3 path="},
+		{method: "DELETE", url: "/users/42", status: http.StatusMethodNotAllowed, body: "Method Not Allowed\n", allow: "GET, HEAD, OPTIONS, POST"},
+		{method: "OPTIONS", url: "/users/42", status: http.StatusNoContent, allow: "GET, HEAD, OPTIONS, POST"},
+		{method: "GET", url: "/users", status: http.StatusNotFound, body: "404 page not found\n"},
+		{method: "GET", url: "/users/", status: http.StatusNotFound, body: "404 page not found\n"},
+		{method: "GET", url: "/files", status: http.StatusNotFound, body: "404 page not found\n"},
+	} {
+		t.Run(tc.method+" "+tc.url, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.url, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			if w.Code != tc.status {
+				t.Errorf("expected status code %d, got %d", tc.status, w.Code)
+			}
+			if v := w.Body.String(); v != tc.body {
+				t.Errorf("expected body %q, got %q", tc.body, v)
+			}
+			if v := w.Header().Get("Allow"); v != tc.allow {
+				t.Errorf("expected Allow header %q, got %q", tc.allow, v)
+			}
+		})
+	}
+}
+
+func TestRouter_Group(t *testing.T) {
+	router := NewRouter()
+	middleware := func(name string) func(http.Handler) http.Handler {
+		return func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Middleware", name)
+				h.ServeHTTP(w, r)
+			})
+		}
+	}
+	admin := router.Group("/admin", middleware("admin"))
+	users := admin.Group("/users/", middleware("users"))
+	users.Handle("GET /{id}", routerTestHandler("admin user")).Name("admin user")
+
+	r := httptest.NewRequest("GET", "/admin/users/5", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	want := "admin user admin user /admin/users/{id} id=5 path="
+	if v := w.Body.String(); v != want {
+		t.Errorf("expected body %q, got %q", want, v)
+	}
+	if v := w.Header().Values("X-Middleware"); fmt.Sprint(v) != "[admin users]" {
+		t.Errorf("expected middleware %v, got %v", "[admin users]", v)
+	}
+}
+
+func TestRouter_URL(t *testing.T) {
+	router := NewRouter()
+	router.Handle("GET /users/{id}", routerTestHandler("user")).Name("user")
+	router.Handle("/files/{path...}", routerTestHandler("files")).Name("files")
+
+	for _, tc := range []struct {
+		name   string
+		params []any
+		url    string
+		err    string
+	}{
+		{name: "user", params: []any{"id", 42}, url: "/users/42"},
+		{name: "user", params: []any{"id", "a b/c"}, url: "/users/a%20b%2Fc"},
+		{name: "files", params: []any{"path", "a b/c.txt"}, url: "/files/a%20b/c.txt"},
+		{name: "user", err: `web: route "user": missing parameter "id"`},
+		{name: "user", params: []any{"id"}, err: `web: route "user": odd number of parameters`},
+		{name: "unknown", err: `web: unknown route "unknown"`},
+	} {
+		url, err := router.URL(tc.name, tc.params...)
+		if err != nil {
+			if err.Error() != tc.err {
+				t.Errorf("expected error %q, got %q", tc.err, err)
+			}
+			continue
+		}
+		if tc.err != "" {
+			t.Errorf("expected error %q, got none", tc.err)
+		}
+		if url != tc.url {
+			t.Errorf("expected url %q, got %q", tc.url, url)
+		}
+	}
+}
+
+func TestRouter_conflict(t *testing.T) {
+	router := NewRouter()
+	router.Handle("GET /users/{id}", routerTestHandler("user"))
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	router.Handle("GET /users/{name}", routerTestHandler("user"))
+}
+
+func TestRouter_conflictParams(t *testing.T) {
+	router := NewRouter()
+	router.Handle("GET /users/{id}", routerTestHandler("user"))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic")
+			}
+		}()
+		router.Handle("POST /users/{uid}", routerTestHandler("update"))
+	}()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/42", nil))
+	if want := "user  /users/{id} id=42 path="; w.Body.String() != want {
+		t.Errorf("expected body %q, got %q", want, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/42", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// WWWRedirect defines how the www counterparts of exact domains in Handlers
+// are handled.
+type WWWRedirect int
+
+// WWWRedirect values.
+const (
+	// WWWRedirectAuto redirects the www counterpart of every exact domain,
+	// "www.example.com" for "example.com" and vice versa, to the domain, if
+	// the counterpart has no handler.
+	WWWRedirectAuto WWWRedirect = iota
+	// WWWRedirectDisabled does not handle www counterparts.
+	WWWRedirectDisabled
+)
+
+// hostRouter dispatches requests by the host to handlers from Handlers.
+//
+// Domains in Handlers can be exact, like "example.com", wildcard patterns
+// where "*" matches a single label, like "*.customers.example.com", or
+// suffix patterns that start with a dot, like ".example.com", that match the
+// domain and all of its subdomains. Exact domains have the precedence over
+// wildcards, which have the precedence over suffixes. Wildcard patterns with
+// more literal labels, and then with more labels, are matched first, and
+// longer suffixes are matched before shorter ones.
+type hostRouter struct {
+	exact          map[string]http.Handler
+	patterns       []hostPattern
+	defaultHandler http.Handler
+}
+
+type hostPattern struct {
+	pattern string
+	labels  []string
+	suffix  bool
+	handler http.Handler
+}
+
+func newHostRouter(handlers Handlers, defaultHandler http.Handler) *hostRouter {
+	r := &hostRouter{
+		exact:          make(map[string]http.Handler),
+		defaultHandler: defaultHandler,
+	}
+	for domain, h := range handlers {
+		domain = strings.ToLower(domain)
+		switch {
+		case domain == "":
+		case strings.HasPrefix(domain, "."):
+			r.patterns = append(r.patterns, hostPattern{
+				pattern: domain,
+				labels:  strings.Split(domain[1:], "."),
+				suffix:  true,
+				handler: h,
+			})
+		case strings.Contains(domain, "*"):
+			r.patterns = append(r.patterns, hostPattern{
+				pattern: domain,
+				labels:  strings.Split(domain, "."),
+				handler: h,
+			})
+		default:
+			r.exact[domain] = h
+		}
+	}
+	sort.Slice(r.patterns, func(i, j int) bool {
+		a, b := r.patterns[i], r.patterns[j]
+		if a.suffix != b.suffix {
+			return !a.suffix
+		}
+		if la, lb := a.literals(), b.literals(); la != lb {
+			return la > lb
+		}
+		if len(a.labels) != len(b.labels) {
+			return len(a.labels) > len(b.labels)
+		}
+		return a.pattern < b.pattern
+	})
+	return r
+}
+
+func (p hostPattern) literals() (n int) {
+	for _, l := range p.labels {
+		if l != "*" {
+			n++
+		}
+	}
+	return n
+}
+
+// match returns labels of the host that are matched by wildcards or that are
+// prefixed to the suffix.
+func (p hostPattern) match(host string) (labels []string, ok bool) {
+	hostLabels := strings.Split(host, ".")
+	if p.suffix {
+		if len(hostLabels) < len(p.labels) {
+			return nil, false
+		}
+		prefix := len(hostLabels) - len(p.labels)
+		for i, l := range p.labels {
+			if hostLabels[prefix+i] != l {
+				return nil, false
+			}
+		}
+		return hostLabels[:prefix], true
+	}
+	if len(hostLabels) != len(p.labels) {
+		return nil, false
+	}
+	for i, l := range p.labels {
+		switch {
+		case l == "*":
+			if hostLabels[i] == "" {
+				return nil, false
+			}
+			labels = append(labels, hostLabels[i])
+		case l != hostLabels[i]:
+			return nil, false
+		}
+	}
+	return labels, true
+}
+
+func (r *hostRouter) match(host string) (h http.Handler, pattern string, labels []string, ok bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if h, ok := r.exact[host]; ok {
+		return h, host, nil, true
+	}
+	for _, p := range r.patterns {
+		if labels, ok := p.match(host); ok {
+			return p.handler, p.pattern, labels, true
+		}
+	}
+	return nil, "", nil, false
+}
+
+func (r *hostRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host, _, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		host = req.Host
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	h, pattern, labels, ok := r.match(host)
+	if !ok {
+		r.defaultHandler.ServeHTTP(w, req)
+		return
+	}
+	if pattern != host {
+		req = req.WithContext(context.WithValue(req.Context(), hostMatchContextKey{}, hostMatch{
+			pattern: pattern,
+			labels:  labels,
+		}))
+	}
+	h.ServeHTTP(w, req)
+}
+
+// hostPolicy returns the ACME host policy that allows exact domains. Hosts
+// that are not exact domains, including the ones that match patterns, are
+// allowed only by the allow function, so that certificates are not requested
+// for arbitrary subdomains.
+func (r *hostRouter) hostPolicy(allow func(ctx context.Context, host string) error) func(ctx context.Context, host string) error {
+	return func(ctx context.Context, host string) error {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		if _, ok := r.exact[host]; ok {
+			return nil
+		}
+		if allow != nil {
+			return allow(ctx, host)
+		}
+		return errors.New("acme/autocert: host not configured")
+	}
+}
+
+type hostMatchContextKey struct{}
+
+type hostMatch struct {
+	pattern string
+	labels  []string
+}
+
+// HostPattern returns the wildcard or suffix domain pattern from Handlers that
+// matched the request host. It returns an empty string for exact domains.
+func HostPattern(ctx context.Context) string {
+	m, _ := ctx.Value(hostMatchContextKey{}).(hostMatch)
+	return m.pattern
+}
+
+// HostLabels returns the host labels that are matched by wildcards of the
+// domain pattern, or the labels before the suffix for suffix patterns. For
+// the host "acme.customers.example.com" and the pattern
+// "*.customers.example.com", it returns ["acme"].
+func HostLabels(ctx context.Context) []string {
+	m, _ := ctx.Value(hostMatchContextKey{}).(hostMatch)
+	return m.labels
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHostRouter(t *testing.T) {
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %q %v", name, HostPattern(r.Context()), HostLabels(r.Context()))
+		})
+	}
+	r := newHostRouter(Handlers{
+		"example.com":               handler("exact"),
+		"api.customers.example.com": handler("exact api"),
+		"*.customers.example.com":   handler("wildcard"),
+		"*.*.example.com":           handler("wildcards"),
+		".example.com":              handler("suffix"),
+		".eu.example.com":           handler("longer suffix"),
+	}, handler("default"))
+
+	for _, tc := range []struct {
+		host string
+		want string
+	}{
+		{host: "example.com", want: `exact "" []`},
+		{host: "Example.COM.", want: `exact "" []`},
+		{host: "example.com:8080", want: `exact "" []`},
+		{host: "api.customers.example.com", want: `exact api "" []`},
+		{host: "acme.customers.example.com", want: `wildcard "*.customers.example.com" [acme]`},
+		{host: "a.b.example.com", want: `wildcards "*.*.example.com" [a b]`},
+		{host: "www.example.com", want: `suffix ".example.com" [www]`},
+		{host: "a.b.c.example.com", want: `suffix ".example.com" [a b c]`},
+		{host: "a.shop.eu.example.com", want: `longer suffix ".eu.example.com" [a shop]`},
+		{host: "eu.example.com", want: `longer suffix ".eu.example.com" []`},
+		{host: "example.org", want: `default "" []`},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = tc.host
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if got := rec.Body.String(); got != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.host, tc.want, got)
+		}
+	}
+}
+
+func TestHostRouterHostPolicy(t *testing.T) {
+	r := newHostRouter(Handlers{
+		"example.com":             http.NotFoundHandler(),
+		"*.customers.example.com": http.NotFoundHandler(),
+		".example.net":            http.NotFoundHandler(),
+	}, http.NotFoundHandler())
+
+	errNotAllowed := errors.New("not allowed")
+	allow := func(_ context.Context, host string) error {
+		if host == "acme.customers.example.com" || host == "dynamic.example.org" {
+			return nil
+		}
+		return errNotAllowed
+	}
+
+	for _, tc := range []struct {
+		host    string
+		allow   func(ctx context.Context, host string) error
+		want    bool
+		wantErr error
+	}{
+		{host: "example.com", want: true},
+		{host: "EXAMPLE.com.", want: true},
+		{host: "acme.customers.example.com", want: false},
+		{host: "www.example.net", want: false},
+		{host: "example.org", want: false},
+		{host: "example.com", allow: allow, want: true},
+		{host: "Acme.Customers.Example.com.", allow: allow, want: true},
+		{host: "other.customers.example.com", allow: allow, want: false, wantErr: errNotAllowed},
+		{host: "www.example.net", allow: allow, want: false, wantErr: errNotAllowed},
+		{host: "dynamic.example.org", allow: allow, want: true},
+	} {
+		err := r.hostPolicy(tc.allow)(context.Background(), tc.host)
+		if got := err == nil; got != tc.want {
+			t.Errorf("%s: expected allowed %v, got error %v", tc.host, tc.want, err)
+		}
+		if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+			t.Errorf("%s: expected error %v, got %v", tc.host, tc.wantErr, err)
+		}
+		if err != nil && tc.wantErr == nil && !strings.Contains(err.Error(), "host not configured") {
+			t.Errorf("%s: unexpected error %v", tc.host, err)
+		}
+	}
+}
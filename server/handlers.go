@@ -87,6 +87,36 @@ func (s *Server) statusHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "%s version %s, uptime %s", s.name, s.Version(), time.Since(s.startTime))
 }
 
+// middlewareResponse is a response of a middleware API handler.
+type middlewareResponse struct {
+	Name       string   `json:"name"`
+	Middleware []string `json:"middleware"`
+}
+
+func (s *Server) middlewareAPIHandler(w http.ResponseWriter, r *http.Request) {
+	s.chainsMu.Lock()
+	defer s.chainsMu.Unlock()
+
+	response := make([]middlewareResponse, 0, len(s.chains))
+	for _, c := range s.chains {
+		response = append(response, middlewareResponse{
+			Name:       c.name,
+			Middleware: c.chain.Names(),
+		})
+	}
+	jsonhttp.OK(w, response)
+}
+
+func (s *Server) middlewareHandler(w http.ResponseWriter, r *http.Request) {
+	s.chainsMu.Lock()
+	defer s.chainsMu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, c := range s.chains {
+		fmt.Fprintf(w, "%s: %s\n", c.name, c.chain)
+	}
+}
+
 // Recovery handler for JSON API routers.
 func (s *Server) jsonRecoveryHandler(h http.Handler) http.Handler {
 	return recovery.New(h,
@@ -0,0 +1,71 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"resenje.org/web"
+)
+
+func newMiddlewareTestServer() *Server {
+	m := func(h http.Handler) http.Handler { return h }
+	s := &Server{}
+	s.addChain("HTTP", web.NewChain().
+		Append("recovery", m).
+		When(func(r *http.Request) bool { return false }, "auth", m))
+	s.addChain("instrumentation", web.NewChain().Append("compress", m))
+	s.addChain("empty", web.NewChain())
+	return s
+}
+
+func TestServer_middlewareHandler(t *testing.T) {
+	s := newMiddlewareTestServer()
+
+	w := httptest.NewRecorder()
+	s.middlewareHandler(w, httptest.NewRequest(http.MethodGet, "/middleware", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if got, want := w.Header().Get("Content-Type"), "text/plain; charset=utf-8"; got != want {
+		t.Errorf("expected content type %q, got %q", want, got)
+	}
+	want := "HTTP: recovery -> auth (conditional)\ninstrumentation: compress\nempty: \n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("expected body %q, got %q", want, got)
+	}
+}
+
+func TestServer_middlewareAPIHandler(t *testing.T) {
+	s := newMiddlewareTestServer()
+
+	w := httptest.NewRecorder()
+	s.middlewareAPIHandler(w, httptest.NewRequest(http.MethodGet, "/api/middleware", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if got, want := w.Header().Get("Content-Type"), "application/json; charset=utf-8"; got != want {
+		t.Errorf("expected content type %q, got %q", want, got)
+	}
+	var got []middlewareResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []middlewareResponse{
+		{Name: "HTTP", Middleware: []string{"recovery", "auth (conditional)"}},
+		{Name: "instrumentation", Middleware: []string{"compress"}},
+		{Name: "empty", Middleware: []string{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
@@ -28,14 +28,15 @@ func newInstrumentationRouter(s *Server, setupFunc func(base, api *http.ServeMux
 	// Instrumentation router
 	//
 	instrumentationRouter := http.NewServeMux()
-	baseRouter.Handle("/", web.ChainHandlers(
-		handlers.CompressHandler,
-		s.textRecoveryHandler,
-		web.NoCacheHeadersHandler,
-		web.FinalHandler(instrumentationRouter),
-	))
+	instrumentationChain := web.NewChain().
+		Append("compress", handlers.CompressHandler).
+		Append("recovery", s.textRecoveryHandler).
+		Append("no cache headers", web.NoCacheHeadersHandler)
+	s.addChain("instrumentation", instrumentationChain)
+	baseRouter.Handle("/", instrumentationChain.Then(instrumentationRouter))
 	instrumentationRouter.Handle("/", http.HandlerFunc(textNotFoundHandler))
 	instrumentationRouter.Handle("/status", http.HandlerFunc(s.statusHandler))
+	instrumentationRouter.Handle("/middleware", http.HandlerFunc(s.middlewareHandler))
 	instrumentationRouter.Handle("/data", datadump.Handler(s.dataDumpServices, s.name+"_"+s.Version(), s.logger, true))
 
 	instrumentationRouter.Handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
@@ -50,16 +51,17 @@ func newInstrumentationRouter(s *Server, setupFunc func(base, api *http.ServeMux
 	// Instrumentation API router
 	//
 	instrumentationAPIRouter := http.NewServeMux()
-	baseRouter.Handle("/api/", web.ChainHandlers(
-		handlers.CompressHandler,
-		s.jsonRecoveryHandler,
-		web.NoCacheHeadersHandler,
-		web.FinalHandler(instrumentationAPIRouter),
-	))
+	instrumentationAPIChain := web.NewChain().
+		Append("compress", handlers.CompressHandler).
+		Append("recovery", s.jsonRecoveryHandler).
+		Append("no cache headers", web.NoCacheHeadersHandler)
+	s.addChain("instrumentation API", instrumentationAPIChain)
+	baseRouter.Handle("/api/", instrumentationAPIChain.Then(instrumentationAPIRouter))
 	instrumentationAPIRouter.Handle("/api/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		jsonhttp.NotFound(w, nil)
 	}))
 	instrumentationAPIRouter.Handle("/api/status", http.HandlerFunc(s.statusAPIHandler))
+	instrumentationAPIRouter.Handle("/api/middleware", http.HandlerFunc(s.middlewareAPIHandler))
 	if s.maintenanceService != nil {
 		instrumentationAPIRouter.Handle("/api/maintenance", jsonMethodHandler{
 			"GET":    http.HandlerFunc(s.maintenanceService.StatusHandler),
@@ -16,6 +16,7 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -23,6 +24,7 @@ import (
 	"golang.org/x/crypto/acme/autocert"
 	"resenje.org/email"
 	"resenje.org/recovery"
+	"resenje.org/web"
 	"resenje.org/web/maintenance"
 	"resenje.org/web/servers"
 	httpServer "resenje.org/web/servers/http"
@@ -54,6 +56,14 @@ type Server struct {
 	startTime       time.Time
 	servers         *servers.Servers
 	metricsRegistry *prometheus.Registry
+
+	chainsMu sync.Mutex
+	chains   []namedChain
+}
+
+type namedChain struct {
+	name  string
+	chain web.Chain
 }
 
 // New initializes new server with provided options.
@@ -151,6 +161,18 @@ type HTTPOptions struct {
 	IdleTimeout  time.Duration
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+
+	// Chain is the middleware that wraps all handlers. Its middleware
+	// names are shown on the instrumentation router.
+	Chain web.Chain
+	// WWWRedirect defines how www counterparts of exact domains are
+	// handled. Default is WWWRedirectAuto.
+	WWWRedirect WWWRedirect
+	// ACMEHostPolicy decides if the ACME certificate can be obtained for
+	// hosts that are not exact domains in Handlers, which allows serving
+	// dynamic domains and hosts that match domain patterns. If it is nil,
+	// certificates are obtained only for exact domains.
+	ACMEHostPolicy func(ctx context.Context, host string) error
 }
 
 // SetHandler sets an HTTP handler to serve specific domains.
@@ -161,7 +183,12 @@ func (o *HTTPOptions) SetHandler(h http.Handler, domains ...string) {
 	o.Handlers.Set(h, domains...)
 }
 
-// Handlers maps HTTP handlers to domains.
+// Handlers maps HTTP handlers to domains. Domains can be exact, wildcard
+// patterns where "*" matches a single label, like "*.customers.example.com",
+// or suffix patterns that start with a dot, like ".example.com", that match
+// the domain and all of its subdomains. Exact domains have the precedence
+// over wildcard patterns, which have the precedence over suffix patterns.
+// Labels matched by patterns are available with HostLabels function.
 type Handlers map[string]http.Handler
 
 // NewHandlers constructs new instance of Handlers.
@@ -193,7 +220,7 @@ type TLSCert struct {
 // or encrypted connections to the list of servers.
 func (s *Server) WithHTTP(o HTTPOptions) (err error) {
 	_, httpsPort, _ := net.SplitHostPort(o.ListenTLS)
-	handlers := make(map[string]http.Handler)
+	handlers := make(Handlers)
 	DefaultHandler, ok := o.Handlers[""]
 	if !ok {
 		DefaultHandler = http.HandlerFunc(textNotFoundHandler)
@@ -205,35 +232,36 @@ func (s *Server) WithHTTP(o HTTPOptions) (err error) {
 		handlers[domain] = handler
 	}
 
-	for domain := range handlers {
-		var redirectDomain string
-		if strings.HasPrefix(domain, "www.") {
-			redirectDomain = strings.TrimPrefix(domain, "www.")
-		} else {
-			redirectDomain = "www." + domain
-		}
-		if _, ok := handlers[redirectDomain]; !ok {
-			handlers[redirectDomain] = newRedirectDomainHandler(domain, httpsPort)
+	if o.WWWRedirect == WWWRedirectAuto {
+		for domain := range handlers {
+			if strings.HasPrefix(domain, ".") || strings.Contains(domain, "*") {
+				continue
+			}
+			var redirectDomain string
+			if strings.HasPrefix(domain, "www.") {
+				redirectDomain = strings.TrimPrefix(domain, "www.")
+			} else {
+				redirectDomain = "www." + domain
+			}
+			if _, ok := handlers[redirectDomain]; !ok {
+				handlers[redirectDomain] = newRedirectDomainHandler(domain, httpsPort)
+			}
 		}
 	}
 
+	hosts := newHostRouter(handlers, DefaultHandler)
 	var router http.Handler
 	if len(handlers) > 0 {
-		router = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			host, _, err := net.SplitHostPort(r.Host)
-			if err != nil {
-				host = r.Host
-			}
-			h, ok := handlers[host]
-			if ok {
-				h.ServeHTTP(w, r)
-				return
-			}
-			DefaultHandler.ServeHTTP(w, r)
-		})
+		router = hosts
 	} else {
 		router = DefaultHandler
 	}
+	router = o.Chain.Then(router)
+	name := o.Name
+	if name == "" {
+		name = "HTTP"
+	}
+	s.addChain(name, o.Chain)
 
 	var certificates []tls.Certificate
 	for _, c := range o.TLSCerts {
@@ -258,11 +286,7 @@ func (s *Server) WithHTTP(o HTTPOptions) (err error) {
 			Prompt: autocert.AcceptTOS,
 			Cache:  autocert.DirCache(s.acmeCertsDir),
 		}
-		domains := make([]string, 0, len(handlers))
-		for d := range handlers {
-			domains = append(domains, d)
-		}
-		certManager.HostPolicy = autocert.HostWhitelist(domains...)
+		certManager.HostPolicy = hosts.hostPolicy(o.ACMEHostPolicy)
 		certManager.Email = s.acmeCertsEmail
 
 		tlsConfig = certManager.TLSConfig()
@@ -344,6 +368,15 @@ func (s *Server) WithDataDumpService(name string, service datadump.Interface) {
 	s.dataDumpServices[name] = service
 }
 
+// addChain records the middleware chain to be shown on the instrumentation
+// router.
+func (s *Server) addChain(name string, c web.Chain) {
+	s.chainsMu.Lock()
+	defer s.chainsMu.Unlock()
+
+	s.chains = append(s.chains, namedChain{name: name, chain: c})
+}
+
 // Version returns server version with build info data
 // suffixed if exists.
 func (s *Server) Version() (v string) {
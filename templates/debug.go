@@ -0,0 +1,136 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"text/template/parse"
+)
+
+// ExecuteError is returned by Render functions and used as the panic value
+// by Respond functions when a template fails to execute. It provides the
+// information about the template for the debug error page of the recovery
+// handler.
+type ExecuteError struct {
+	// Name is the name of the template in Templates.
+	Name string
+	// Template is the name of the executed associated template, or empty
+	// if the template itself is executed.
+	Template string
+	// DataType is the type of the data passed to the template.
+	DataType string
+	Err      error
+
+	sourceFile func(name, define string) (templateFile, error)
+}
+
+func (e *ExecuteError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExecuteError) Unwrap() error {
+	return e.Err
+}
+
+// DebugAttrs returns the template name, the data type and the location of
+// the error.
+func (e *ExecuteError) DebugAttrs() []slog.Attr {
+	attrs := []slog.Attr{slog.String("template", e.Name)}
+	if e.Template != "" {
+		attrs = append(attrs, slog.String("executed template", e.Template))
+	}
+	attrs = append(attrs, slog.String("data type", e.DataType))
+	if filename, line, _ := e.DebugSource(); filename != "" {
+		attrs = append(attrs, slog.String("file", filename), slog.Int("line", line))
+	}
+	return attrs
+}
+
+var (
+	executingRegexp     = regexp.MustCompile(`executing "([^"]*)"`)
+	errorLocationRegexp = regexp.MustCompile(`^(?:html/)?template: ?([^:]*):(\d+):`)
+)
+
+// DebugSource returns the filename, the line and the content of the
+// template file in which the error occurred. The filename is empty if it can
+// not be determined.
+func (e *ExecuteError) DebugSource() (filename string, line int, content []byte) {
+	if e.sourceFile == nil {
+		return "", 0, nil
+	}
+	msg := e.Err.Error()
+	m := errorLocationRegexp.FindStringSubmatch(msg)
+	if m == nil {
+		return "", 0, nil
+	}
+	define := m[1]
+	line, _ = strconv.Atoi(m[2])
+	if m := executingRegexp.FindStringSubmatch(msg); m != nil {
+		define = m[1]
+	}
+	f, err := e.sourceFile(e.Name, define)
+	if err != nil {
+		return "", 0, nil
+	}
+	return f.name, line, []byte(f.content)
+}
+
+// newExecuteError wraps the error from template execution.
+func (t Templates) newExecuteError(name, templateName string, data any, err error) *ExecuteError {
+	return &ExecuteError{
+		Name:       name,
+		Template:   templateName,
+		DataType:   fmt.Sprintf("%T", data),
+		Err:        err,
+		sourceFile: t.sourceFile,
+	}
+}
+
+// sourceFile returns the file of the named template in which the associated
+// template is defined, where the empty define name references the template
+// itself. If the template is defined in multiple files, the last one is
+// returned, as it is the one that is used.
+func (o *Options) sourceFile(name, define string) (templateFile, error) {
+	var files []templateFile
+	if strings, ok := o.strings[name]; ok {
+		partials, err := o.readFiles(o.partials)
+		if err != nil {
+			return templateFile{}, err
+		}
+		files = partials
+		for i, s := range strings {
+			files = append(files, templateFile{name: fmt.Sprintf("%s string %d", name, i+1), content: s})
+		}
+	} else if names, ok := o.files[name]; ok {
+		_, shared, pages, _, err := o.readTemplate(name, names)
+		if err != nil {
+			return templateFile{}, err
+		}
+		files = append(shared, pages...)
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+		trees := make(map[string]*parse.Tree)
+		t := parse.New(f.name)
+		t.Mode = parse.SkipFuncCheck
+		if _, err := t.Parse(f.content, o.delimOpen, o.delimClose, trees); err != nil {
+			continue
+		}
+		if define == "" {
+			if tree := trees[f.name]; tree != nil && !parse.IsEmptyTree(tree.Root) {
+				return f, nil
+			}
+			continue
+		}
+		if _, ok := trees[define]; ok {
+			return f, nil
+		}
+	}
+	return templateFile{}, &Error{Err: fmt.Errorf("source of %q not found", define), Template: name}
+}
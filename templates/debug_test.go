@@ -0,0 +1,99 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates_test
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/web/templates"
+)
+
+func TestExecuteError_DebugSource(t *testing.T) {
+	layout := "<html>\n<body>\n{{block \"content\" .}}{{end}}\n{{.Missing.Field}}\n</body>\n</html>\n"
+	page := "{{define \"content\"}}\n<main>\n{{if .Fail}}{{fail}}{{end}}\n</main>\n{{end}}\n"
+	fsys := fstest.MapFS{
+		"layout.html": {Data: []byte(layout)},
+		"page.html":   {Data: []byte(page)},
+	}
+	tpl, err := templates.New(
+		templates.WithFS(fsys),
+		templates.WithFunction("fail", func() (string, error) { return "", errors.New("test error") }),
+		templates.WithTemplateFromFiles("page", "layout.html", "page.html"),
+		templates.WithTemplateFromStrings("string", "a\n{{fail}}"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		template string
+		data     any
+		filename string
+		line     int
+		content  string
+	}{
+		{
+			name:     "page file",
+			template: "page",
+			data:     map[string]any{"Fail": true},
+			filename: "page.html",
+			line:     3,
+			content:  page,
+		},
+		{
+			name:     "layout file",
+			template: "page",
+			data:     map[string]any{"Missing": 1},
+			filename: "layout.html",
+			line:     4,
+			content:  layout,
+		},
+		{
+			name:     "string",
+			template: "string",
+			filename: "string string 1",
+			line:     2,
+			content:  "a\n{{fail}}",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tpl.Render(tc.template, tc.data)
+			var e *templates.ExecuteError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected execute error, got %v", err)
+			}
+			if e.Name != tc.template {
+				t.Errorf("expected template name %q, got %q", tc.template, e.Name)
+			}
+
+			filename, line, content := e.DebugSource()
+			if filename != tc.filename {
+				t.Errorf("expected filename %q, got %q", tc.filename, filename)
+			}
+			if line != tc.line {
+				t.Errorf("expected line %v, got %v", tc.line, line)
+			}
+			if string(content) != tc.content {
+				t.Errorf("expected content %q, got %q", tc.content, content)
+			}
+
+			attrs := make(map[string]slog.Value)
+			for _, a := range e.DebugAttrs() {
+				attrs[a.Key] = a.Value
+			}
+			if v := attrs["file"].String(); v != tc.filename {
+				t.Errorf("expected file attribute %q, got %q", tc.filename, v)
+			}
+			if v := attrs["line"].Int64(); v != int64(tc.line) {
+				t.Errorf("expected line attribute %v, got %v", tc.line, v)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+
+	"gopkg.in/mail.v2"
+	"resenje.org/email"
+)
+
+// Email is a message rendered by EmailRenderer.
+type Email struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Message returns the message with the plain text body and the HTML
+// alternative, if they are not empty.
+func (e *Email) Message(from string, to []string, headers map[string][]string) *mail.Message {
+	m := mail.NewMessage()
+	m.SetHeaders(headers)
+	m.SetHeader("From", from)
+	m.SetHeader("To", to...)
+	m.SetHeader("Subject", e.Subject)
+	switch {
+	case e.Text != "" && e.HTML != "":
+		m.SetBody("text/plain", e.Text)
+		m.AddAlternative("text/html", e.HTML)
+	case e.HTML != "":
+		m.SetBody("text/html", e.HTML)
+	default:
+		m.SetBody("text/plain", e.Text)
+	}
+	return m
+}
+
+// Send sends the message returned by the Message method over the SMTP server
+// configured in the email service, from its DefaultFrom address if from is
+// empty.
+func (e *Email) Send(s email.Service, from string, to []string, headers map[string][]string) error {
+	if from == "" {
+		from = s.DefaultFrom
+	}
+	d := mail.NewDialer(s.SMTPHost, s.SMTPPort, s.SMTPUsername, s.SMTPPassword)
+	d.LocalName = s.SMTPIdentity
+	if s.SMTPSkipVerify {
+		d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return d.DialAndSend(e.Message(from, to, headers))
+}
+
+// EmailRenderer renders email messages from templates. For the email name,
+// the HTML template is named with the ".html" suffix and the plain text
+// template with the ".txt" suffix, like "welcome.html" and "welcome.txt".
+// Localized variants have the locale before the suffix, like
+// "welcome.sr-Latn.html", and they are used before the ones with the base
+// language, like "welcome.sr.html", and the ones without the locale. At
+// least one of the templates must exist and the plain text is generated
+// from HTML if its template does not exist. The subject is rendered from
+// the "subject" block of the HTML or the plain text template, or from the
+// template with the ".subject" suffix:
+//
+//	{{define "subject"}}Welcome, {{.Name}}{{end}}
+//
+// Plain text and subject templates must be parsed with text/template
+// package, by creating templates with WithTextSuffixes(".txt", ".subject")
+// or WithTextMode option, as their output is used as it is. Subject blocks
+// of HTML templates are unescaped.
+type EmailRenderer struct {
+	templates     *Templates
+	htmlSuffix    string
+	textSuffix    string
+	subjectSuffix string
+	css           string
+	inlineCSS     bool
+}
+
+// EmailOption sets parameters used in NewEmailRenderer function.
+type EmailOption func(*EmailRenderer)
+
+// WithEmailSuffixes sets suffixes of names of HTML, plain text and subject
+// templates.
+func WithEmailSuffixes(html, text, subject string) EmailOption {
+	return func(r *EmailRenderer) {
+		r.htmlSuffix = html
+		r.textSuffix = text
+		r.subjectSuffix = subject
+	}
+}
+
+// WithEmailCSS sets the CSS that is inlined into every HTML email, in
+// addition to style elements in templates.
+func WithEmailCSS(css string) EmailOption {
+	return func(r *EmailRenderer) { r.css = css }
+}
+
+// WithEmailInlineCSS sets whether rules from style elements are moved into
+// style attributes of HTML elements, as many email clients ignore style
+// elements. Rules with unsupported selectors, like pseudo-classes, and at
+// rules, like media queries, are left in the style element. This
+// functionality is enabled by default.
+func WithEmailInlineCSS(yes bool) EmailOption {
+	return func(r *EmailRenderer) { r.inlineCSS = yes }
+}
+
+// NewEmailRenderer creates a new EmailRenderer that renders email messages
+// from templates.
+func NewEmailRenderer(t *Templates, opts ...EmailOption) (r *EmailRenderer) {
+	r = &EmailRenderer{
+		templates:     t,
+		htmlSuffix:    ".html",
+		textSuffix:    ".txt",
+		subjectSuffix: ".subject",
+		inlineCSS:     true,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Render renders the named email for the locale with the data.
+func (r *EmailRenderer) Render(name, locale string, data any) (e *Email, err error) {
+	htmlName := r.find(name, locale, r.htmlSuffix)
+	textName := r.find(name, locale, r.textSuffix)
+	if htmlName == "" && textName == "" {
+		return nil, &Error{Err: ErrUnknownTemplate, Template: name}
+	}
+	e = new(Email)
+	if htmlName != "" {
+		s, err := r.templates.Render(htmlName, data)
+		if err != nil {
+			return nil, err
+		}
+		if r.inlineCSS || r.css != "" {
+			s, err = inlineCSS(s, r.css)
+			if err != nil {
+				return nil, fmt.Errorf("inline css %s: %w", htmlName, err)
+			}
+		}
+		e.HTML = s
+	}
+	if textName != "" {
+		s, err := r.renderText(textName, "", data)
+		if err != nil {
+			return nil, err
+		}
+		e.Text = s
+	} else {
+		e.Text = htmlToText(e.HTML)
+	}
+	e.Subject, err = r.subject(name, locale, htmlName, textName, data)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Send renders the named email for the locale with the data and sends it
+// over the SMTP server configured in the email service.
+func (r *EmailRenderer) Send(s email.Service, from string, to []string, name, locale string, data any) error {
+	e, err := r.Render(name, locale, data)
+	if err != nil {
+		return err
+	}
+	return e.Send(s, from, to, nil)
+}
+
+// subject renders the subject block of HTML or plain text templates, or the
+// subject template.
+func (r *EmailRenderer) subject(name, locale, htmlName, textName string, data any) (string, error) {
+	for _, n := range []string{htmlName, textName} {
+		if n == "" {
+			continue
+		}
+		tpl, err := r.templates.template(n)
+		if err != nil {
+			return "", err
+		}
+		if tpl.tree("subject") == nil {
+			continue
+		}
+		s, err := r.templates.RenderTemplate(n, "subject", data)
+		if err != nil {
+			return "", err
+		}
+		if !isTextTemplate(tpl) {
+			s = html.UnescapeString(s)
+		}
+		return cleanSubject(s), nil
+	}
+	if n := r.find(name, locale, r.subjectSuffix); n != "" {
+		s, err := r.renderText(n, "", data)
+		if err != nil {
+			return "", err
+		}
+		return cleanSubject(s), nil
+	}
+	return "", nil
+}
+
+// errEmailTextTemplate is returned if a plain text or subject template of the
+// email is not parsed with text/template package.
+var errEmailTextTemplate = errors.New("email template is not parsed in text mode")
+
+// renderText renders the plain text template, returning an error if it is
+// not parsed with text/template package.
+func (r *EmailRenderer) renderText(name, templateName string, data any) (string, error) {
+	tpl, err := r.templates.template(name)
+	if err != nil {
+		return "", err
+	}
+	if !isTextTemplate(tpl) {
+		return "", &Error{Err: errEmailTextTemplate, Template: name}
+	}
+	return r.templates.RenderTemplate(name, templateName, data)
+}
+
+// find returns the name of the existing template for the email name, locale
+// and the suffix, or an empty string if it does not exist.
+func (r *EmailRenderer) find(name, locale, suffix string) string {
+	for locale != "" {
+		if n := name + "." + locale + suffix; r.templates.has(n) {
+			return n
+		}
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	if n := name + suffix; r.templates.has(n) {
+		return n
+	}
+	return ""
+}
+
+// cleanSubject replaces all whitespace in the rendered subject with single
+// spaces.
+func cleanSubject(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
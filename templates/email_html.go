@@ -0,0 +1,439 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// cssRule is a style rule with a single selector.
+type cssRule struct {
+	selector     []cssCompound // compound selectors separated by descendant combinators
+	declarations string
+	specificity  [3]int
+	order        int
+}
+
+// cssCompound is a compound selector, like "p.note" or "#header".
+type cssCompound struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+var (
+	cssCommentRegexp  = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	cssCompoundRegexp = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9-]*|\*)?((?:[.#][a-zA-Z_][a-zA-Z0-9_-]*)*)$`)
+	cssPartRegexp     = regexp.MustCompile(`[.#][a-zA-Z_][a-zA-Z0-9_-]*`)
+)
+
+// inlineCSS moves rules from style elements and the additional CSS into style
+// attributes of matching elements of the HTML document. Rules that can not
+// be inlined are left in the style element.
+func inlineCSS(document, css string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return "", err
+	}
+
+	var styles []*html.Node
+	var elements []*html.Node
+	walkHTML(doc, func(n *html.Node) {
+		if n.Type != html.ElementNode {
+			return
+		}
+		if n.DataAtom == atom.Style {
+			styles = append(styles, n)
+			return
+		}
+		elements = append(elements, n)
+	})
+
+	var sources []string
+	if css != "" {
+		sources = append(sources, css)
+	}
+	for _, s := range styles {
+		var b strings.Builder
+		for c := s.FirstChild; c != nil; c = c.NextSibling {
+			b.WriteString(c.Data)
+		}
+		sources = append(sources, b.String())
+	}
+
+	var rules []cssRule
+	var remaining []string
+	for _, source := range sources {
+		r, rest := parseCSS(source, len(rules))
+		rules = append(rules, r...)
+		if rest != "" {
+			remaining = append(remaining, rest)
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		a, b := rules[i].specificity, rules[j].specificity
+		if a != b {
+			return a[0] < b[0] || (a[0] == b[0] && (a[1] < b[1] || (a[1] == b[1] && a[2] < b[2])))
+		}
+		return rules[i].order < rules[j].order
+	})
+
+	for _, n := range elements {
+		var declarations []string
+		for _, r := range rules {
+			if matchCSSSelector(n, r.selector) {
+				declarations = append(declarations, r.declarations)
+			}
+		}
+		if len(declarations) == 0 {
+			continue
+		}
+		style := -1
+		for i, a := range n.Attr {
+			if a.Key == "style" {
+				style = i
+				break
+			}
+		}
+		if style >= 0 {
+			declarations = append(declarations, strings.TrimSuffix(strings.TrimSpace(n.Attr[style].Val), ";"))
+			n.Attr[style].Val = strings.Join(declarations, "; ")
+		} else {
+			n.Attr = append(n.Attr, html.Attribute{Key: "style", Val: strings.Join(declarations, "; ")})
+		}
+	}
+
+	for i, s := range styles {
+		if i == 0 && len(remaining) > 0 {
+			for c := s.FirstChild; c != nil; c = s.FirstChild {
+				s.RemoveChild(c)
+			}
+			s.AppendChild(&html.Node{Type: html.TextNode, Data: strings.Join(remaining, "\n")})
+			continue
+		}
+		s.Parent.RemoveChild(s)
+	}
+	if len(styles) == 0 && len(remaining) > 0 {
+		if head := findHTML(doc, atom.Head); head != nil {
+			style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+			style.AppendChild(&html.Node{Type: html.TextNode, Data: strings.Join(remaining, "\n")})
+			head.AppendChild(style)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := html.Render(&b, doc); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// parseCSS returns rules with supported selectors from the CSS source and the
+// CSS with rules that can not be inlined. Rules are numbered in order
+// starting from the offset.
+func parseCSS(source string, offset int) (rules []cssRule, rest string) {
+	source = cssCommentRegexp.ReplaceAllString(source, "")
+	var remaining []string
+	for {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			break
+		}
+		open := strings.IndexByte(source, '{')
+		if open < 0 {
+			remaining = append(remaining, source)
+			break
+		}
+		prelude := strings.TrimSpace(source[:open])
+		end := matchingBrace(source, open)
+		if end < 0 {
+			remaining = append(remaining, source)
+			break
+		}
+		block := source[open+1 : end]
+		whole := source[:end+1]
+		source = source[end+1:]
+
+		if strings.HasPrefix(prelude, "@") {
+			remaining = append(remaining, whole)
+			continue
+		}
+		declarations := strings.TrimSuffix(strings.TrimSpace(block), ";")
+		var unsupported []string
+		for _, s := range strings.Split(prelude, ",") {
+			s = strings.TrimSpace(s)
+			selector, specificity, ok := parseCSSSelector(s)
+			if !ok {
+				unsupported = append(unsupported, s)
+				continue
+			}
+			if declarations == "" {
+				continue
+			}
+			rules = append(rules, cssRule{
+				selector:     selector,
+				declarations: declarations,
+				specificity:  specificity,
+				order:        offset + len(rules),
+			})
+		}
+		if len(unsupported) > 0 {
+			remaining = append(remaining, strings.Join(unsupported, ", ")+" {"+block+"}")
+		}
+	}
+	return rules, strings.Join(remaining, "\n")
+}
+
+// matchingBrace returns the index of the brace that closes the one at the
+// open index, or -1 if it is not closed.
+func matchingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseCSSSelector parses the selector that consists of compound selectors
+// with type, id and class selectors, separated by descendant combinators.
+func parseCSSSelector(s string) (selector []cssCompound, specificity [3]int, ok bool) {
+	for _, part := range strings.Fields(s) {
+		m := cssCompoundRegexp.FindStringSubmatch(part)
+		if m == nil {
+			return nil, specificity, false
+		}
+		var c cssCompound
+		if m[1] != "" && m[1] != "*" {
+			c.tag = strings.ToLower(m[1])
+			specificity[2]++
+		}
+		for _, p := range cssPartRegexp.FindAllString(m[2], -1) {
+			if p[0] == '#' {
+				c.id = p[1:]
+				specificity[0]++
+			} else {
+				c.classes = append(c.classes, p[1:])
+				specificity[1]++
+			}
+		}
+		selector = append(selector, c)
+	}
+	return selector, specificity, len(selector) > 0
+}
+
+// matchCSSSelector returns true if the element matches the selector.
+func matchCSSSelector(n *html.Node, selector []cssCompound) bool {
+	last := len(selector) - 1
+	if !matchCSSCompound(n, selector[last]) {
+		return false
+	}
+	i := last - 1
+	for p := n.Parent; p != nil && i >= 0; p = p.Parent {
+		if p.Type == html.ElementNode && matchCSSCompound(p, selector[i]) {
+			i--
+		}
+	}
+	return i < 0
+}
+
+func matchCSSCompound(n *html.Node, c cssCompound) bool {
+	if c.tag != "" && n.Data != c.tag {
+		return false
+	}
+	var id, class string
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "id":
+			id = a.Val
+		case "class":
+			class = a.Val
+		}
+	}
+	if c.id != "" && c.id != id {
+		return false
+	}
+	classes := strings.Fields(class)
+	for _, want := range c.classes {
+		found := false
+		for _, c := range classes {
+			if c == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// htmlToText returns the plain text representation of the HTML document,
+// with paragraphs and other blocks separated by empty lines, list items
+// prefixed by dashes and link addresses after link texts.
+func htmlToText(document string) string {
+	if document == "" {
+		return ""
+	}
+	doc, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return ""
+	}
+	var w textWriter
+	w.node(doc)
+	return strings.TrimSpace(w.b.String()) + "\n"
+}
+
+// textWriter writes text of HTML nodes, collapsing whitespace.
+type textWriter struct {
+	b bytes.Buffer
+	// space is true if a space should be written before the next word.
+	space bool
+	// newlines is the number of trailing new lines.
+	newlines int
+}
+
+func (w *textWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+		switch n.DataAtom {
+		case atom.Head, atom.Script, atom.Style, atom.Title:
+			return
+		case atom.Br:
+			w.newline(1)
+			return
+		case atom.Hr:
+			w.newline(2)
+			w.text("----")
+			w.newline(2)
+			return
+		case atom.Img:
+			for _, a := range n.Attr {
+				if a.Key == "alt" {
+					w.text(a.Val)
+				}
+			}
+			return
+		case atom.Li:
+			w.newline(1)
+			w.text("- ")
+		case atom.Tr:
+			w.newline(1)
+		case atom.Td, atom.Th:
+			if n.PrevSibling != nil {
+				w.text(" ")
+			}
+		}
+		if isTextBlock(n.DataAtom) {
+			w.newline(2)
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+	if n.Type != html.ElementNode {
+		return
+	}
+	if n.DataAtom == atom.A {
+		for _, a := range n.Attr {
+			if a.Key == "href" && a.Val != "" && !strings.HasPrefix(a.Val, "#") && !strings.HasPrefix(a.Val, "mailto:") && textOf(n) != a.Val {
+				w.text(" (" + a.Val + ")")
+			}
+		}
+	}
+	if isTextBlock(n.DataAtom) {
+		w.newline(2)
+	}
+}
+
+func (w *textWriter) text(s string) {
+	if s == "" {
+		return
+	}
+	if isSpace(s[0]) {
+		w.space = true
+	}
+	for _, f := range strings.Fields(s) {
+		if w.space && w.newlines == 0 && w.b.Len() > 0 {
+			w.b.WriteByte(' ')
+		}
+		w.b.WriteString(f)
+		w.newlines = 0
+		w.space = true
+	}
+	w.space = isSpace(s[len(s)-1])
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\t' || c == '\r' || c == '\f'
+}
+
+func (w *textWriter) newline(n int) {
+	if w.b.Len() == 0 {
+		return
+	}
+	for w.newlines < n {
+		w.b.WriteByte('\n')
+		w.newlines++
+	}
+	w.space = false
+}
+
+func isTextBlock(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.Div, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Ul, atom.Ol, atom.Table, atom.Blockquote, atom.Pre, atom.Section,
+		atom.Article, atom.Header, atom.Footer:
+		return true
+	}
+	return false
+}
+
+func textOf(n *html.Node) string {
+	var b strings.Builder
+	walkHTML(n, func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+	})
+	return strings.TrimSpace(b.String())
+}
+
+// walkHTML calls the function for the node and all its descendants in
+// document order.
+func walkHTML(n *html.Node, fn func(*html.Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkHTML(c, fn)
+	}
+}
+
+// findHTML returns the first element with the atom.
+func findHTML(n *html.Node, a atom.Atom) (found *html.Node) {
+	walkHTML(n, func(n *html.Node) {
+		if found == nil && n.Type == html.ElementNode && n.DataAtom == a {
+			found = n
+		}
+	})
+	return found
+}
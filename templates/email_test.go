@@ -0,0 +1,222 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates_test
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"resenje.org/email"
+	"resenje.org/web/templates"
+)
+
+func TestEmailRenderer(t *testing.T) {
+	tpl, err := templates.New(templates.WithTextSuffixes(".txt", ".subject"), templates.WithTemplatesFromStrings(map[string][]string{
+		"welcome.html": {`<html><head><style>p { color: #333 } .note { font-size: 12px } a:hover { color: red }</style></head>` +
+			`<body>{{define "subject"}}Welcome,
+			{{.Name}}{{end}}<p>Hello {{.Name}} &amp; friends,</p><p class="note" style="margin: 0">See <a href="https://example.com">the site</a>.</p></body></html>`},
+		"welcome.sr.html": {`{{define "subject"}}Dobrodošli, {{.Name}}{{end}}<p>Zdravo {{.Name}}</p>`},
+		"welcome.sr.txt":  {`Zdravo {{.Name}} & prijatelji, AT&amp;T`},
+		"welcome.de.txt":  {`Hallo {{.Name}} <{{.Email}}>`},
+		"notice.txt":      {`Notice for {{.Name}}`},
+		"notice.subject":  {`Notice: {{.Name}} &amp; Co.`},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := templates.NewEmailRenderer(tpl)
+
+	e, err := r.Render("welcome", "en-US", map[string]string{"Name": "Ana"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Subject != "Welcome, Ana" {
+		t.Errorf("expected subject %q, got %q", "Welcome, Ana", e.Subject)
+	}
+	for _, want := range []string{
+		`<p style="color: #333">Hello Ana &amp; friends,</p>`,
+		`<p class="note" style="color: #333; font-size: 12px; margin: 0">`,
+		`<style>a:hover { color: red }</style>`,
+	} {
+		if !strings.Contains(e.HTML, want) {
+			t.Errorf("expected html to contain %q, got %q", want, e.HTML)
+		}
+	}
+	wantText := "Hello Ana & friends,\n\nSee the site (https://example.com).\n"
+	if e.Text != wantText {
+		t.Errorf("expected text %q, got %q", wantText, e.Text)
+	}
+
+	e, err = r.Render("welcome", "sr-Latn", map[string]string{"Name": "Ana"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Subject != "Dobrodošli, Ana" {
+		t.Errorf("expected subject %q, got %q", "Dobrodošli, Ana", e.Subject)
+	}
+	if e.Text != "Zdravo Ana & prijatelji, AT&amp;T" {
+		t.Errorf("expected text %q, got %q", "Zdravo Ana & prijatelji, AT&amp;T", e.Text)
+	}
+
+	e, err = r.Render("welcome", "de", map[string]string{"Name": "Jörg & Ana", "Email": "j@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Subject != "Welcome, Jörg & Ana" {
+		t.Errorf("expected subject %q, got %q", "Welcome, Jörg & Ana", e.Subject)
+	}
+	if e.Text != "Hallo Jörg & Ana <j@example.com>" {
+		t.Errorf("expected text %q, got %q", "Hallo Jörg & Ana <j@example.com>", e.Text)
+	}
+
+	e, err = r.Render("notice", "", map[string]string{"Name": "Ana & Jörg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Subject != "Notice: Ana & Jörg &amp; Co." {
+		t.Errorf("expected subject %q, got %q", "Notice: Ana & Jörg &amp; Co.", e.Subject)
+	}
+	if e.HTML != "" {
+		t.Errorf("expected no html, got %q", e.HTML)
+	}
+
+	if _, err := r.Render("missing", "", nil); err == nil {
+		t.Error("expected error for missing email templates")
+	}
+}
+
+func TestEmailRendererHTMLTextTemplate(t *testing.T) {
+	tpl, err := templates.New(templates.WithTemplatesFromStrings(map[string][]string{
+		"welcome.txt": {`Hello {{.}}`},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = templates.NewEmailRenderer(tpl).Render("welcome", "", "Ana")
+	if err == nil || !strings.Contains(err.Error(), "not parsed in text mode") {
+		t.Errorf("expected text mode error, got %v", err)
+	}
+}
+
+func TestEmailRendererSend(t *testing.T) {
+	tpl, err := templates.New(templates.WithTemplatesFromStrings(map[string][]string{
+		"reset.html": {`{{define "subject"}}Reset password{{end}}<p>Use <b>{{.}}</b></p>`},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr, messages := newSMTPServer(t)
+	host, port, _ := net.SplitHostPort(addr)
+	p, _ := strconv.Atoi(port)
+
+	s := email.Service{SMTPHost: host, SMTPPort: p, DefaultFrom: "app@example.com"}
+	if err := templates.NewEmailRenderer(tpl).Send(s, "", []string{"ana@example.com"}, "reset", "", "1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := mail.ReadMessage(strings.NewReader(<-messages))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := m.Header.Get("Subject"); v != "Reset password" {
+		t.Errorf("expected subject %q, got %q", "Reset password", v)
+	}
+	if v := m.Header.Get("To"); v != "ana@example.com" {
+		t.Errorf("expected to %q, got %q", "ana@example.com", v)
+	}
+	if v := m.Header.Get("From"); v != "app@example.com" {
+		t.Errorf("expected from %q, got %q", "app@example.com", v)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("expected content type %q, got %q", "multipart/alternative", mediaType)
+	}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for _, want := range []struct {
+		contentType string
+		body        string
+	}{
+		{contentType: "text/plain", body: "Use 1234\n"},
+		{contentType: "text/html", body: "<html><head></head><body><p>Use <b>1234</b></p></body></html>"},
+	} {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); v != want.contentType {
+			t.Errorf("expected part content type %q, got %q", want.contentType, v)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != want.body {
+			t.Errorf("expected %s body %q, got %q", want.contentType, want.body, body)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("expected no more parts, got %v", err)
+	}
+}
+
+// newSMTPServer starts a minimal SMTP server that accepts messages without
+// authentication and returns its address and the channel with message data.
+func newSMTPServer(t *testing.T) (addr string, messages <-chan string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	c := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		tp := textproto.NewConn(conn)
+		_ = tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			switch strings.ToUpper(strings.Fields(line + " ")[0]) {
+			case "EHLO", "HELO":
+				_ = tp.PrintfLine("250 localhost")
+			case "DATA":
+				_ = tp.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+				b, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				c <- string(b)
+				_ = tp.PrintfLine("250 ok")
+			case "QUIT":
+				_ = tp.PrintfLine("221 bye")
+				return
+			default:
+				_ = tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), c
+}
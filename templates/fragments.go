@@ -0,0 +1,139 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates
+
+import (
+	"net/http"
+)
+
+// fragmentOptions holds parameters of fragment rendering.
+type fragmentOptions struct {
+	header       string
+	targetHeader string
+	block        string
+}
+
+// WithFragmentHeader sets the request header that marks requests for page
+// fragments in FragmentHandler. Default is "HX-Request", which is sent by
+// htmx.
+func WithFragmentHeader(header string) Option {
+	return func(o *Options) { o.fragment.header = header }
+}
+
+// WithFragmentTargetHeader sets the request header with the name of the
+// block that is rendered for fragment requests. Default is "HX-Target",
+// which is sent by htmx with the id of the target element. Empty header
+// disables rendering of blocks by targets.
+func WithFragmentTargetHeader(header string) Option {
+	return func(o *Options) { o.fragment.targetHeader = header }
+}
+
+// WithFragmentBlock sets the name of the block that is rendered for fragment
+// requests, if the page template does not define the block named by the
+// target header. Default is "content".
+func WithFragmentBlock(block string) Option {
+	return func(o *Options) { o.fragment.block = block }
+}
+
+// FragmentHandler returns a handler that marks requests with the fragment
+// header, so that Respond and RespondWithStatus functions render only a
+// block of the page template, the one named by the target header or the one
+// set with WithFragmentBlock option, followed by out-of-band blocks added
+// with AddOutOfBand function. The full page, without out-of-band blocks, is
+// rendered if the template does not define any of these blocks, and for htmx
+// history restore requests.
+// Separate templates for full pages and fragments are not needed:
+//
+//	{{define "content"}}<ul id="users">...</ul>{{end}}
+//	{{define "counter"}}<span id="count" hx-swap-oob="true">{{.Count}}</span>{{end}}
+//
+// The Vary header with fragment request headers is added to all responses.
+//
+// Fragment requests are detected by the response writer passed to the
+// handler. Middleware that wraps it between FragmentHandler and Respond
+// functions must implement the Unwrap() http.ResponseWriter method, as it is
+// required by http.ResponseController, otherwise full pages are rendered.
+func (t Templates) FragmentHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", t.fragment.header)
+		if t.fragment.targetHeader != "" {
+			w.Header().Add("Vary", t.fragment.targetHeader)
+		}
+		if v := r.Header.Get(t.fragment.header); v == "" || v == "false" || r.Header.Get("HX-History-Restore-Request") == "true" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		fw := &fragmentWriter{
+			ResponseWriter: w,
+			block:          t.fragment.block,
+		}
+		if t.fragment.targetHeader != "" {
+			fw.target = r.Header.Get(t.fragment.targetHeader)
+		}
+		h.ServeHTTP(fw, r)
+	})
+}
+
+// AddOutOfBand adds blocks that are rendered after the fragment in the
+// response of the fragment request, usually with the hx-swap-oob attribute
+// to update other parts of the page. It does nothing if the request is not
+// a fragment request marked by FragmentHandler.
+func AddOutOfBand(w http.ResponseWriter, blocks ...string) {
+	if f := fragmentFromWriter(w); f != nil {
+		f.outOfBand = append(f.outOfBand, blocks...)
+	}
+}
+
+// IsFragment returns true if the response is for the fragment request marked
+// by FragmentHandler. Response writers that wrap the one from FragmentHandler
+// must implement Unwrap method.
+func IsFragment(w http.ResponseWriter) bool {
+	return fragmentFromWriter(w) != nil
+}
+
+// fragmentWriter marks the response writer of the fragment request.
+type fragmentWriter struct {
+	http.ResponseWriter
+	target    string
+	block     string
+	outOfBand []string
+}
+
+// Unwrap returns the underlying response writer for http.ResponseController.
+func (w *fragmentWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// blocks returns names of associated templates to be executed for the
+// fragment request, or the empty name of the full page if the template does
+// not define the fragment block.
+func (w *fragmentWriter) blocks(tpl parsedTemplate) []string {
+	var block string
+	switch {
+	case w.target != "" && tpl.tree(w.target) != nil:
+		block = w.target
+	case w.block != "" && tpl.tree(w.block) != nil:
+		block = w.block
+	default:
+		return []string{""}
+	}
+	return append([]string{block}, w.outOfBand...)
+}
+
+// fragmentFromWriter returns the fragmentWriter from the chain of wrapped
+// response writers, or nil if it is not found.
+func fragmentFromWriter(w http.ResponseWriter) *fragmentWriter {
+	for {
+		switch v := w.(type) {
+		case *fragmentWriter:
+			return v
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
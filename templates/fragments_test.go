@@ -0,0 +1,118 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"resenje.org/web/templates"
+)
+
+func TestFragmentHandler(t *testing.T) {
+	tpl, err := templates.New(templates.WithTemplatesFromStrings(map[string][]string{
+		"users": {`<main>{{block "content" .}}<ul id="users">{{.}}</ul>{{end}}{{block "count" .}}<span id="count">1</span>{{end}}</main>`},
+		"plain": {`<main>{{.}}</main>`},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wrapper wraps the response writer without the Unwrap method.
+	type wrapper struct {
+		http.ResponseWriter
+	}
+
+	for _, tc := range []struct {
+		name     string
+		template string
+		headers  map[string]string
+		oob      []string
+		wrap     bool
+		want     string
+		fragment bool
+	}{
+		{
+			name:     "full page",
+			template: "users",
+			oob:      []string{"count"},
+			want:     `<main><ul id="users">ana</ul><span id="count">1</span></main>`,
+		},
+		{
+			name:     "default block",
+			template: "users",
+			headers:  map[string]string{"HX-Request": "true"},
+			want:     `<ul id="users">ana</ul>`,
+			fragment: true,
+		},
+		{
+			name:     "target block with out of band",
+			template: "users",
+			headers:  map[string]string{"HX-Request": "true", "HX-Target": "count"},
+			oob:      []string{"content"},
+			want:     `<span id="count">1</span><ul id="users">ana</ul>`,
+			fragment: true,
+		},
+		{
+			name:     "unknown target",
+			template: "users",
+			headers:  map[string]string{"HX-Request": "true", "HX-Target": "missing"},
+			oob:      []string{"count"},
+			want:     `<ul id="users">ana</ul><span id="count">1</span>`,
+			fragment: true,
+		},
+		{
+			name:     "without blocks",
+			template: "plain",
+			headers:  map[string]string{"HX-Request": "true"},
+			oob:      []string{"count"},
+			want:     `<main>ana</main>`,
+			fragment: true,
+		},
+		{
+			name:     "history restore",
+			template: "users",
+			headers:  map[string]string{"HX-Request": "true", "HX-History-Restore-Request": "true"},
+			want:     `<main><ul id="users">ana</ul><span id="count">1</span></main>`,
+		},
+		{
+			name:     "wrapped without unwrap",
+			template: "users",
+			headers:  map[string]string{"HX-Request": "true"},
+			wrap:     true,
+			want:     `<main><ul id="users">ana</ul><span id="count">1</span></main>`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var fragment bool
+			h := tpl.FragmentHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.wrap {
+					w = wrapper{w}
+				}
+				fragment = templates.IsFragment(w)
+				templates.AddOutOfBand(w, tc.oob...)
+				tpl.Respond(w, tc.template, "ana")
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if got := w.Body.String(); got != tc.want {
+				t.Errorf("expected body %q, got %q", tc.want, got)
+			}
+			if fragment != tc.fragment {
+				t.Errorf("expected fragment %v, got %v", tc.fragment, fragment)
+			}
+			if got, want := w.Header().Values("Vary"), []string{"HX-Request", "HX-Target"}; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+				t.Errorf("expected vary headers %v, got %v", want, got)
+			}
+		})
+	}
+}
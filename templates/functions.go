@@ -11,6 +11,8 @@ import (
 	"html/template"
 	"strings"
 	"time"
+
+	"resenje.org/web"
 )
 
 // NewContextFunc creates a new function that can be used to store
@@ -24,6 +26,29 @@ func NewContextFunc(m map[string]any) func(string) any {
 	}
 }
 
+func newFieldErrorsFunc(c *web.MessageCatalog) func(errs web.FormErrors, field, locale string) []string {
+	return func(errs web.FormErrors, field, locale string) []string {
+		return formatMessages(c, locale, errs.FieldErrors[field])
+	}
+}
+
+func newFormErrorsFunc(c *web.MessageCatalog) func(errs web.FormErrors, locale string) []string {
+	return func(errs web.FormErrors, locale string) []string {
+		return formatMessages(c, locale, errs.Errors)
+	}
+}
+
+func formatMessages(c *web.MessageCatalog, locale string, messages []web.FormMessage) []string {
+	if len(messages) == 0 {
+		return nil
+	}
+	texts := make([]string, 0, len(messages))
+	for _, m := range messages {
+		texts = append(texts, c.Format(locale, m))
+	}
+	return texts
+}
+
 var defaultFunctions = template.FuncMap{
 	"safehtml":        safeHTMLFunc,
 	"relative_time":   relativeTimeFunc,
@@ -0,0 +1,563 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+	"time"
+
+	"resenje.org/web"
+)
+
+// localeFormat holds number, currency and date formats of a language. All
+// of them can be overridden by messages in the catalog with codes
+// "number.decimal", "number.group", "currency.pattern", "date.short",
+// "date.medium" and "date.long".
+type localeFormat struct {
+	decimal         string
+	group           string
+	currencyPattern string
+	dateShort       string
+	dateMedium      string
+	dateLong        string
+}
+
+var (
+	localeFormatEnglish = localeFormat{
+		decimal:         ".",
+		group:           ",",
+		currencyPattern: "{symbol}{amount}",
+		dateShort:       "{m}/{d}/{yyyy}",
+		dateMedium:      "{mon} {d}, {yyyy}",
+		dateLong:        "{month} {d}, {yyyy}",
+	}
+	localeFormatGerman = localeFormat{
+		decimal:         ",",
+		group:           ".",
+		currencyPattern: "{amount} {symbol}",
+		dateShort:       "{dd}.{mm}.{yyyy}",
+		dateMedium:      "{d}. {mon} {yyyy}",
+		dateLong:        "{d}. {month} {yyyy}",
+	}
+	localeFormatSouthSlavic = localeFormat{
+		decimal:         ",",
+		group:           ".",
+		currencyPattern: "{amount} {symbol}",
+		dateShort:       "{d}.{m}.{yyyy}.",
+		dateMedium:      "{d}. {mon} {yyyy}.",
+		dateLong:        "{d}. {month} {yyyy}.",
+	}
+	localeFormatRomance = localeFormat{
+		decimal:         ",",
+		group:           ".",
+		currencyPattern: "{amount} {symbol}",
+		dateShort:       "{dd}/{mm}/{yyyy}",
+		dateMedium:      "{d} {mon} {yyyy}",
+		dateLong:        "{d} {month} {yyyy}",
+	}
+	localeFormatSpaceGroup = localeFormat{
+		decimal:         ",",
+		group:           " ",
+		currencyPattern: "{amount} {symbol}",
+		dateShort:       "{dd}.{mm}.{yyyy}",
+		dateMedium:      "{d} {mon} {yyyy}",
+		dateLong:        "{d} {month} {yyyy}",
+	}
+	localeFormatEastAsian = localeFormat{
+		decimal:         ".",
+		group:           ",",
+		currencyPattern: "{symbol}{amount}",
+		dateShort:       "{yyyy}/{mm}/{dd}",
+		dateMedium:      "{yyyy}/{mm}/{dd}",
+		dateLong:        "{yyyy}年{m}月{d}日",
+	}
+)
+
+// localeFormats are formats by primary language subtags. Languages that are
+// not listed use English formats.
+var localeFormats = map[string]localeFormat{
+	"de": localeFormatGerman,
+	"nl": localeFormatGerman,
+	"da": localeFormatGerman,
+	"tr": localeFormatGerman,
+	"id": localeFormatGerman,
+	"sr": localeFormatSouthSlavic,
+	"hr": localeFormatSouthSlavic,
+	"bs": localeFormatSouthSlavic,
+	"sl": localeFormatSouthSlavic,
+	"es": localeFormatRomance,
+	"it": localeFormatRomance,
+	"pt": localeFormatRomance,
+	"el": localeFormatRomance,
+	"fr": localeFormatSpaceGroup,
+	"ru": localeFormatSpaceGroup,
+	"uk": localeFormatSpaceGroup,
+	"pl": localeFormatSpaceGroup,
+	"cs": localeFormatSpaceGroup,
+	"sk": localeFormatSpaceGroup,
+	"sv": localeFormatSpaceGroup,
+	"nb": localeFormatSpaceGroup,
+	"fi": localeFormatSpaceGroup,
+	"bg": localeFormatSpaceGroup,
+	"hu": localeFormatSpaceGroup,
+	"ja": localeFormatEastAsian,
+	"zh": localeFormatEastAsian,
+	"ko": localeFormatEastAsian,
+}
+
+// currencySymbols are used if the catalog has no "currency.<CODE>" message.
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"CNY": "¥",
+	"INR": "₹",
+	"RUB": "₽",
+}
+
+// zeroDecimalCurrencies are formatted without the fraction.
+var zeroDecimalCurrencies = map[string]bool{
+	"JPY": true,
+	"KRW": true,
+	"VND": true,
+}
+
+// defaultMessages are English texts used by functions when the catalog does
+// not have the message.
+var defaultMessages = map[string]string{
+	"relative_time.now": "just now",
+	"month.1":           "January",
+	"month.2":           "February",
+	"month.3":           "March",
+	"month.4":           "April",
+	"month.5":           "May",
+	"month.6":           "June",
+	"month.7":           "July",
+	"month.8":           "August",
+	"month.9":           "September",
+	"month.10":          "October",
+	"month.11":          "November",
+	"month.12":          "December",
+	"month_short.1":     "Jan",
+	"month_short.2":     "Feb",
+	"month_short.3":     "Mar",
+	"month_short.4":     "Apr",
+	"month_short.5":     "May",
+	"month_short.6":     "Jun",
+	"month_short.7":     "Jul",
+	"month_short.8":     "Aug",
+	"month_short.9":     "Sep",
+	"month_short.10":    "Oct",
+	"month_short.11":    "Nov",
+	"month_short.12":    "Dec",
+}
+
+// defaultPluralMessages are English plural texts used by the relative_time
+// function when the catalog does not have the message.
+var defaultPluralMessages = map[string][2]string{
+	"relative_time.seconds": {"one second ago", "{count} seconds ago"},
+	"relative_time.minutes": {"one minute ago", "{count} minutes ago"},
+	"relative_time.hours":   {"one hour ago", "{count} hours ago"},
+	"relative_time.days":    {"one day ago", "{count} days ago"},
+	"relative_time.months":  {"one month ago", "{count} months ago"},
+	"relative_time.years":   {"one year ago", "{count} years ago"},
+}
+
+// translator implements template functions that format texts, numbers and
+// dates for a locale.
+type translator struct {
+	catalog *web.MessageCatalog
+}
+
+// locale returns the locale from the value which can be a locale string,
+// context.Context or *http.Request with the locale stored by
+// web.LocaleHandler, a value with Locale method or field, or a map with the
+// "Locale" key. The default locale of the catalog is returned if the locale
+// can not be found.
+func (tr translator) locale(source any) string {
+	if locale := localeFromValue(source); locale != "" {
+		return locale
+	}
+	return tr.catalog.DefaultLocale()
+}
+
+func localeFromValue(source any) string {
+	switch v := source.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case context.Context:
+		return web.LocaleFromContext(v)
+	case *http.Request:
+		return web.LocaleFromContext(v.Context())
+	case interface{ Locale() string }:
+		return v.Locale()
+	case map[string]any:
+		return localeFromValue(v["Locale"])
+	case map[string]string:
+		return v["Locale"]
+	}
+	rv := reflect.Indirect(reflect.ValueOf(source))
+	if rv.Kind() != reflect.Struct {
+		return ""
+	}
+	if f := rv.FieldByName("Locale"); f.IsValid() && f.CanInterface() {
+		if locale := localeFromValue(f.Interface()); locale != "" {
+			return locale
+		}
+	}
+	for _, name := range []string{"Request", "Context"} {
+		if f := rv.FieldByName(name); f.IsValid() && f.CanInterface() {
+			if locale := localeFromValue(f.Interface()); locale != "" {
+				return locale
+			}
+		}
+	}
+	return ""
+}
+
+// message returns the message for the locale or the default text.
+func (tr translator) message(locale, code, text string) string {
+	if format, ok := tr.catalog.Lookup(locale, code); ok {
+		return format
+	}
+	return text
+}
+
+// translate implements the t template function.
+func (tr translator) translate(source any, code string, params ...any) (string, error) {
+	p, err := messageParams(params)
+	if err != nil {
+		return "", err
+	}
+	return tr.catalog.Format(tr.locale(source), web.FormMessage{Code: code, Params: p}), nil
+}
+
+// translatePlural implements the tn template function.
+func (tr translator) translatePlural(source any, code string, n int, params ...any) (string, error) {
+	p, err := messageParams(params)
+	if err != nil {
+		return "", err
+	}
+	return tr.catalog.FormatPlural(tr.locale(source), web.FormMessage{Code: code, Params: p}, n), nil
+}
+
+func messageParams(params []any) (map[string]string, error) {
+	if len(params)%2 != 0 {
+		return nil, fmt.Errorf("odd number of message parameters")
+	}
+	if len(params) == 0 {
+		return nil, nil
+	}
+	p := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		p[fmt.Sprint(params[i])] = fmt.Sprint(params[i+1])
+	}
+	return p, nil
+}
+
+func (tr translator) format(locale string) localeFormat {
+	f, ok := localeFormats[strings.SplitN(strings.ToLower(strings.ReplaceAll(locale, "_", "-")), "-", 2)[0]]
+	if !ok {
+		f = localeFormatEnglish
+	}
+	f.decimal = tr.message(locale, "number.decimal", f.decimal)
+	f.group = tr.message(locale, "number.group", f.group)
+	f.currencyPattern = tr.message(locale, "currency.pattern", f.currencyPattern)
+	f.dateShort = tr.message(locale, "date.short", f.dateShort)
+	f.dateMedium = tr.message(locale, "date.medium", f.dateMedium)
+	f.dateLong = tr.message(locale, "date.long", f.dateLong)
+	return f
+}
+
+// relativeTime implements the locale aware relative_time template function.
+// Without the locale source, it uses the default locale of the catalog.
+func (tr translator) relativeTime(t time.Time, source ...any) string {
+	var s any
+	if len(source) > 0 {
+		s = source[0]
+	}
+	locale := tr.locale(s)
+
+	const day = 24 * time.Hour
+	d := time.Since(t)
+	var (
+		code string
+		n    int
+	)
+	switch {
+	case d < time.Second:
+		return tr.message(locale, "relative_time.now", defaultMessages["relative_time.now"])
+	case d < time.Minute:
+		code, n = "relative_time.seconds", int(d/time.Second)
+	case d < time.Hour:
+		code, n = "relative_time.minutes", int(d/time.Minute)
+	case d < day:
+		code, n = "relative_time.hours", int(d/time.Hour)
+	case d < 30*day:
+		code, n = "relative_time.days", int(d/day)
+	case d < 2*365*day:
+		code, n = "relative_time.months", int(d/30/day)
+	default:
+		code, n = "relative_time.years", int(d/365/day)
+	}
+	text := defaultPluralMessages[code][1]
+	if n == 1 {
+		text = defaultPluralMessages[code][0]
+	}
+	return tr.catalog.FormatPlural(locale, web.FormMessage{Code: code, Text: strings.ReplaceAll(text, "{count}", strconv.Itoa(n))}, n)
+}
+
+// number implements the number template function that formats integers and
+// floating point numbers with the optional number of decimals.
+func (tr translator) number(source any, v any, decimals ...int) (string, error) {
+	f := tr.format(tr.locale(source))
+	prec := -1
+	if len(decimals) > 0 {
+		prec = decimals[0]
+	}
+	s, err := formatNumber(v, prec)
+	if err != nil {
+		return "", err
+	}
+	return localizeNumber(s, f), nil
+}
+
+// currency implements the currency template function that formats the
+// amount with the ISO 4217 currency code.
+func (tr translator) currency(source any, amount any, code string) (string, error) {
+	locale := tr.locale(source)
+	f := tr.format(locale)
+	code = strings.ToUpper(code)
+	prec := 2
+	if zeroDecimalCurrencies[code] {
+		prec = 0
+	}
+	s, err := formatNumber(amount, prec)
+	if err != nil {
+		return "", err
+	}
+	symbol, ok := currencySymbols[code]
+	if !ok {
+		symbol = code
+	}
+	symbol = tr.message(locale, "currency."+code, symbol)
+	return strings.NewReplacer("{symbol}", symbol, "{amount}", localizeNumber(s, f)).Replace(f.currencyPattern), nil
+}
+
+// date implements the date template function. Style is "short", "medium",
+// "long" or a custom pattern with tokens {d}, {dd}, {m}, {mm}, {mon},
+// {month}, {yy}, {yyyy}, {H}, {HH}, {MM} and {SS}.
+func (tr translator) date(source any, t time.Time, style string) string {
+	locale := tr.locale(source)
+	f := tr.format(locale)
+	pattern := style
+	switch style {
+	case "short":
+		pattern = f.dateShort
+	case "medium", "":
+		pattern = f.dateMedium
+	case "long":
+		pattern = f.dateLong
+	}
+	month := strconv.Itoa(int(t.Month()))
+	return strings.NewReplacer(
+		"{d}", strconv.Itoa(t.Day()),
+		"{dd}", fmt.Sprintf("%02d", t.Day()),
+		"{m}", month,
+		"{mm}", fmt.Sprintf("%02d", int(t.Month())),
+		"{mon}", tr.message(locale, "month_short."+month, defaultMessages["month_short."+month]),
+		"{month}", tr.message(locale, "month."+month, defaultMessages["month."+month]),
+		"{yy}", fmt.Sprintf("%02d", t.Year()%100),
+		"{yyyy}", strconv.Itoa(t.Year()),
+		"{H}", strconv.Itoa(t.Hour()),
+		"{HH}", fmt.Sprintf("%02d", t.Hour()),
+		"{MM}", fmt.Sprintf("%02d", t.Minute()),
+		"{SS}", fmt.Sprintf("%02d", t.Second()),
+	).Replace(pattern)
+}
+
+// formatNumber formats the number with "." as the decimal separator and
+// without grouping. If prec is negative, floats are formatted with the
+// smallest number of digits necessary.
+func formatNumber(v any, prec int) (string, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if prec > 0 {
+			return strconv.FormatFloat(float64(rv.Int()), 'f', prec, 64), nil
+		}
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if prec > 0 {
+			return strconv.FormatFloat(float64(rv.Uint()), 'f', prec, 64), nil
+		}
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("invalid number %v", f)
+		}
+		return strconv.FormatFloat(f, 'f', prec, 64), nil
+	}
+	return "", fmt.Errorf("invalid number type %T", v)
+}
+
+// localizeNumber replaces the decimal separator and groups integer digits.
+func localizeNumber(s string, f localeFormat) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	integer, fraction, hasFraction := strings.Cut(s, ".")
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, c := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(f.group)
+		}
+		b.WriteRune(c)
+	}
+	if hasFraction {
+		b.WriteString(f.decimal)
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
+
+// Messages returns sorted message codes that are used as constant arguments
+// of t and tn functions in all templates.
+func (t Templates) Messages() ([]string, error) {
+	codes := make(map[string]struct{})
+	for name := range t.allNames() {
+		tpl, err := t.template(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, tree := range tpl.trees() {
+			collectMessages(tree.Root, codes)
+		}
+	}
+	list := make([]string, 0, len(codes))
+	for code := range codes {
+		list = append(list, code)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// MissingMessages returns message codes used in templates that are not
+// translated to the locales of the catalog, by locales. Locales without
+// missing messages are omitted. It can be used in tests or tools to check
+// the completeness of translations.
+func (t Templates) MissingMessages(c *web.MessageCatalog) (map[string][]string, error) {
+	codes, err := t.Messages()
+	if err != nil {
+		return nil, err
+	}
+	missing := make(map[string][]string)
+	for _, locale := range c.Locales() {
+		for _, code := range codes {
+			if !c.Has(locale, code) {
+				missing[locale] = append(missing[locale], code)
+			}
+		}
+	}
+	return missing, nil
+}
+
+func (t Templates) allNames() map[string]struct{} {
+	if t.watcher != nil {
+		t.watcher.mu.RLock()
+		defer t.watcher.mu.RUnlock()
+	}
+	names := make(map[string]struct{}, len(t.templates)+len(t.files))
+	for name := range t.templates {
+		names[name] = struct{}{}
+	}
+	for name := range t.files {
+		names[name] = struct{}{}
+	}
+	return names
+}
+
+// collectMessages adds string constants that are the second arguments of t
+// and tn function calls in the parse tree node.
+func collectMessages(node parse.Node, codes map[string]struct{}) {
+	walkNodes(node, func(node parse.Node) {
+		n, ok := node.(*parse.CommandNode)
+		if !ok || len(n.Args) < 3 {
+			return
+		}
+		if id, ok := n.Args[0].(*parse.IdentifierNode); ok && (id.Ident == "t" || id.Ident == "tn") {
+			if s, ok := n.Args[2].(*parse.StringNode); ok {
+				codes[s.Text] = struct{}{}
+			}
+		}
+	})
+}
+
+// walkNodes calls the function for the node and all of its descendants.
+func walkNodes(node parse.Node, fn func(parse.Node)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		fn(n)
+		for _, c := range n.Nodes {
+			walkNodes(c, fn)
+		}
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		fn(n)
+		for _, c := range n.Cmds {
+			walkNodes(c, fn)
+		}
+	case *parse.ActionNode:
+		fn(n)
+		walkNodes(n.Pipe, fn)
+	case *parse.CommandNode:
+		fn(n)
+		for _, c := range n.Args {
+			walkNodes(c, fn)
+		}
+	case *parse.IfNode:
+		fn(n)
+		walkBranch(&n.BranchNode, fn)
+	case *parse.RangeNode:
+		fn(n)
+		walkBranch(&n.BranchNode, fn)
+	case *parse.WithNode:
+		fn(n)
+		walkBranch(&n.BranchNode, fn)
+	case *parse.TemplateNode:
+		fn(n)
+		walkNodes(n.Pipe, fn)
+	default:
+		if node != nil {
+			fn(node)
+		}
+	}
+}
+
+func walkBranch(n *parse.BranchNode, fn func(parse.Node)) {
+	walkNodes(n.Pipe, fn)
+	walkNodes(n.List, fn)
+	walkNodes(n.ElseList, fn)
+}
@@ -0,0 +1,303 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"resenje.org/web"
+	"resenje.org/web/templates"
+)
+
+func newTestMessageCatalog() *web.MessageCatalog {
+	c := web.NewMessageCatalog("en")
+	c.Add("en", map[string]string{
+		"hello": "Hello, {name}",
+	})
+	c.Add("sr", map[string]string{
+		"hello":         "Zdravo, {name}",
+		"currency.EUR":  "evra",
+		"month_short.3": "mar",
+		"month.3":       "mart",
+	})
+	c.Add("sr-latn", map[string]string{
+		"hello": "Zdravo na latinici, {name}",
+	})
+	c.Add("de", map[string]string{
+		"hello": "Hallo, {name}",
+	})
+	c.AddPlural("en", "items", map[string]string{
+		"one":   "{count} item",
+		"other": "{count} items",
+	})
+	c.AddPlural("sr", "items", map[string]string{
+		"one":   "{count} stavka",
+		"few":   "{count} stavke",
+		"other": "{count} stavki",
+	})
+	c.AddPlural("de", "items", map[string]string{
+		"one":   "{count} Artikel",
+		"other": "{count} Artikel insgesamt",
+	})
+	return c
+}
+
+type localeMethodData struct{}
+
+func (localeMethodData) Locale() string { return "de" }
+
+func TestMessageCatalogLocale(t *testing.T) {
+	tpl, err := templates.New(
+		templates.WithMessageCatalog(newTestMessageCatalog()),
+		templates.WithTemplateFromStrings("hello", `{{t . "hello" "name" "Ana"}}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(web.NewLocaleContext(r.Context(), "sr"))
+
+	for _, tc := range []struct {
+		name string
+		data any
+		want string
+	}{
+		{name: "nil", data: nil, want: "Hello, Ana"},
+		{name: "string", data: "sr", want: "Zdravo, Ana"},
+		{name: "string with script", data: "sr-Latn", want: "Zdravo na latinici, Ana"},
+		{name: "string with region", data: "de-AT", want: "Hallo, Ana"},
+		{name: "string unknown", data: "fr", want: "Hello, Ana"},
+		{name: "context", data: web.NewLocaleContext(context.Background(), "de"), want: "Hallo, Ana"},
+		{name: "context without locale", data: context.Background(), want: "Hello, Ana"},
+		{name: "request", data: r, want: "Zdravo, Ana"},
+		{name: "method", data: localeMethodData{}, want: "Hallo, Ana"},
+		{name: "field", data: struct{ Locale string }{Locale: "sr"}, want: "Zdravo, Ana"},
+		{name: "pointer field", data: &struct{ Locale string }{Locale: "de"}, want: "Hallo, Ana"},
+		{name: "request field", data: struct{ Request any }{Request: r}, want: "Zdravo, Ana"},
+		{name: "context field", data: struct{ Context context.Context }{Context: web.NewLocaleContext(context.Background(), "de")}, want: "Hallo, Ana"},
+		{name: "map", data: map[string]any{"Locale": "sr"}, want: "Zdravo, Ana"},
+		{name: "map with request", data: map[string]any{"Locale": r}, want: "Zdravo, Ana"},
+		{name: "string map", data: map[string]string{"Locale": "de"}, want: "Hallo, Ana"},
+		{name: "map without locale", data: map[string]any{"Name": "x"}, want: "Hello, Ana"},
+	} {
+		got, err := tpl.Render("hello", tc.data)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestMessageCatalogPlural(t *testing.T) {
+	tpl, err := templates.New(
+		templates.WithMessageCatalog(newTestMessageCatalog()),
+		templates.WithTemplateFromStrings("items", `{{tn .Locale "items" .Count}}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		locale string
+		count  int
+		want   string
+	}{
+		{locale: "en", count: 0, want: "0 items"},
+		{locale: "en", count: 1, want: "1 item"},
+		{locale: "en", count: 2, want: "2 items"},
+		{locale: "en", count: 21, want: "21 items"},
+		{locale: "sr", count: 0, want: "0 stavki"},
+		{locale: "sr", count: 1, want: "1 stavka"},
+		{locale: "sr", count: 2, want: "2 stavke"},
+		{locale: "sr", count: 4, want: "4 stavke"},
+		{locale: "sr", count: 5, want: "5 stavki"},
+		{locale: "sr", count: 11, want: "11 stavki"},
+		{locale: "sr", count: 12, want: "12 stavki"},
+		{locale: "sr", count: 21, want: "21 stavka"},
+		{locale: "sr", count: 22, want: "22 stavke"},
+		{locale: "sr", count: 111, want: "111 stavki"},
+		{locale: "sr-Latn", count: 3, want: "3 stavke"},
+		{locale: "de", count: 1, want: "1 Artikel"},
+		{locale: "de", count: 2, want: "2 Artikel insgesamt"},
+		{locale: "fr", count: 1, want: "1 item"},
+		{locale: "fr", count: 3, want: "3 items"},
+	} {
+		got, err := tpl.Render("items", map[string]any{"Locale": tc.locale, "Count": tc.count})
+		if err != nil {
+			t.Fatalf("%s %v: %v", tc.locale, tc.count, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s %v: expected %q, got %q", tc.locale, tc.count, tc.want, got)
+		}
+	}
+}
+
+func TestMessageCatalogFormats(t *testing.T) {
+	tpl, err := templates.New(
+		templates.WithTextMode(true),
+		templates.WithMessageCatalog(newTestMessageCatalog()),
+		templates.WithTemplatesFromStrings(map[string][]string{
+			"number":          {`{{number .Locale .Value}}`},
+			"number decimals": {`{{number .Locale .Value 2}}`},
+			"currency":        {`{{currency .Locale .Value .Code}}`},
+			"date":            {`{{date .Locale .Value .Style}}`},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2024, 3, 5, 9, 7, 3, 0, time.UTC)
+
+	for _, tc := range []struct {
+		template string
+		locale   string
+		value    any
+		code     string
+		style    string
+		want     string
+		err      bool
+	}{
+		{template: "number", locale: "en", value: 1234567, want: "1,234,567"},
+		{template: "number", locale: "en", value: -1234.5, want: "-1,234.5"},
+		{template: "number", locale: "en", value: uint8(255), want: "255"},
+		{template: "number", locale: "de", value: 1234567.25, want: "1.234.567,25"},
+		{template: "number", locale: "sr", value: 1234, want: "1.234"},
+		{template: "number", locale: "fr", value: 1234567.5, want: "1\u00a0234\u00a0567,5"},
+		{template: "number", locale: "ja", value: 1234567, want: "1,234,567"},
+		{template: "number", locale: "xx", value: 1234.5, want: "1,234.5"},
+		{template: "number", locale: "en", value: "1", err: true},
+		{template: "number decimals", locale: "en", value: 1234, want: "1,234.00"},
+		{template: "number decimals", locale: "de", value: 0.125, want: "0,12"},
+		{template: "currency", locale: "en", value: 1234.5, code: "USD", want: "$1,234.50"},
+		{template: "currency", locale: "en", value: 1234.5, code: "chf", want: "CHF1,234.50"},
+		{template: "currency", locale: "de", value: 1234.5, code: "EUR", want: "1.234,50 €"},
+		{template: "currency", locale: "sr", value: 1234.5, code: "EUR", want: "1.234,50 evra"},
+		{template: "currency", locale: "sr", value: 10, code: "RSD", want: "10,00 RSD"},
+		{template: "currency", locale: "ja", value: 1234, code: "JPY", want: "¥1,234"},
+		{template: "date", locale: "en", value: date, style: "short", want: "3/5/2024"},
+		{template: "date", locale: "en", value: date, style: "", want: "Mar 5, 2024"},
+		{template: "date", locale: "en", value: date, style: "long", want: "March 5, 2024"},
+		{template: "date", locale: "de", value: date, style: "short", want: "05.03.2024"},
+		{template: "date", locale: "sr", value: date, style: "medium", want: "5. mar 2024."},
+		{template: "date", locale: "sr", value: date, style: "long", want: "5. mart 2024."},
+		{template: "date", locale: "ja", value: date, style: "long", want: "2024年3月5日"},
+		{template: "date", locale: "en", value: date, style: "{yy}-{mm}-{dd} {HH}:{MM}:{SS}", want: "24-03-05 09:07:03"},
+	} {
+		name := tc.template + " " + tc.locale
+		got, err := tpl.Render(tc.template, map[string]any{"Locale": tc.locale, "Value": tc.value, "Code": tc.code, "Style": tc.style})
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got %q", name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: expected %q, got %q", name, tc.want, got)
+		}
+	}
+}
+
+func TestMessageCatalogRelativeTime(t *testing.T) {
+	c := newTestMessageCatalog()
+	c.AddPlural("sr", "relative_time.minutes", map[string]string{
+		"one":   "pre {count} minut",
+		"few":   "pre {count} minuta",
+		"other": "pre {count} minuta",
+	})
+	tpl, err := templates.New(
+		templates.WithMessageCatalog(c),
+		templates.WithTemplatesFromStrings(map[string][]string{
+			"default": {`{{relative_time .Time}}`},
+			"locale":  {`{{relative_time .Time .Locale}}`},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, tc := range []struct {
+		template string
+		locale   string
+		time     time.Time
+		want     string
+	}{
+		{template: "default", time: now, want: "just now"},
+		{template: "default", time: now.Add(-30 * time.Second), want: "30 seconds ago"},
+		{template: "default", time: now.Add(-61 * time.Second), want: "one minute ago"},
+		{template: "default", time: now.Add(-3 * time.Hour), want: "3 hours ago"},
+		{template: "default", time: now.Add(-49 * time.Hour), want: "2 days ago"},
+		{template: "default", time: now.Add(-3 * 365 * 24 * time.Hour), want: "3 years ago"},
+		{template: "locale", locale: "sr", time: now.Add(-2*time.Minute - time.Second), want: "pre 2 minuta"},
+		{template: "locale", locale: "sr", time: now.Add(-21*time.Minute - time.Second), want: "pre 21 minut"},
+		{template: "locale", locale: "sr", time: now.Add(-2 * time.Hour), want: "2 hours ago"},
+	} {
+		got, err := tpl.Render(tc.template, map[string]any{"Locale": tc.locale, "Time": tc.time})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("%s %s: expected %q, got %q", tc.template, tc.locale, tc.want, got)
+		}
+	}
+}
+
+func TestMissingMessages(t *testing.T) {
+	c := newTestMessageCatalog()
+	tpl, err := templates.New(
+		templates.WithMessageCatalog(c),
+		templates.WithTemplatesFromStrings(map[string][]string{
+			"page":  {`{{t . "hello" "name" .Name}} {{if .Items}}{{tn . "items" (len .Items)}}{{end}}`},
+			"title": {`{{define "title"}}{{t . "title"}}{{end}}{{template "title" .}}`},
+			"other": {`{{t . .Code}} {{printf "%s" "not a message"}}`},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := tpl.Messages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"hello", "items", "title"}; !reflect.DeepEqual(messages, want) {
+		t.Errorf("expected messages %v, got %v", want, messages)
+	}
+
+	missing, err := tpl.MissingMessages(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"en":      {"title"},
+		"de":      {"title"},
+		"sr":      {"title"},
+		"sr-latn": {"items", "title"},
+	}
+	if !reflect.DeepEqual(missing, want) {
+		t.Errorf("expected missing messages %v, got %v", want, missing)
+	}
+
+	c.Add("en", map[string]string{"title": "Title"})
+	missing, err = tpl.MissingMessages(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := missing["en"]; ok {
+		t.Errorf("expected no missing messages for en, got %v", missing["en"])
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"text/template/parse"
+)
+
+// WithLayout registers a layout parsed from files, which can be glob
+// patterns. Layouts include blocks defined by pages with the template action
+// or the block action for blocks with default content:
+//
+//	<title>{{block "title" .}}Site{{end}}</title>
+//	<main>{{template "content" .}}</main>
+//
+// Pages declare their layout with WithPage option or with the comment at
+// the beginning of the page file:
+//
+//	{{/* layout "base" */}}
+//	{{define "content"}}...{{end}}
+func WithLayout(name string, files ...string) Option {
+	return func(o *Options) { o.layouts[name] = files }
+}
+
+// WithPage adds a template parsed from the layout files followed by the page
+// files, which can be glob patterns.
+func WithPage(name, layout string, files ...string) Option {
+	return func(o *Options) {
+		o.files[name] = files
+		o.pageLayouts[name] = layout
+	}
+}
+
+// WithPartials adds files, which can be glob patterns, that are parsed into
+// every template before its layout and files, so that templates defined in
+// them can be used by all templates.
+func WithPartials(files ...string) Option {
+	return func(o *Options) { o.partials = append(o.partials, files...) }
+}
+
+// templateFile is the name and content of a template file.
+type templateFile struct {
+	name    string
+	content string
+}
+
+// parseTemplate parses the named template from partials, its layout and
+// files, and validates that all used blocks are defined and that blocks
+// defined by the page with the layout are used. It returns the template and
+// filenames or glob patterns of all files that it is parsed from.
+func (o *Options) parseTemplate(name string, files []string) (tpl parsedTemplate, sources []string, err error) {
+	layout, shared, pages, sources, err := o.readTemplate(name, files)
+	if err != nil {
+		return nil, nil, err
+	}
+	tpl = o.newTemplate(name)
+	for _, f := range append(shared, pages...) {
+		if err := parseFile(tpl, f); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := o.validateBlocks(name, layout, tpl, pages); err != nil {
+		return nil, nil, err
+	}
+	return tpl, sources, nil
+}
+
+// readTemplate reads files of the named template. It returns the layout
+// name, partials and layout files, page files, and filenames or glob
+// patterns of all files.
+func (o *Options) readTemplate(name string, files []string) (layout string, shared, pages []templateFile, sources []string, err error) {
+	pages, err = o.readFiles(files)
+	if err != nil {
+		return "", nil, nil, nil, err
+	}
+	layout, ok := o.pageLayouts[name]
+	if !ok {
+		for _, p := range pages {
+			if layout = o.layoutDirective(p.content); layout != "" {
+				break
+			}
+		}
+	}
+	shared, err = o.readFiles(o.partials)
+	if err != nil {
+		return "", nil, nil, nil, err
+	}
+	sources = append(sources, o.partials...)
+	if layout != "" {
+		layoutFiles, ok := o.layouts[layout]
+		if !ok {
+			return "", nil, nil, nil, &Error{Err: fmt.Errorf("unknown layout %q", layout), Template: name}
+		}
+		l, err := o.readFiles(layoutFiles)
+		if err != nil {
+			return "", nil, nil, nil, err
+		}
+		shared = append(shared, l...)
+		sources = append(sources, layoutFiles...)
+	}
+	sources = append(sources, files...)
+	return layout, shared, pages, sources, nil
+}
+
+// validateBlocks returns an error if the layout of the template uses a block
+// that is not defined, or if a page with the layout defines a block that is
+// not used. Templates without layouts are not validated.
+func (o *Options) validateBlocks(name, layout string, tpl parsedTemplate, pages []templateFile) error {
+	if layout == "" {
+		return nil
+	}
+	used := make(map[string]struct{})
+	for _, tree := range tpl.trees() {
+		walkNodes(tree.Root, func(node parse.Node) {
+			if n, ok := node.(*parse.TemplateNode); ok {
+				used[n.Name] = struct{}{}
+			}
+		})
+	}
+	for _, block := range sortedKeys(used) {
+		if tpl.tree(block) == nil {
+			return &Error{Err: fmt.Errorf("block %q required by layout %q is not defined", block, layout), Template: name}
+		}
+	}
+	for _, p := range pages {
+		trees := make(map[string]*parse.Tree)
+		t := parse.New(p.name)
+		t.Mode = parse.SkipFuncCheck
+		if _, err := t.Parse(p.content, o.delimOpen, o.delimClose, trees); err != nil {
+			return newFileError(p.name, err)
+		}
+		for _, block := range sortedKeys(trees) {
+			if block == p.name {
+				continue
+			}
+			if _, ok := used[block]; !ok {
+				return &Error{Err: fmt.Errorf("block %q from %s is not used by layout %q", block, p.name, layout), Template: name}
+			}
+		}
+	}
+	return nil
+}
+
+// layoutDirective returns the layout name from the comment at the beginning
+// of the template file content.
+func (o *Options) layoutDirective(content string) string {
+	re := regexp.MustCompile(`^\s*` + regexp.QuoteMeta(o.delimOpen) + `-?\s*/\*\s*layout\s+"([^"]+)"\s*\*/\s*-?` + regexp.QuoteMeta(o.delimClose))
+	m := re.FindStringSubmatch(content)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// readFiles reads template files, expanding glob patterns.
+func (o *Options) readFiles(files []string) ([]templateFile, error) {
+	names, err := o.expandFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]templateFile, 0, len(names))
+	for _, name := range names {
+		b, err := o.fileReadFunc(name)
+		if err != nil {
+			return nil, fmt.Errorf("read template file %s: %v", name, err)
+		}
+		list = append(list, templateFile{name: name, content: string(b)})
+	}
+	return list, nil
+}
+
+// expandFiles returns paths of template files, with glob patterns replaced
+// by the files that match them in lexical order.
+func (o *Options) expandFiles(files []string) ([]string, error) {
+	var names []string
+	for _, f := range files {
+		f = o.fileFindFunc(f)
+		if !hasGlobMeta(f) {
+			names = append(names, f)
+			continue
+		}
+		matches, err := o.fileGlobFunc(f)
+		if err != nil {
+			return nil, fmt.Errorf("glob template files %s: %v", f, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("glob template files %s: no matches", f)
+		}
+		sort.Strings(matches)
+		names = append(names, matches...)
+	}
+	return names, nil
+}
+
+// parseFile parses the template file content into the template.
+func parseFile(tpl parsedTemplate, f templateFile) error {
+	if err := tpl.parse(f.content); err != nil {
+		return newFileError(f.name, err)
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
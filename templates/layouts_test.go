@@ -0,0 +1,58 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates_test
+
+import (
+	"strings"
+	"testing"
+
+	"resenje.org/web/templates"
+)
+
+func TestLayouts(t *testing.T) {
+	files := map[string]string{
+		"base.html":    `<title>{{block "title" .}}Site{{end}}</title>{{template "content" .}}`,
+		"index.html":   `{{/* layout "base" */}}{{define "content"}}<p>{{.}}</p>{{end}}`,
+		"missing.html": `{{/* layout "base" */}}{{define "title"}}Missing{{end}}`,
+		"unused.html":  `{{/* layout "base" */}}{{define "content"}}{{end}}{{define "sidebar"}}{{end}}`,
+		"plain.html":   `{{if .}}{{template "optional" .}}{{end}}plain`,
+	}
+	options := func(opts ...templates.Option) []templates.Option {
+		return append([]templates.Option{
+			templates.WithFileReadFunc(func(filename string) ([]byte, error) {
+				return []byte(files[filename]), nil
+			}),
+			templates.WithLayout("base", "base.html"),
+		}, opts...)
+	}
+
+	// Templates without layouts may reference templates that are not
+	// defined.
+	tpl, err := templates.New(options(
+		templates.WithTemplateFromFiles("index", "index.html"),
+		templates.WithTemplateFromFiles("plain", "plain.html"),
+	)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tpl.Render("index", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<title>Site</title><p>hello</p>"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	for name, want := range map[string]string{
+		"missing": `block "content" required by layout "base" is not defined`,
+		"unused":  `block "sidebar" from unused.html is not used by layout "base"`,
+	} {
+		_, err := templates.New(options(templates.WithTemplateFromFiles(name, name+".html"))...)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error %q, got %v", name, want, err)
+		}
+	}
+}
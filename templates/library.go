@@ -0,0 +1,595 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// StandardFunctions returns functions from all groups of the standard
+// function library: StringFunctions, NumberFunctions, MathFunctions,
+// TimeFunctions, EscapeFunctions and CollectionFunctions. Groups can be added
+// separately with WithFunctions option.
+func StandardFunctions() template.FuncMap {
+	m := template.FuncMap{}
+	for _, g := range []template.FuncMap{
+		StringFunctions(),
+		NumberFunctions(),
+		MathFunctions(),
+		TimeFunctions(),
+		EscapeFunctions(),
+		CollectionFunctions(),
+	} {
+		for name, fn := range g {
+			m[name] = fn
+		}
+	}
+	return m
+}
+
+// StringFunctions returns functions for text manipulation:
+//
+//	{{.Title | truncate 20}}             truncate to 20 runes with ellipsis
+//	{{.Body | truncate_words 50}}        truncate to 50 words with ellipsis
+//	{{.Title | slug}}                    "Čista Voda!" is "cista-voda"
+//	{{.Count}} {{plural_en .Count "item" "items"}}
+//
+// The plural_en function chooses between English singular and plural forms.
+// Texts in other languages should use the tn function from
+// WithMessageCatalog option that selects the form by CLDR plural rules of the locale.
+func StringFunctions() template.FuncMap {
+	return template.FuncMap{
+		"truncate":       truncateFunc,
+		"truncate_words": truncateWordsFunc,
+		"slug":           slugFunc,
+		"plural_en":      pluralEnglishFunc,
+	}
+}
+
+// NumberFunctions returns functions for number formatting:
+//
+//	{{human_bytes .Size}}                1500000 is "1.5 MB"
+//	{{human_ibytes .Size}}               1572864 is "1.5 MiB"
+//	{{human_number .Total}}              1234567 is "1,234,567"
+//	{{compact_number .Views}}            1234567 is "1.2M"
+func NumberFunctions() template.FuncMap {
+	return template.FuncMap{
+		"human_bytes":    humanBytesFunc,
+		"human_ibytes":   humanIBytesFunc,
+		"human_number":   humanNumberFunc,
+		"compact_number": compactNumberFunc,
+	}
+}
+
+// MathFunctions returns arithmetic functions add, sub, mul, div, mod, min,
+// max, round, floor and ceil. Arguments can be of any integer or floating
+// point type and results are integers if all arguments are integers:
+//
+//	{{add .Offset .Limit}}
+//	{{div .Total 3.0 | round 2}}
+func MathFunctions() template.FuncMap {
+	return template.FuncMap{
+		"add":   addFunc,
+		"sub":   subFunc,
+		"mul":   mulFunc,
+		"div":   divFunc,
+		"mod":   modFunc,
+		"min":   minFunc,
+		"max":   maxFunc,
+		"round": roundFunc,
+		"floor": floorFunc,
+		"ceil":  ceilFunc,
+	}
+}
+
+// TimeFunctions returns functions for time formatting in time zones. Layouts
+// are Go time layouts or names of time package layouts, like "RFC3339",
+// "DateTime" and "Kitchen". The empty time zone name keeps the location of
+// the time:
+//
+//	{{.Created | format_time "2006-01-02 15:04" "Europe/Belgrade"}}
+//	{{(.Created | in_timezone .User.TimeZone).Hour}}
+func TimeFunctions() template.FuncMap {
+	return template.FuncMap{
+		"format_time": formatTimeFunc,
+		"in_timezone": inTimezoneFunc,
+	}
+}
+
+// EscapeFunctions returns functions that mark trusted strings as safe for
+// the context where they are used, and the json function that encodes a
+// value as a JSON string:
+//
+//	<a href="{{safe_url .Link}}" {{safe_attr .Attrs}}>
+//	<div data-config="{{json .Config}}">
+//
+// Values passed to safe functions are not escaped, so they must not contain
+// user provided content. The result of the json function is escaped as any
+// other string. In script elements, html/template already encodes values as
+// JSON, so {{.Data}} should be used instead of {{json .Data}}.
+func EscapeFunctions() template.FuncMap {
+	return template.FuncMap{
+		"safe_url":  safeURLFunc,
+		"safe_attr": safeAttrFunc,
+		"safe_js":   safeJSFunc,
+		"safe_css":  safeCSSFunc,
+		"json":      jsonFunc,
+	}
+}
+
+// CollectionFunctions returns functions that construct maps and lists with
+// values of any type and choose between values:
+//
+//	{{template "card" dict "Title" .Title "Items" (list 1 2 3)}}
+//	{{.Name | default "Anonymous"}}
+//	{{coalesce .Nickname .Name "Anonymous"}}
+//
+// Values are empty if they are nil, zero, or collections without elements.
+func CollectionFunctions() template.FuncMap {
+	return template.FuncMap{
+		"dict":     dictFunc,
+		"list":     listFunc,
+		"default":  defaultFunc,
+		"coalesce": coalesceFunc,
+	}
+}
+
+const ellipsis = "…"
+
+func truncateFunc(n int, s string) string {
+	if n < 0 {
+		n = 0
+	}
+	i := 0
+	for p := range s {
+		if i == n {
+			return strings.TrimRightFunc(s[:p], unicode.IsSpace) + ellipsis
+		}
+		i++
+	}
+	return s
+}
+
+func truncateWordsFunc(n int, s string) string {
+	words := strings.Fields(s)
+	if len(words) <= n {
+		return s
+	}
+	if n < 0 {
+		n = 0
+	}
+	return strings.Join(words[:n], " ") + ellipsis
+}
+
+// slugReplacements are letters that are not decomposed to base letters and
+// combining marks.
+var slugReplacements = strings.NewReplacer(
+	"đ", "d", "Đ", "d",
+	"ß", "ss",
+	"æ", "ae", "Æ", "ae",
+	"ø", "o", "Ø", "o",
+	"ł", "l", "Ł", "l",
+	"œ", "oe", "Œ", "oe",
+)
+
+func slugFunc(s string) string {
+	s = norm.NFD.String(slugReplacements.Replace(s))
+	var b strings.Builder
+	dash := false
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+func pluralEnglishFunc(n any, singular, plural string) (string, error) {
+	v, err := toNumber(n)
+	if err != nil {
+		return "", err
+	}
+	if v.float() == 1 {
+		return singular, nil
+	}
+	return plural, nil
+}
+
+func humanBytesFunc(n any) (string, error) {
+	return humanBytes(n, 1000, []string{"B", "kB", "MB", "GB", "TB", "PB", "EB"})
+}
+
+func humanIBytesFunc(n any) (string, error) {
+	return humanBytes(n, 1024, []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"})
+}
+
+func humanBytes(n any, base float64, units []string) (string, error) {
+	v, err := toNumber(n)
+	if err != nil {
+		return "", err
+	}
+	f := v.float()
+	if math.Abs(f) < base {
+		return fmt.Sprintf("%s %s", strconv.FormatFloat(f, 'f', -1, 64), units[0]), nil
+	}
+	i := 0
+	// The unit is increased also if the rounded value reaches the base, so
+	// that 999999 is "1 MB" instead of "1000 kB".
+	for math.Abs(roundShortFloat(f)) >= base && i < len(units)-1 {
+		f /= base
+		i++
+	}
+	return fmt.Sprintf("%s %s", formatShortFloat(f), units[i]), nil
+}
+
+func humanNumberFunc(n any) (string, error) {
+	v, err := toNumber(n)
+	if err != nil {
+		return "", err
+	}
+	s := v.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	integer, fraction, hasFraction := strings.Cut(s, ".")
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, r := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	if hasFraction {
+		b.WriteByte('.')
+		b.WriteString(fraction)
+	}
+	return b.String(), nil
+}
+
+func compactNumberFunc(n any) (string, error) {
+	v, err := toNumber(n)
+	if err != nil {
+		return "", err
+	}
+	f := v.float()
+	units := []struct {
+		value  float64
+		suffix string
+	}{
+		{1e3, "K"},
+		{1e6, "M"},
+		{1e9, "B"},
+		{1e12, "T"},
+	}
+	for i := len(units) - 1; i >= 0; i-- {
+		if math.Abs(f) < units[i].value {
+			continue
+		}
+		// Use the larger unit if the rounded value reaches it, so that
+		// 999999 is "1M" instead of "1000K".
+		if i < len(units)-1 && math.Abs(roundShortFloat(f/units[i].value)) >= 1000 {
+			i++
+		}
+		return formatShortFloat(f/units[i].value) + units[i].suffix, nil
+	}
+	return v.String(), nil
+}
+
+// formatShortFloat formats the number with one decimal if it is less than
+// 10 and without trailing zeros.
+func formatShortFloat(f float64) string {
+	return strconv.FormatFloat(roundShortFloat(f), 'f', -1, 64)
+}
+
+// roundShortFloat rounds the number to one decimal if it is less than 10 and
+// to an integer otherwise.
+func roundShortFloat(f float64) float64 {
+	if math.Abs(f) < 10 {
+		return math.Round(f*10) / 10
+	}
+	return math.Round(f)
+}
+
+// number is an integer or a floating point number.
+type number struct {
+	i       int64
+	f       float64
+	isFloat bool
+}
+
+func (n number) float() float64 {
+	if n.isFloat {
+		return n.f
+	}
+	return float64(n.i)
+}
+
+func (n number) value() any {
+	if n.isFloat {
+		return n.f
+	}
+	return n.i
+}
+
+func (n number) String() string {
+	if n.isFloat {
+		return strconv.FormatFloat(n.f, 'f', -1, 64)
+	}
+	return strconv.FormatInt(n.i, 10)
+}
+
+func toNumber(v any) (number, error) {
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return number{i: r.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := r.Uint()
+		if u > math.MaxInt64 {
+			return number{f: float64(u), isFloat: true}, nil
+		}
+		return number{i: int64(u)}, nil
+	case reflect.Float32, reflect.Float64:
+		return number{f: r.Float(), isFloat: true}, nil
+	case reflect.String:
+		if i, err := strconv.ParseInt(r.String(), 10, 64); err == nil {
+			return number{i: i}, nil
+		}
+		if f, err := strconv.ParseFloat(r.String(), 64); err == nil {
+			return number{f: f, isFloat: true}, nil
+		}
+	}
+	return number{}, fmt.Errorf("invalid number %#v", v)
+}
+
+// arithmetic applies integer or floating point operation to all arguments
+// in order.
+func arithmetic(values []any, intOp func(a, b int64) (int64, error), floatOp func(a, b float64) float64) (any, error) {
+	if len(values) == 0 {
+		return nil, errors.New("missing arguments")
+	}
+	result, err := toNumber(values[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range values[1:] {
+		n, err := toNumber(v)
+		if err != nil {
+			return nil, err
+		}
+		if result.isFloat || n.isFloat {
+			result = number{f: floatOp(result.float(), n.float()), isFloat: true}
+			continue
+		}
+		i, err := intOp(result.i, n.i)
+		if err != nil {
+			return nil, err
+		}
+		result = number{i: i}
+	}
+	return result.value(), nil
+}
+
+func addFunc(values ...any) (any, error) {
+	return arithmetic(values,
+		func(a, b int64) (int64, error) { return a + b, nil },
+		func(a, b float64) float64 { return a + b },
+	)
+}
+
+func subFunc(values ...any) (any, error) {
+	return arithmetic(values,
+		func(a, b int64) (int64, error) { return a - b, nil },
+		func(a, b float64) float64 { return a - b },
+	)
+}
+
+func mulFunc(values ...any) (any, error) {
+	return arithmetic(values,
+		func(a, b int64) (int64, error) { return a * b, nil },
+		func(a, b float64) float64 { return a * b },
+	)
+}
+
+var errDivisionByZero = errors.New("division by zero")
+
+func divFunc(values ...any) (any, error) {
+	for _, v := range values[min(1, len(values)):] {
+		if n, err := toNumber(v); err == nil && n.float() == 0 {
+			return nil, errDivisionByZero
+		}
+	}
+	return arithmetic(values,
+		func(a, b int64) (int64, error) { return a / b, nil },
+		func(a, b float64) float64 { return a / b },
+	)
+}
+
+func modFunc(a, b any) (any, error) {
+	if n, err := toNumber(b); err == nil && n.float() == 0 {
+		return nil, errDivisionByZero
+	}
+	return arithmetic([]any{a, b},
+		func(a, b int64) (int64, error) { return a % b, nil },
+		math.Mod,
+	)
+}
+
+func minFunc(values ...any) (any, error) {
+	return arithmetic(values,
+		func(a, b int64) (int64, error) { return min(a, b), nil },
+		math.Min,
+	)
+}
+
+func maxFunc(values ...any) (any, error) {
+	return arithmetic(values,
+		func(a, b int64) (int64, error) { return max(a, b), nil },
+		math.Max,
+	)
+}
+
+func roundFunc(places int, v any) (float64, error) {
+	n, err := toNumber(v)
+	if err != nil {
+		return 0, err
+	}
+	p := math.Pow10(places)
+	return math.Round(n.float()*p) / p, nil
+}
+
+func floorFunc(v any) (float64, error) {
+	n, err := toNumber(v)
+	if err != nil {
+		return 0, err
+	}
+	return math.Floor(n.float()), nil
+}
+
+func ceilFunc(v any) (float64, error) {
+	n, err := toNumber(v)
+	if err != nil {
+		return 0, err
+	}
+	return math.Ceil(n.float()), nil
+}
+
+// timeLayouts are layouts from the time package by their names.
+var timeLayouts = map[string]string{
+	"Layout":      time.Layout,
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+func formatTimeFunc(layout, timezone string, t time.Time) (string, error) {
+	t, err := inTimezoneFunc(timezone, t)
+	if err != nil {
+		return "", err
+	}
+	if l, ok := timeLayouts[layout]; ok {
+		layout = l
+	}
+	return t.Format(layout), nil
+}
+
+func inTimezoneFunc(timezone string, t time.Time) (time.Time, error) {
+	if timezone == "" {
+		return t, nil
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(loc), nil
+}
+
+func safeURLFunc(s string) template.URL {
+	return template.URL(s)
+}
+
+func safeAttrFunc(s string) template.HTMLAttr {
+	return template.HTMLAttr(s)
+}
+
+func safeJSFunc(s string) template.JS {
+	return template.JS(s)
+}
+
+func safeCSSFunc(s string) template.CSS {
+	return template.CSS(s)
+}
+
+func jsonFunc(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func dictFunc(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict requires an even number of arguments")
+	}
+	m := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %#v is not a string", pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+func listFunc(values ...any) []any {
+	return values
+}
+
+func defaultFunc(value, v any) any {
+	if isEmpty(v) {
+		return value
+	}
+	return v
+}
+
+func coalesceFunc(values ...any) any {
+	for _, v := range values {
+		if !isEmpty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// isEmpty returns true if the value is nil, zero, or a collection without
+// elements.
+func isEmpty(v any) bool {
+	if v == nil {
+		return true
+	}
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Array, reflect.Chan, reflect.Map, reflect.Slice, reflect.String:
+		return r.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return r.IsNil()
+	}
+	return r.IsZero()
+}
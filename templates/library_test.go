@@ -0,0 +1,138 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates_test
+
+import (
+	"testing"
+	"time"
+
+	"resenje.org/web/templates"
+)
+
+func TestStandardFunctions(t *testing.T) {
+	created := time.Date(2024, 3, 5, 22, 30, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name     string
+		template string
+		data     any
+		want     string
+		err      bool
+	}{
+		{name: "truncate", template: `{{. | truncate 9}}`, data: "Čista voda teče", want: "Čista vod…"},
+		{name: "truncate trailing space", template: `{{. | truncate 6}}`, data: "Čista voda", want: "Čista…"},
+		{name: "truncate short", template: `{{. | truncate 20}}`, data: "Čista voda", want: "Čista voda"},
+		{name: "truncate words", template: `{{. | truncate_words 2}}`, data: "one two  three", want: "one two…"},
+		{name: "truncate words short", template: `{{. | truncate_words 3}}`, data: "one two", want: "one two"},
+		{name: "slug", template: `{{. | slug}}`, data: "  Čista Voda, Đak & Straße!", want: "cista-voda-dak-strasse"},
+		{name: "plural one", template: `{{plural_en . "item" "items"}}`, data: 1, want: "item"},
+		{name: "plural other", template: `{{plural_en . "item" "items"}}`, data: 0, want: "items"},
+
+		{name: "human bytes", template: `{{human_bytes .}}`, data: 1500000, want: "1.5 MB"},
+		{name: "human bytes small", template: `{{human_bytes .}}`, data: uint16(999), want: "999 B"},
+		{name: "human bytes large", template: `{{human_bytes .}}`, data: int64(25_300_000_000), want: "25 GB"},
+		{name: "human ibytes", template: `{{human_ibytes .}}`, data: 1572864, want: "1.5 MiB"},
+		{name: "human bytes rounding to next unit", template: `{{human_bytes .}}`, data: 999999, want: "1 MB"},
+		{name: "human bytes rounding below next unit", template: `{{human_bytes .}}`, data: 999499, want: "999 kB"},
+		{name: "human bytes base", template: `{{human_bytes .}}`, data: 1000, want: "1 kB"},
+		{name: "human bytes negative rounding", template: `{{human_bytes .}}`, data: -999999, want: "-1 MB"},
+		{name: "human bytes largest unit", template: `{{human_bytes .}}`, data: 2.5e21, want: "2500 EB"},
+		{name: "human ibytes rounding to next unit", template: `{{human_ibytes .}}`, data: 1048575, want: "1 MiB"},
+		{name: "human ibytes rounding below next unit", template: `{{human_ibytes .}}`, data: 1023 * 1024, want: "1023 KiB"},
+		{name: "human number", template: `{{human_number .}}`, data: -1234567, want: "-1,234,567"},
+		{name: "human number float", template: `{{human_number .}}`, data: 1234.5, want: "1,234.5"},
+		{name: "compact number", template: `{{compact_number .}}`, data: 1234567, want: "1.2M"},
+		{name: "compact number thousands", template: `{{compact_number .}}`, data: 45600, want: "46K"},
+		{name: "compact number small", template: `{{compact_number .}}`, data: 999, want: "999"},
+		{name: "compact number rounding to next unit", template: `{{compact_number .}}`, data: 999999, want: "1M"},
+		{name: "compact number rounding below next unit", template: `{{compact_number .}}`, data: 999499, want: "999K"},
+		{name: "compact number base", template: `{{compact_number .}}`, data: 1000, want: "1K"},
+		{name: "compact number negative rounding", template: `{{compact_number .}}`, data: -999_999_999, want: "-1B"},
+		{name: "compact number one decimal rounding", template: `{{compact_number .}}`, data: 9_960, want: "10K"},
+		{name: "compact number largest unit", template: `{{compact_number .}}`, data: 999_999_999_999_999, want: "1000T"},
+		{name: "human number invalid", template: `{{human_number .}}`, data: "many", err: true},
+
+		{name: "add", template: `{{add 1 2 3}}`, want: "6"},
+		{name: "add float", template: `{{add 1 2.5}}`, want: "3.5"},
+		{name: "sub", template: `{{sub 10 . 2}}`, data: uint8(3), want: "5"},
+		{name: "mul", template: `{{mul 2 3 4}}`, want: "24"},
+		{name: "div", template: `{{div 7 2}}`, want: "3"},
+		{name: "div float", template: `{{div 7 2.0}}`, want: "3.5"},
+		{name: "div by zero", template: `{{div 7 0}}`, err: true},
+		{name: "mod", template: `{{mod 7 3}}`, want: "1"},
+		{name: "min", template: `{{min 3 1 2}}`, want: "1"},
+		{name: "max", template: `{{max 3 1.5 2}}`, want: "3"},
+		{name: "round", template: `{{div 10 3.0 | round 2}}`, want: "3.33"},
+		{name: "floor", template: `{{floor 2.7}}`, want: "2"},
+		{name: "ceil", template: `{{ceil 2.1}}`, want: "3"},
+
+		{name: "format time", template: `{{. | format_time "2006-01-02 15:04" "Europe/Belgrade"}}`, data: created, want: "2024-03-05 23:30"},
+		{name: "format time named layout", template: `{{. | format_time "DateOnly" ""}}`, data: created, want: "2024-03-05"},
+		{name: "format time invalid zone", template: `{{. | format_time "DateOnly" "Nowhere/Nothing"}}`, data: created, err: true},
+		{name: "in timezone", template: `{{(. | in_timezone "Asia/Tokyo").Day}}`, data: created, want: "6"},
+
+		{name: "safe url", template: `<a href="{{safe_url .}}">`, data: "tel:+123", want: `<a href="tel:&#43;123">`},
+		{name: "safe attr", template: `<p {{safe_attr .}}>`, data: `data-id="1"`, want: `<p data-id="1">`},
+		{name: "json attribute", template: `<div data-config="{{json .}}">`, data: map[string]any{"a": `"><script>`, "b": []int{1}}, want: `<div data-config="{&#34;a&#34;:&#34;\&#34;\u003e\u003cscript\u003e&#34;,&#34;b&#34;:[1]}">`},
+		{name: "json script", template: `<script>const data = JSON.parse({{json .}});</script>`, data: map[string]any{"a": "</script>"}, want: `<script>const data = JSON.parse("{\"a\":\"\\u003c/script\\u003e\"}");</script>`},
+		{name: "json text", template: `{{json .}}`, data: []int{1}, want: `[1]`},
+
+		{name: "dict and list", template: `{{with dict "Title" "T" "Items" (list 1 "two")}}{{.Title}}{{range .Items}} {{.}}{{end}}{{end}}`, want: "T 1 two"},
+		{name: "dict invalid key", template: `{{dict 1 2}}`, err: true},
+		{name: "dict odd arguments", template: `{{dict "a"}}`, err: true},
+		{name: "default", template: `{{. | default "Anonymous"}}`, data: "", want: "Anonymous"},
+		{name: "default value", template: `{{. | default "Anonymous"}}`, data: "Ana", want: "Ana"},
+		{name: "default zero", template: `{{. | default 10}}`, data: 0, want: "10"},
+		{name: "coalesce", template: `{{coalesce .A .B "c"}}`, data: map[string]any{"A": nil, "B": []int{}}, want: "c"},
+		{name: "coalesce first", template: `{{coalesce .A .B "c"}}`, data: map[string]any{"A": nil, "B": "b"}, want: "b"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tpl, err := templates.New(
+				templates.WithFunctions(templates.StandardFunctions()),
+				templates.WithTemplateFromStrings("test", tc.template),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tpl.Render("test", tc.data)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFunctionGroups(t *testing.T) {
+	all := templates.StandardFunctions()
+	count := 0
+	for _, g := range []map[string]any{
+		templates.StringFunctions(),
+		templates.NumberFunctions(),
+		templates.MathFunctions(),
+		templates.TimeFunctions(),
+		templates.EscapeFunctions(),
+		templates.CollectionFunctions(),
+	} {
+		for name := range g {
+			if _, ok := all[name]; !ok {
+				t.Errorf("expected function %q in standard functions", name)
+			}
+			count++
+		}
+	}
+	if count != len(all) {
+		t.Errorf("expected %d standard functions, got %d", count, len(all))
+	}
+}
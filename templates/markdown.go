@@ -0,0 +1,268 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"html/template"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// DefaultMarkdownLinkRel is the rel attribute value set on external links
+// in rendered Markdown.
+const DefaultMarkdownLinkRel = "nofollow noopener noreferrer"
+
+// Markdown renders CommonMark documents with tables to HTML that is passed
+// through an allowlist sanitizer. Rendered outputs are cached by the hash of
+// the source.
+type Markdown struct {
+	md            goldmark.Markdown
+	sanitizer     *sanitizer
+	unsafe        bool
+	elements      map[string][]string
+	headingIDs    bool
+	headingPrefix string
+	anchor        string
+	linkRel       string
+	linkHosts     map[string]struct{}
+	cacheSize     int
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]template.HTML
+	keys  [][sha256.Size]byte // insertion order for cache eviction
+}
+
+// MarkdownOption sets parameters used in NewMarkdown function.
+type MarkdownOption func(*Markdown)
+
+// WithMarkdownHeadingIDs sets id attributes of headings to slugs of their
+// texts, prefixed with the prefix. Duplicate ids are suffixed with a number.
+func WithMarkdownHeadingIDs(prefix string) MarkdownOption {
+	return func(m *Markdown) {
+		m.headingIDs = true
+		m.headingPrefix = prefix
+	}
+}
+
+// WithMarkdownHeadingAnchors appends a link to the heading id with the symbol
+// as its text and "anchor" class to every heading. It enables heading ids if
+// they are not already enabled.
+func WithMarkdownHeadingAnchors(symbol string) MarkdownOption {
+	return func(m *Markdown) {
+		m.headingIDs = true
+		m.anchor = symbol
+	}
+}
+
+// WithMarkdownLinkRel sets the rel attribute of links to absolute http and
+// https URLs with hosts other than the provided ones. Empty rel disables
+// setting the attribute. The default is DefaultMarkdownLinkRel.
+func WithMarkdownLinkRel(rel string, hosts ...string) MarkdownOption {
+	return func(m *Markdown) {
+		m.linkRel = rel
+		for _, h := range hosts {
+			m.linkHosts[strings.ToLower(h)] = struct{}{}
+		}
+	}
+}
+
+// WithMarkdownUnsafeHTML allows raw HTML in Markdown source. Raw HTML is
+// still passed through the sanitizer.
+func WithMarkdownUnsafeHTML(yes bool) MarkdownOption {
+	return func(m *Markdown) { m.unsafe = yes }
+}
+
+// WithMarkdownAllowedElements adds HTML elements with their attributes to
+// the ones allowed by the sanitizer. Attributes with URL values, like href,
+// src, action, srcset or xlink:href, are removed if they have URLs with
+// schemes other than http, https or mailto. Event handler and style
+// attributes are always removed.
+func WithMarkdownAllowedElements(elements map[string][]string) MarkdownOption {
+	return func(m *Markdown) {
+		for name, attrs := range elements {
+			m.elements[name] = append(m.elements[name], attrs...)
+		}
+	}
+}
+
+// WithMarkdownCache sets the maximal number of rendered outputs that are
+// cached. Zero size disables caching. The default is 1024.
+func WithMarkdownCache(size int) MarkdownOption {
+	return func(m *Markdown) { m.cacheSize = size }
+}
+
+// NewMarkdown creates a new Markdown renderer.
+func NewMarkdown(opts ...MarkdownOption) (m *Markdown) {
+	m = &Markdown{
+		elements:  map[string][]string{},
+		linkRel:   DefaultMarkdownLinkRel,
+		linkHosts: map[string]struct{}{},
+		cacheSize: 1024,
+		cache:     map[[sha256.Size]byte]template.HTML{},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	var rendererOptions []renderer.Option
+	if m.unsafe {
+		rendererOptions = append(rendererOptions, gmhtml.WithUnsafe())
+	}
+	m.md = goldmark.New(
+		goldmark.WithExtensions(extension.NewTable(
+			extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute),
+		)),
+		goldmark.WithRendererOptions(rendererOptions...),
+	)
+	m.sanitizer = newSanitizer(m.elements)
+	return m
+}
+
+// Render returns the sanitized HTML of the Markdown source.
+func (m *Markdown) Render(source string) (template.HTML, error) {
+	if m.cacheSize <= 0 {
+		return m.render(source)
+	}
+	key := sha256.Sum256([]byte(source))
+	m.mu.Lock()
+	h, ok := m.cache[key]
+	m.mu.Unlock()
+	if ok {
+		return h, nil
+	}
+	h, err := m.render(source)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	if _, ok := m.cache[key]; !ok {
+		if len(m.keys) >= m.cacheSize {
+			delete(m.cache, m.keys[0])
+			m.keys = m.keys[1:]
+		}
+		m.cache[key] = h
+		m.keys = append(m.keys, key)
+	}
+	m.mu.Unlock()
+	return h, nil
+}
+
+func (m *Markdown) render(source string) (template.HTML, error) {
+	var b bytes.Buffer
+	if err := m.md.Convert([]byte(source), &b); err != nil {
+		return "", err
+	}
+	nodes, err := m.sanitizer.sanitize(b.String())
+	if err != nil {
+		return "", err
+	}
+	ids := map[string]int{}
+	b.Reset()
+	for _, n := range nodes {
+		walkHTML(n, func(n *html.Node) {
+			if n.Type != html.ElementNode {
+				return
+			}
+			switch n.DataAtom {
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+				m.heading(n, ids)
+			case atom.A:
+				m.link(n)
+			}
+		})
+		if err := html.Render(&b, n); err != nil {
+			return "", err
+		}
+	}
+	return template.HTML(b.String()), nil
+}
+
+// heading sets the id attribute and appends the anchor link to the heading
+// element.
+func (m *Markdown) heading(n *html.Node, ids map[string]int) {
+	if !m.headingIDs {
+		return
+	}
+	slug := slugFunc(textOf(n))
+	if slug == "" {
+		slug = "section"
+	}
+	id := m.headingPrefix + slug
+	if c := ids[id]; c > 0 {
+		ids[id] = c + 1
+		id += "-" + strconv.Itoa(c)
+	} else {
+		ids[id] = 1
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: "id", Val: id})
+	if m.anchor == "" {
+		return
+	}
+	a := &html.Node{
+		Type:     html.ElementNode,
+		Data:     "a",
+		DataAtom: atom.A,
+		Attr: []html.Attribute{
+			{Key: "href", Val: "#" + id},
+			{Key: "class", Val: "anchor"},
+			{Key: "aria-hidden", Val: "true"},
+		},
+	}
+	a.AppendChild(&html.Node{Type: html.TextNode, Data: m.anchor})
+	n.AppendChild(&html.Node{Type: html.TextNode, Data: " "})
+	n.AppendChild(a)
+}
+
+// link sets the rel attribute of the link element with an external URL, which
+// has http or https scheme or is protocol-relative, like "//example.com".
+func (m *Markdown) link(n *html.Node) {
+	if m.linkRel == "" {
+		return
+	}
+	for _, a := range n.Attr {
+		if a.Key != "href" {
+			continue
+		}
+		u, err := url.Parse(strings.TrimSpace(a.Val))
+		if err != nil {
+			return
+		}
+		switch strings.ToLower(u.Scheme) {
+		case "http", "https":
+		case "":
+			if u.Host == "" {
+				return
+			}
+		default:
+			return
+		}
+		if _, ok := m.linkHosts[strings.ToLower(u.Hostname())]; ok {
+			return
+		}
+		n.Attr = append(n.Attr, html.Attribute{Key: "rel", Val: m.linkRel})
+		return
+	}
+}
+
+// WithMarkdown adds the markdown function that renders the Markdown string
+// argument to sanitized HTML with the Markdown renderer. If the renderer is
+// nil, the one with default options is used.
+func WithMarkdown(m *Markdown) Option {
+	if m == nil {
+		m = NewMarkdown()
+	}
+	return func(o *Options) { o.functions["markdown"] = m.Render }
+}
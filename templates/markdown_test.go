@@ -0,0 +1,160 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates_test
+
+import (
+	"strings"
+	"testing"
+
+	"resenje.org/web/templates"
+)
+
+func TestMarkdown(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		options []templates.MarkdownOption
+		source  string
+		want    string
+	}{
+		{
+			name:   "paragraph",
+			source: "Hello *world* & **friends**",
+			want:   "<p>Hello <em>world</em> &amp; <strong>friends</strong></p>",
+		},
+		{
+			name:   "fenced code",
+			source: "```go\nfmt.Println(\"<b>\")\n```",
+			want:   "<pre><code class=\"language-go\">fmt.Println(&#34;&lt;b&gt;&#34;)\n</code></pre>",
+		},
+		{
+			name:   "table",
+			source: "| A | B |\n|:--|--:|\n| 1 | 2 |",
+			want:   "<table>\n<thead>\n<tr>\n<th align=\"left\">A</th>\n<th align=\"right\">B</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td align=\"left\">1</td>\n<td align=\"right\">2</td>\n</tr>\n</tbody>\n</table>",
+		},
+		{
+			name:   "raw html omitted",
+			source: "<script>alert(1)</script>\n\ntext",
+			want:   "<p>text</p>",
+		},
+		{
+			name:    "raw html sanitized",
+			options: []templates.MarkdownOption{templates.WithMarkdownUnsafeHTML(true)},
+			source:  "<div onclick=\"x()\">a <b>b</b><script>alert(1)</script> <a href=\"javascript:x()\">c</a></div>",
+			want:    "a b <a>c</a>",
+		},
+		{
+			name: "allowed elements",
+			options: []templates.MarkdownOption{
+				templates.WithMarkdownUnsafeHTML(true),
+				templates.WithMarkdownAllowedElements(map[string][]string{"abbr": {"title"}}),
+			},
+			source: "<abbr title=\"HyperText\" class=\"x\">HTML</abbr>",
+			want:   "<p><abbr title=\"HyperText\">HTML</abbr></p>",
+		},
+		{
+			name: "allowed elements with urls",
+			options: []templates.MarkdownOption{
+				templates.WithMarkdownUnsafeHTML(true),
+				templates.WithMarkdownAllowedElements(map[string][]string{
+					"form":  {"action"},
+					"video": {"poster", "src"},
+					"img":   {"srcset"},
+					"q":     {"cite", "xlink:href"},
+					"a":     {"ping"},
+				}),
+			},
+			source: `<form action="javascript:alert(1)"><video poster="javascript:x()" src="/v.mp4"></video></form>` + "\n\n" +
+				`<img src="/a.png" srcset="/a.png 1x, javascript:x() 2x"> <img srcset="/a.png 1x, https://example.com/b.png 2x">` +
+				` <q cite=" JavaScript:x()" xlink:href="data:text/html,x">q</q> <q cite="https://example.com">q</q>` +
+				` <a href="/a" ping="/p javascript:x()">a</a> <a href="/b" ping="/p https://example.com/p">b</a>`,
+			want: `<form><video src="/v.mp4"></video></form>` + "\n" +
+				`<p><img src="/a.png"/> <img srcset="/a.png 1x, https://example.com/b.png 2x"/>` +
+				` <q>q</q> <q cite="https://example.com">q</q>` +
+				` <a href="/a">a</a> <a href="/b" ping="/p https://example.com/p">b</a></p>`,
+		},
+		{
+			name:   "unsafe link",
+			source: "[a](javascript:alert(1)) ![i](data:image/png;base64,AA)",
+			want:   "<p><a href=\"\">a</a> <img alt=\"i\"/></p>",
+		},
+		{
+			name:   "external link",
+			source: "[a](https://example.com/x) [b](/local) [c](mailto:a@example.com)",
+			want:   "<p><a href=\"https://example.com/x\" rel=\"nofollow noopener noreferrer\">a</a> <a href=\"/local\">b</a> <a href=\"mailto:a@example.com\">c</a></p>",
+		},
+		{
+			name:    "link rel hosts",
+			options: []templates.MarkdownOption{templates.WithMarkdownLinkRel("noopener", "resenje.org")},
+			source:  "[a](https://example.com) [b](https://Resenje.org/web) [c](//example.com/c) [d](//resenje.org/d)",
+			want:    "<p><a href=\"https://example.com\" rel=\"noopener\">a</a> <a href=\"https://Resenje.org/web\">b</a> <a href=\"//example.com/c\" rel=\"noopener\">c</a> <a href=\"//resenje.org/d\">d</a></p>",
+		},
+		{
+			name:    "link rel disabled",
+			options: []templates.MarkdownOption{templates.WithMarkdownLinkRel("")},
+			source:  "[a](https://example.com)",
+			want:    "<p><a href=\"https://example.com\">a</a></p>",
+		},
+		{
+			name:   "headings without ids",
+			source: "# Title",
+			want:   "<h1>Title</h1>",
+		},
+		{
+			name:    "heading ids",
+			options: []templates.MarkdownOption{templates.WithMarkdownHeadingIDs("h-")},
+			source:  "# Čista voda\n\n## Čista voda\n\n## ***",
+			want:    "<h1 id=\"h-cista-voda\">Čista voda</h1>\n<h2 id=\"h-cista-voda-1\">Čista voda</h2>\n<h2 id=\"h-section\">***</h2>",
+		},
+		{
+			name:    "heading anchors",
+			options: []templates.MarkdownOption{templates.WithMarkdownHeadingAnchors("#")},
+			source:  "## Usage",
+			want:    "<h2 id=\"usage\">Usage <a href=\"#usage\" class=\"anchor\" aria-hidden=\"true\">#</a></h2>",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := templates.NewMarkdown(tc.options...).Render(tc.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g := strings.TrimSpace(string(got)); g != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, g)
+			}
+		})
+	}
+}
+
+func TestMarkdownCache(t *testing.T) {
+	m := templates.NewMarkdown(templates.WithMarkdownCache(1))
+	for _, source := range []string{"a", "b", "a", "a"} {
+		got, err := m.Render(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "<p>" + source + "</p>\n"
+		if string(got) != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestWithMarkdown(t *testing.T) {
+	tpl, err := templates.New(
+		templates.WithMarkdown(nil),
+		templates.WithTemplateFromStrings("test", `<article>{{markdown .}}</article>`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tpl.Render("test", "Hello <img src=x onerror=alert(1)> _world_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<article><p>Hello  <em>world</em></p>\n</article>"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds Prometheus template execution durations, output sizes and
+// error counters partitioned by the template name.
+type Metrics struct {
+	duration *prometheus.HistogramVec
+	size     *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// MetricsOptions holds options for NewMetrics constructor.
+type MetricsOptions struct {
+	Namespace string
+	Subsystem string
+}
+
+// NewMetrics creates new Metrics instance. Options value can be nil.
+func NewMetrics(options *MetricsOptions) (m *Metrics) {
+	if options == nil {
+		options = new(MetricsOptions)
+	}
+	if options.Subsystem == "" {
+		options.Subsystem = "templates"
+	}
+	return &Metrics{
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: options.Namespace,
+				Subsystem: options.Subsystem,
+				Name:      "render_duration_seconds",
+				Help:      "Duration of template executions, partitioned by template.",
+				Buckets:   prometheus.DefBuckets,
+			},
+			[]string{"template"},
+		),
+		size: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: options.Namespace,
+				Subsystem: options.Subsystem,
+				Name:      "render_size_bytes",
+				Help:      "Size of template outputs, partitioned by template.",
+				Buckets:   prometheus.ExponentialBuckets(256, 4, 8),
+			},
+			[]string{"template"},
+		),
+		errors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: options.Namespace,
+				Subsystem: options.Subsystem,
+				Name:      "render_errors_total",
+				Help:      "Number of failed template executions, partitioned by template.",
+			},
+			[]string{"template"},
+		),
+	}
+}
+
+// WithMetrics sets Metrics that observe executions of templates.
+func WithMetrics(m *Metrics) Option {
+	return func(o *Options) { o.metrics = m }
+}
+
+func (m *Metrics) observe(name string, duration time.Duration, size int, err error) {
+	labels := prometheus.Labels{"template": name}
+	m.duration.With(labels).Observe(duration.Seconds())
+	m.size.With(labels).Observe(float64(size))
+	if err != nil {
+		m.errors.With(labels).Inc()
+	}
+}
+
+// Metrics returns all Prometheus metrics that should be registered.
+func (m *Metrics) Metrics() (cs []prometheus.Collector) {
+	return []prometheus.Collector{m.duration, m.size, m.errors}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates_test
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"resenje.org/web/templates"
+)
+
+func TestWithMetrics(t *testing.T) {
+	metrics := templates.NewMetrics(&templates.MetricsOptions{Namespace: "test"})
+	tpl, err := templates.New(
+		templates.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		templates.WithMetrics(metrics),
+		templates.WithFunction("fail", func() (string, error) { return "", errors.New("test error") }),
+		templates.WithTemplatesFromStrings(map[string][]string{
+			"hello": {`Hello, {{.}}`},
+			"fail":  {`abc{{fail}}`},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{"Ana", strings.Repeat("x", 300)} {
+		if _, err := tpl.Render("hello", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tpl.Render("fail", nil); err == nil {
+		t.Fatal("expected render error")
+	}
+	tpl.Respond(httptest.NewRecorder(), "hello", "Đorđe")
+
+	cs := metrics.Metrics()
+	if n := testutil.CollectAndCount(cs[0], "test_templates_render_duration_seconds"); n != 2 {
+		t.Errorf("expected %v duration series, got %v", 2, n)
+	}
+
+	const wantSize = `
+# HELP test_templates_render_size_bytes Size of template outputs, partitioned by template.
+# TYPE test_templates_render_size_bytes histogram
+test_templates_render_size_bytes_bucket{template="fail",le="256"} 1
+test_templates_render_size_bytes_bucket{template="fail",le="1024"} 1
+test_templates_render_size_bytes_bucket{template="fail",le="4096"} 1
+test_templates_render_size_bytes_bucket{template="fail",le="16384"} 1
+test_templates_render_size_bytes_bucket{template="fail",le="65536"} 1
+test_templates_render_size_bytes_bucket{template="fail",le="262144"} 1
+test_templates_render_size_bytes_bucket{template="fail",le="1.048576e+06"} 1
+test_templates_render_size_bytes_bucket{template="fail",le="4.194304e+06"} 1
+test_templates_render_size_bytes_bucket{template="fail",le="+Inf"} 1
+test_templates_render_size_bytes_sum{template="fail"} 3
+test_templates_render_size_bytes_count{template="fail"} 1
+test_templates_render_size_bytes_bucket{template="hello",le="256"} 2
+test_templates_render_size_bytes_bucket{template="hello",le="1024"} 3
+test_templates_render_size_bytes_bucket{template="hello",le="4096"} 3
+test_templates_render_size_bytes_bucket{template="hello",le="16384"} 3
+test_templates_render_size_bytes_bucket{template="hello",le="65536"} 3
+test_templates_render_size_bytes_bucket{template="hello",le="262144"} 3
+test_templates_render_size_bytes_bucket{template="hello",le="1.048576e+06"} 3
+test_templates_render_size_bytes_bucket{template="hello",le="4.194304e+06"} 3
+test_templates_render_size_bytes_bucket{template="hello",le="+Inf"} 3
+test_templates_render_size_bytes_sum{template="hello"} 331
+test_templates_render_size_bytes_count{template="hello"} 3
+`
+	if err := testutil.CollectAndCompare(cs[1], strings.NewReader(wantSize)); err != nil {
+		t.Error(err)
+	}
+
+	const wantErrors = `
+# HELP test_templates_render_errors_total Number of failed template executions, partitioned by template.
+# TYPE test_templates_render_errors_total counter
+test_templates_render_errors_total{template="fail"} 1
+`
+	if err := testutil.CollectAndCompare(cs[2], strings.NewReader(wantErrors)); err != nil {
+		t.Error(err)
+	}
+}
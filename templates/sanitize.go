@@ -0,0 +1,243 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// sanitizer removes HTML elements and attributes that are not allowed.
+type sanitizer struct {
+	// elements are allowed element names with their allowed attributes.
+	elements map[string]map[string]struct{}
+}
+
+// defaultSanitizerElements are elements and attributes produced by the
+// Markdown renderer.
+var defaultSanitizerElements = map[string][]string{
+	"a":          {"href", "title"},
+	"blockquote": nil,
+	"br":         nil,
+	"code":       {"class"},
+	"del":        nil,
+	"em":         nil,
+	"h1":         nil,
+	"h2":         nil,
+	"h3":         nil,
+	"h4":         nil,
+	"h5":         nil,
+	"h6":         nil,
+	"hr":         nil,
+	"img":        {"src", "alt", "title"},
+	"li":         nil,
+	"ol":         {"start"},
+	"p":          nil,
+	"pre":        nil,
+	"strong":     nil,
+	"table":      nil,
+	"tbody":      nil,
+	"td":         {"align"},
+	"th":         {"align"},
+	"thead":      nil,
+	"tr":         nil,
+	"ul":         nil,
+}
+
+// sanitizerDropContent are elements that are removed with their content.
+var sanitizerDropContent = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Template: true,
+	atom.Textarea: true,
+	atom.Select:   true,
+	atom.Noscript: true,
+	atom.Title:    true,
+}
+
+// sanitizerURLAttrs are attributes with URL values that are allowed only
+// with safe URLs.
+var sanitizerURLAttrs = map[string]bool{
+	"action":     true,
+	"background": true,
+	"cite":       true,
+	"codebase":   true,
+	"data":       true,
+	"formaction": true,
+	"href":       true,
+	"icon":       true,
+	"longdesc":   true,
+	"manifest":   true,
+	"ping":       true,
+	"poster":     true,
+	"src":        true,
+	"srcset":     true,
+	"usemap":     true,
+	"xlink:href": true,
+}
+
+var (
+	sanitizerClassRegexp = regexp.MustCompile(`^language-[a-zA-Z0-9_+#.-]+$`)
+	sanitizerAlignRegexp = regexp.MustCompile(`^(left|right|center)$`)
+	sanitizerStartRegexp = regexp.MustCompile(`^[0-9]{1,9}$`)
+)
+
+func newSanitizer(elements map[string][]string) *sanitizer {
+	s := &sanitizer{elements: make(map[string]map[string]struct{})}
+	for _, m := range []map[string][]string{defaultSanitizerElements, elements} {
+		for name, attrs := range m {
+			a, ok := s.elements[name]
+			if !ok {
+				a = make(map[string]struct{})
+				s.elements[name] = a
+			}
+			for _, attr := range attrs {
+				a[attr] = struct{}{}
+			}
+		}
+	}
+	return s
+}
+
+// sanitize parses the HTML fragment and returns its nodes with only allowed
+// elements and attributes. Elements that are not allowed are replaced by
+// their content, except for elements like script that are removed.
+func (s *sanitizer) sanitize(fragment string) ([]*html.Node, error) {
+	context := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), context)
+	if err != nil {
+		return nil, err
+	}
+	root := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
+	s.node(root)
+	var list []*html.Node
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		list = append(list, c)
+	}
+	for _, n := range list {
+		root.RemoveChild(n)
+	}
+	return list, nil
+}
+
+// node sanitizes children of the node.
+func (s *sanitizer) node(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch c.Type {
+		case html.TextNode:
+		case html.ElementNode:
+			attrs, ok := s.elements[c.Data]
+			switch {
+			case sanitizerDropContent[c.DataAtom]:
+				n.RemoveChild(c)
+			case !ok:
+				// Children are sanitized before they are moved in place of
+				// the element, so the iteration continues after them.
+				s.node(c)
+				for gc := c.FirstChild; gc != nil; gc = c.FirstChild {
+					c.RemoveChild(gc)
+					n.InsertBefore(gc, c)
+				}
+				n.RemoveChild(c)
+			default:
+				c.Attr = sanitizeAttrs(c.Data, c.Attr, attrs)
+				s.node(c)
+			}
+		default:
+			// Comments and doctypes are removed.
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+}
+
+// sanitizeAttrs returns allowed attributes with safe values.
+func sanitizeAttrs(element string, attrs []html.Attribute, allowed map[string]struct{}) []html.Attribute {
+	var list []html.Attribute
+	for _, a := range attrs {
+		if a.Namespace != "" {
+			continue
+		}
+		if _, ok := allowed[a.Key]; !ok {
+			continue
+		}
+		if sanitizerURLAttrs[a.Key] {
+			if !safeAttrURL(a.Key, a.Val) {
+				continue
+			}
+		}
+		switch a.Key {
+		case "class":
+			if element == "code" && !sanitizerClassRegexp.MatchString(a.Val) {
+				continue
+			}
+		case "align":
+			if !sanitizerAlignRegexp.MatchString(a.Val) {
+				continue
+			}
+		case "start":
+			if !sanitizerStartRegexp.MatchString(a.Val) {
+				continue
+			}
+		case "style":
+			continue
+		}
+		if strings.HasPrefix(a.Key, "on") {
+			continue
+		}
+		list = append(list, a)
+	}
+	return list
+}
+
+// safeAttrURL returns true if all URLs of the attribute value are safe. The
+// srcset attribute value is a comma separated list of URLs with optional
+// descriptors and the ping attribute value is a space separated list of URLs.
+func safeAttrURL(key, value string) bool {
+	switch key {
+	case "srcset":
+		for _, candidate := range strings.Split(value, ",") {
+			u, _, _ := strings.Cut(strings.TrimSpace(candidate), " ")
+			if !safeURL(u) {
+				return false
+			}
+		}
+		return true
+	case "ping":
+		for _, u := range strings.Fields(value) {
+			if !safeURL(u) {
+				return false
+			}
+		}
+		return true
+	}
+	return safeURL(value)
+}
+
+// safeURL returns true for relative URLs and absolute URLs with http, https
+// and mailto schemes.
+func safeURL(s string) bool {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
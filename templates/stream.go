@@ -0,0 +1,162 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates
+
+import (
+	"errors"
+	"net/http"
+)
+
+// StreamErrorPolicy defines what is done when a template fails to execute
+// after a part of the response is already written in streaming mode. Errors
+// that occur before any output is written cause a panic, as without
+// streaming.
+type StreamErrorPolicy int
+
+const (
+	// StreamErrorLog logs the error and ends the response with the output
+	// that was generated before the error.
+	StreamErrorLog StreamErrorPolicy = iota
+	// StreamErrorAbort logs the error and aborts the response by panicking
+	// with http.ErrAbortHandler, so that the client can detect that the
+	// response is incomplete.
+	StreamErrorAbort
+	// StreamErrorMarker logs the error and ends the response with the output
+	// that was generated before the error followed by the marker set with
+	// WithStreamErrorMarker option. Without the option, the marker is
+	// "<!-- template error -->" for HTML templates and it is empty for
+	// templates parsed in text mode.
+	StreamErrorMarker
+)
+
+const defaultStreamErrorMarker = "<!-- template error -->"
+
+// streamOptions holds parameters of the streaming mode.
+type streamOptions struct {
+	chunkSize   int
+	errorPolicy StreamErrorPolicy
+	errorMarker *string
+}
+
+// marker returns the error marker for HTML or text templates.
+func (o streamOptions) marker(text bool) string {
+	switch {
+	case o.errorMarker != nil:
+		return *o.errorMarker
+	case text:
+		return ""
+	}
+	return defaultStreamErrorMarker
+}
+
+// WithStreaming enables writing of the output in chunks of the chunkSize
+// bytes by Respond functions during the template execution, instead of
+// buffering the whole output. It reduces memory usage and time to the first
+// byte for large pages, but the status is written with the first chunk, so
+// the template errors after it can not change the response. Such errors are
+// handled by the policy set with WithStreamErrorPolicy option.
+func WithStreaming(chunkSize int) Option {
+	return func(o *Options) { o.stream.chunkSize = chunkSize }
+}
+
+// WithStreamErrorPolicy sets the policy for template errors that occur after
+// a part of the response is written in streaming mode. Default is
+// StreamErrorLog.
+func WithStreamErrorPolicy(p StreamErrorPolicy) Option {
+	return func(o *Options) { o.stream.errorPolicy = p }
+}
+
+// WithStreamErrorMarker sets the string that is written at the end of the
+// response with StreamErrorMarker policy for both HTML and text templates.
+// Default is "<!-- template error -->" for HTML templates and no marker for
+// templates parsed in text mode, as the HTML comment may corrupt formats like
+// CSV or JSON.
+func WithStreamErrorMarker(marker string) Option {
+	return func(o *Options) { o.stream.errorMarker = &marker }
+}
+
+// respondStream executes the template and writes its output to the response
+// writer in chunks.
+func (t Templates) respondStream(w http.ResponseWriter, tpl parsedTemplate, name string, templateNames []string, data any, status int) {
+	sw := &streamWriter{
+		w:    w,
+		rc:   http.NewResponseController(w),
+		buf:  make([]byte, 0, t.stream.chunkSize),
+		size: t.stream.chunkSize,
+		writeHeader: func() {
+			t.writeHeader(w, name, status)
+		},
+	}
+	err := t.execute(sw, tpl, name, templateNames, data)
+	switch {
+	case sw.err != nil:
+		t.logger.Debug("templates: respond stream", "name", name, "templates", templateNames, "status", status, "error", sw.err)
+		return
+	case err == nil:
+	case !sw.started:
+		panic(err)
+	default:
+		t.logger.Error("templates: respond stream", "name", name, "templates", templateNames, "status", status, "error", err)
+		switch t.stream.errorPolicy {
+		case StreamErrorAbort:
+			panic(http.ErrAbortHandler)
+		case StreamErrorMarker:
+			sw.buf = append(sw.buf, t.stream.marker(isTextTemplate(tpl))...)
+		}
+	}
+	if err := sw.flush(); err != nil {
+		t.logger.Debug("templates: respond stream", "name", name, "templates", templateNames, "status", status, "error", err)
+	}
+}
+
+// streamWriter buffers written data and writes it to the response writer
+// when the buffer reaches its size. The header is written before the first
+// chunk.
+type streamWriter struct {
+	w           http.ResponseWriter
+	rc          *http.ResponseController
+	buf         []byte
+	size        int
+	writeHeader func()
+	started     bool
+	// err is the error from writing to the response writer which stops
+	// the template execution.
+	err error
+}
+
+func (s *streamWriter) Write(p []byte) (n int, err error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	s.buf = append(s.buf, p...)
+	if len(s.buf) >= s.size {
+		if err := s.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flush writes the buffered data and flushes the response writer.
+func (s *streamWriter) flush() error {
+	if !s.started {
+		s.writeHeader()
+		s.started = true
+	}
+	if len(s.buf) > 0 {
+		_, err := s.w.Write(s.buf)
+		s.buf = s.buf[:0]
+		if err != nil {
+			s.err = err
+			return err
+		}
+	}
+	if err := s.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		s.err = err
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"resenje.org/web/templates"
+)
+
+// chunkRecorder records every write and flush to the response.
+type chunkRecorder struct {
+	*httptest.ResponseRecorder
+	chunks  []string
+	flushes int
+}
+
+func newChunkRecorder() *chunkRecorder {
+	return &chunkRecorder{ResponseRecorder: httptest.NewRecorder()}
+}
+
+func (r *chunkRecorder) Write(p []byte) (int, error) {
+	r.chunks = append(r.chunks, string(p))
+	return r.ResponseRecorder.Write(p)
+}
+
+func (r *chunkRecorder) Flush() {
+	r.flushes++
+	r.ResponseRecorder.Flush()
+}
+
+func newStreamTemplates(t *testing.T, logger *slog.Logger, options ...templates.Option) *templates.Templates {
+	t.Helper()
+
+	tpl, err := templates.New(append([]templates.Option{
+		templates.WithLogger(logger),
+		templates.WithStreaming(4),
+		templates.WithFunction("fail", func() (string, error) { return "", errors.New("test error") }),
+		templates.WithTemplatesFromStrings(map[string][]string{
+			"page":       {`{{range .}}{{.}}{{end}}`},
+			"late error": {`abcdef{{"gh"}}{{fail}}ij`},
+			"early":      {`ab{{fail}}`},
+		}),
+	}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tpl
+}
+
+func TestWithStreaming(t *testing.T) {
+	tpl := newStreamTemplates(t, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	w := newChunkRecorder()
+	tpl.RespondWithStatus(w, "page", []string{"ab", "cd", "ef", "gh", "ij"}, http.StatusAccepted)
+
+	if w.Code != http.StatusAccepted {
+		t.Errorf("expected status %d, got %d", http.StatusAccepted, w.Code)
+	}
+	if want := []string{"abcd", "efgh", "ij"}; !reflect.DeepEqual(w.chunks, want) {
+		t.Errorf("expected chunks %q, got %q", want, w.chunks)
+	}
+	if w.flushes != 3 {
+		t.Errorf("expected %d flushes, got %d", 3, w.flushes)
+	}
+}
+
+func TestWithStreaming_errorBeforeOutput(t *testing.T) {
+	tpl := newStreamTemplates(t, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	w := newChunkRecorder()
+	err := recoverError(func() { tpl.Respond(w, "early", nil) })
+	if err == nil || !strings.Contains(err.Error(), "test error") {
+		t.Errorf("expected test error panic, got %v", err)
+	}
+	if len(w.chunks) != 0 {
+		t.Errorf("expected no written chunks, got %q", w.chunks)
+	}
+}
+
+func TestWithStreamErrorPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy templates.StreamErrorPolicy
+		body   string
+		panic  error
+	}{
+		{name: "log", policy: templates.StreamErrorLog, body: "abcdefgh"},
+		{name: "marker", policy: templates.StreamErrorMarker, body: "abcdefgh<!-- template error -->"},
+		{name: "abort", policy: templates.StreamErrorAbort, body: "abcdef", panic: http.ErrAbortHandler},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var log bytes.Buffer
+			tpl := newStreamTemplates(t, slog.New(slog.NewTextHandler(&log, nil)), templates.WithStreamErrorPolicy(tc.policy))
+
+			w := newChunkRecorder()
+			err := recoverError(func() { tpl.RespondWithStatus(w, "late error", nil, http.StatusCreated) })
+			if !errors.Is(err, tc.panic) {
+				t.Errorf("expected panic %v, got %v", tc.panic, err)
+			}
+			if w.Code != http.StatusCreated {
+				t.Errorf("expected status %d, got %d", http.StatusCreated, w.Code)
+			}
+			if got := w.Body.String(); got != tc.body {
+				t.Errorf("expected body %q, got %q", tc.body, got)
+			}
+			if got := log.String(); !strings.Contains(got, "level=ERROR") || !strings.Contains(got, "templates: respond stream") || !strings.Contains(got, "test error") {
+				t.Errorf("expected logged error, got %q", got)
+			}
+		})
+	}
+}
+
+// recoverError calls the function and returns the recovered panic as an
+// error.
+func recoverError(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var ok bool
+			if err, ok = r.(error); !ok {
+				err = errors.New(r.(string))
+			}
+		}
+	}()
+	fn()
+	return nil
+}
@@ -9,10 +9,19 @@ import (
 	"bytes"
 	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
 	"log/slog"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"resenje.org/web"
 )
 
 // Error is a common error type that holds
@@ -29,6 +38,32 @@ func (e *Error) Error() string {
 	return fmt.Sprintf("%s: %s", e.Err.Error(), e.Template)
 }
 
+// FileError is returned when a template file can not be parsed. It holds the
+// filename and the line in the file where the error occurred, if it is known.
+type FileError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func newFileError(file string, err error) *FileError {
+	e := &FileError{File: file, Err: err}
+	if m := errorLineRegexp.FindStringSubmatch(err.Error()); m != nil {
+		e.Line, _ = strconv.Atoi(m[1])
+	}
+	return e
+}
+
+var errorLineRegexp = regexp.MustCompile(`^template: [^:]*:(\d+):`)
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("parse template file %s: %v", e.File, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
 // FileReadFunc returns the content of file referenced
 // by filename. It hes the same signature as os.ReadFile
 // function.
@@ -42,16 +77,36 @@ var ErrUnknownTemplate = fmt.Errorf("unknown template")
 type Options struct {
 	fileFindFunc     func(filename string) string
 	fileReadFunc     FileReadFunc
+	fileGlobFunc     func(pattern string) ([]string, error)
+	fileWalkFunc     func(root string, fn fs.WalkDirFunc) error
+	fileStatFunc     func(filename string) (fs.FileInfo, error)
+	dirs             []templatesDir
 	fileReadOnRender bool
+	watchInterval    time.Duration
+	stream           streamOptions
+	fragment         fragmentOptions
+	metrics          *Metrics
 	contentType      string
+	contentTypes     map[string]string
+	textMode         bool
+	textSuffixes     []string
 	files            map[string][]string
 	strings          map[string][]string
+	layouts          map[string][]string
+	pageLayouts      map[string]string
+	partials         []string
 	functions        template.FuncMap
 	delimOpen        string
 	delimClose       string
 	logger           *slog.Logger
 }
 
+// templatesDir holds arguments of WithTemplatesFromDir option.
+type templatesDir struct {
+	dir    string
+	shared []string
+}
+
 // Option sets parameters used in New function.
 type Option func(*Options)
 
@@ -84,16 +139,53 @@ func WithFileReadFunc(fn FileReadFunc) Option {
 	return func(o *Options) { o.fileReadFunc = fn }
 }
 
+// WithFS sets the filesystem from which template files are read, for
+// example the one embedded with go:embed directive. Files are referenced by
+// slash-separated paths, relative to the directory set with WithBaseDir.
+func WithFS(fsys fs.FS) Option {
+	return func(o *Options) {
+		o.fileReadFunc = func(filename string) ([]byte, error) {
+			return fs.ReadFile(fsys, filename)
+		}
+		o.fileGlobFunc = func(pattern string) ([]string, error) {
+			return fs.Glob(fsys, pattern)
+		}
+		o.fileWalkFunc = func(root string, fn fs.WalkDirFunc) error {
+			return fs.WalkDir(fsys, root, fn)
+		}
+		o.fileStatFunc = func(filename string) (fs.FileInfo, error) {
+			return fs.Stat(fsys, filename)
+		}
+	}
+}
+
 // WithFileReadOnRender forces template files to be read and
 // parsed every time Render or Respond functions are called.
 // This is useful for quickly reloading template files,
 // but with a performance cost. This functionality
-// is disabled by default.
+// is disabled by default. WithWatch option reloads
+// only changed templates without this cost.
 func WithFileReadOnRender(yes bool) Option {
 	return func(o *Options) { o.fileReadOnRender = yes }
 }
 
-// WithTemplateFromFiles adds a template parsed from files.
+// WithWatch enables reloading of templates in development by checking
+// modification times and sizes of template files every interval. Only
+// templates that are parsed from changed files are parsed again, after the
+// files have not changed for one more interval, and they are replaced
+// atomically. If parsing fails, the error is logged with the
+// filename and line, and the last successfully parsed version of the
+// template is used. Directories from WithTemplatesFromDir option are scanned
+// on every check, so that templates for new files are added, while templates
+// of removed files are kept. Unlike WithFileReadOnRender, rendering does not
+// read files. Watching is stopped by the Close method.
+func WithWatch(interval time.Duration) Option {
+	return func(o *Options) { o.watchInterval = interval }
+}
+
+// WithTemplateFromFiles adds a template parsed from files. Filenames can be
+// glob patterns, like "layouts/*.html", and files that match them are parsed
+// in lexical order.
 func WithTemplateFromFiles(name string, files ...string) Option {
 	return func(o *Options) { o.files[name] = files }
 }
@@ -107,6 +199,17 @@ func WithTemplatesFromFiles(ts map[string][]string) Option {
 	}
 }
 
+// WithTemplatesFromDir adds templates for every file in the directory and
+// its subdirectories, except the ones with names that start with "." or "_".
+// Templates are named by file paths relative to the directory without the
+// extension, so that the file "pages/users/list.html" from the directory
+// "pages" is the template "users/list". Every template is parsed from shared
+// files, which can be glob patterns like "layouts/*.html", followed by its
+// file, so that the file can define blocks used by the shared layouts.
+func WithTemplatesFromDir(dir string, shared ...string) Option {
+	return func(o *Options) { o.dirs = append(o.dirs, templatesDir{dir: dir, shared: shared}) }
+}
+
 // WithTemplateFromStrings adds a template parsed from string.
 func WithTemplateFromStrings(name string, strings ...string) Option {
 	return func(o *Options) { o.strings[name] = strings }
@@ -135,6 +238,43 @@ func WithFunctions(fns template.FuncMap) Option {
 	}
 }
 
+// WithMessageCatalog adds functions that translate messages and form errors,
+// and format numbers and dates using the message catalog:
+//
+//	{{t . "welcome" "name" .User.Name}}
+//	{{tn . "unread_messages" .Unread}}
+//	{{relative_time .Created .}}
+//	{{number . .Total 2}}
+//	{{currency . .Price "EUR"}}
+//	{{date . .Created "long"}}
+//	{{range field_errors .Errors "email" .Locale}}<p>{{.}}</p>{{end}}
+//	{{range form_errors .Errors .Locale}}<p>{{.}}</p>{{end}}
+//
+// The first argument of t, tn, number, currency and date functions, and the
+// optional last argument of relative_time, is the source of the locale. It
+// can be a locale string, context.Context or *http.Request with the locale
+// stored by web.LocaleHandler, a value with the Locale method or field, or a
+// map with the "Locale" key, which is usually the template data. The locale
+// is usually chosen by web.LocaleHandler or negotiated with the
+// MessageCatalog.Negotiate method. Formats can be overridden by messages in
+// the catalog with codes "number.decimal", "number.group",
+// "currency.pattern", "currency.<CODE>", "date.short", "date.medium",
+// "date.long", "month.<1-12>", "month_short.<1-12>", "relative_time.now" and
+// plural "relative_time.<seconds|minutes|hours|days|months|years>".
+func WithMessageCatalog(c *web.MessageCatalog) Option {
+	return func(o *Options) {
+		tr := translator{catalog: c}
+		o.functions["t"] = tr.translate
+		o.functions["tn"] = tr.translatePlural
+		o.functions["relative_time"] = tr.relativeTime
+		o.functions["number"] = tr.number
+		o.functions["currency"] = tr.currency
+		o.functions["date"] = tr.date
+		o.functions["field_errors"] = newFieldErrorsFunc(c)
+		o.functions["form_errors"] = newFormErrorsFunc(c)
+	}
+}
+
 // WithDelims sets the delimiters used in templates.
 func WithDelims(open, close string) Option {
 	return func(o *Options) {
@@ -151,10 +291,17 @@ func WithLogger(l *slog.Logger) Option {
 
 // Templates structure holds parsed templates.
 type Templates struct {
-	templates   map[string]*template.Template
-	parseFiles  func(name string) (*template.Template, error)
-	contentType string
-	logger      *slog.Logger
+	templates    map[string]parsedTemplate
+	files        map[string][]string
+	parseFiles   func(name string) (parsedTemplate, error)
+	watcher      *watcher
+	sourceFile   func(name, define string) (templateFile, error)
+	stream       streamOptions
+	fragment     fragmentOptions
+	metrics      *Metrics
+	contentType  string
+	contentTypes map[string]string
+	logger       *slog.Logger
 }
 
 // New creates a new instance of Templates and parses
@@ -169,95 +316,111 @@ func New(opts ...Option) (t *Templates, err error) {
 			return f
 		},
 		fileReadFunc: os.ReadFile,
+		fileGlobFunc: filepath.Glob,
+		fileWalkFunc: filepath.WalkDir,
+		fileStatFunc: os.Stat,
+		contentTypes: map[string]string{},
 		files:        map[string][]string{},
+		strings:      map[string][]string{},
+		layouts:      map[string][]string{},
+		pageLayouts:  map[string]string{},
 		functions:    functions,
 		delimOpen:    "{{",
 		delimClose:   "}}",
-		logger:       slog.Default(),
+		fragment: fragmentOptions{
+			header:       "HX-Request",
+			targetHeader: "HX-Target",
+			block:        "content",
+		},
+		logger: slog.Default(),
 	}
 	for _, opt := range opts {
 		opt(o)
 	}
 
 	t = &Templates{
-		templates:   map[string]*template.Template{},
-		contentType: o.contentType,
-		logger:      o.logger,
+		templates:    map[string]parsedTemplate{},
+		files:        o.files,
+		sourceFile:   o.sourceFile,
+		stream:       o.stream,
+		fragment:     o.fragment,
+		metrics:      o.metrics,
+		contentType:  o.contentType,
+		contentTypes: o.contentTypes,
+		logger:       o.logger,
+	}
+	var w *watcher
+	if o.watchInterval > 0 && !o.fileReadOnRender {
+		w = newWatcher(o, t)
+		t.watcher = w
 	}
 	for name, strings := range o.strings {
-		tpl, err := parseStrings(template.New("").Funcs(o.functions).Delims(o.delimOpen, o.delimClose), strings...)
+		tpl, sources, err := o.parseStrings(name, strings)
 		if err != nil {
 			return nil, err
 		}
 		t.templates[name] = tpl
+		if w != nil {
+			name, strings := name, strings
+			w.add(name, sources, func() (parsedTemplate, []string, error) {
+				return o.parseStrings(name, strings)
+			})
+		}
 	}
 
-	parse := func(files []string) (tpl *template.Template, err error) {
-		fs := []string{}
-		for _, f := range files {
-			fs = append(fs, o.fileFindFunc(f))
+	for _, d := range o.dirs {
+		if err := discoverTemplates(o, d, o.files); err != nil {
+			return nil, err
 		}
-		return parseFiles(o.fileReadFunc, template.New("").Funcs(o.functions).Delims(o.delimOpen, o.delimClose), fs...)
 	}
 
+	for name, files := range o.files {
+		tpl, sources, err := o.parseTemplate(name, files)
+		if err != nil {
+			return nil, err
+		}
+		if !o.fileReadOnRender {
+			t.templates[name] = tpl
+		}
+		if w != nil {
+			name, files := name, files
+			w.add(name, sources, func() (parsedTemplate, []string, error) {
+				return o.parseTemplate(name, files)
+			})
+		}
+	}
 	if o.fileReadOnRender {
-		t.parseFiles = func(name string) (tpl *template.Template, err error) {
+		t.parseFiles = func(name string) (tpl parsedTemplate, err error) {
 			files, ok := o.files[name]
 			if !ok {
 				return nil, &Error{Err: ErrUnknownTemplate, Template: name}
 			}
-			return parse(files)
-		}
-	} else {
-		for name, files := range o.files {
-			tpl, err := parse(files)
-			if err != nil {
-				return nil, err
-			}
-			t.templates[name] = tpl
+			tpl, _, err = o.parseTemplate(name, files)
+			return tpl, err
 		}
 	}
+	if w != nil {
+		go w.run(o.watchInterval)
+	}
 	return
 }
 
 // RespondTemplateWithStatus executes a named template with provided data into buffer,
 // then writes the the status and body to the response writer.
+// If streaming is enabled with WithStreaming option, the body is written in chunks
+// during the execution.
 // A panic will be raised if the template does not exist or fails to execute.
 func (t Templates) RespondTemplateWithStatus(w http.ResponseWriter, name, templateName string, data any, status int) {
-	tpl := t.mustTemplate(name)
-	buf := bytes.Buffer{}
-	if err := tpl.ExecuteTemplate(&buf, templateName, data); err != nil {
-		panic(err)
-	}
-	if t.contentType != "" {
-		w.Header().Set("Content-Type", t.contentType)
-	}
-	if status > 0 {
-		w.WriteHeader(status)
-	}
-	if _, err := buf.WriteTo(w); err != nil {
-		t.logger.Debug("templates: respond template with status", "name", name, "template", templateName, "status", status, "error", err)
-	}
+	t.respond(w, name, templateName, data, status)
 }
 
 // RespondWithStatus executes a template with provided data into buffer,
 // then writes the the status and body to the response writer.
+// If streaming is enabled with WithStreaming option, the body is written in chunks
+// during the execution.
 // A panic will be raised if the template does not exist or fails to execute.
 func (t Templates) RespondWithStatus(w http.ResponseWriter, name string, data any, status int) {
-	tpl := t.mustTemplate(name)
-	buf := bytes.Buffer{}
-	if err := tpl.Execute(&buf, data); err != nil {
-		panic(err)
-	}
-	if t.contentType != "" {
-		w.Header().Set("Content-Type", t.contentType)
-	}
-	if status > 0 {
-		w.WriteHeader(status)
-	}
-	if _, err := buf.WriteTo(w); err != nil {
-		t.logger.Debug("templates: respond with status", "name", name, "status", status, "error", err)
-	}
+	t.respond(w, name, "", data, status)
 }
 
 // RespondTemplate executes a named template with provided data into buffer,
@@ -278,7 +441,7 @@ func (t Templates) Respond(w http.ResponseWriter, name string, data any) {
 func (t Templates) RenderTemplate(name, templateName string, data any) (s string, err error) {
 	tpl := t.mustTemplate(name)
 	buf := bytes.Buffer{}
-	if err := tpl.ExecuteTemplate(&buf, templateName, data); err != nil {
+	if err := t.execute(&buf, tpl, name, []string{templateName}, data); err != nil {
 		return "", err
 	}
 	return buf.String(), nil
@@ -288,47 +451,181 @@ func (t Templates) RenderTemplate(name, templateName string, data any) (s string
 func (t Templates) Render(name string, data any) (s string, err error) {
 	tpl := t.mustTemplate(name)
 	buf := bytes.Buffer{}
-	if err := tpl.Execute(&buf, data); err != nil {
+	if err := t.execute(&buf, tpl, name, []string{""}, data); err != nil {
 		return "", err
 	}
 	return buf.String(), nil
 }
 
-func (t Templates) mustTemplate(name string) (tpl *template.Template) {
-	tpl, ok := t.templates[name]
-	if ok {
-		return tpl
+// respond executes the template and writes the status and the body to the
+// response writer. Only blocks of the template are executed for fragment
+// requests.
+func (t Templates) respond(w http.ResponseWriter, name, templateName string, data any, status int) {
+	tpl := t.mustTemplate(name)
+	blocks := []string{templateName}
+	if templateName == "" {
+		if f := fragmentFromWriter(w); f != nil {
+			blocks = f.blocks(tpl)
+		}
 	}
-	if t.parseFiles != nil {
-		tpl, err := t.parseFiles(name)
+	if t.stream.chunkSize > 0 {
+		t.respondStream(w, tpl, name, blocks, data, status)
+		return
+	}
+	buf := bytes.Buffer{}
+	if err := t.execute(&buf, tpl, name, blocks, data); err != nil {
+		panic(err)
+	}
+	t.writeHeader(w, name, status)
+	if _, err := buf.WriteTo(w); err != nil {
+		t.logger.Debug("templates: respond", "name", name, "template", templateName, "status", status, "error", err)
+	}
+}
+
+// writeHeader sets the content type header of the named template and writes
+// the status.
+func (t Templates) writeHeader(w http.ResponseWriter, name string, status int) {
+	contentType, ok := t.contentTypes[name]
+	if !ok {
+		contentType = t.contentType
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	if status > 0 {
+		w.WriteHeader(status)
+	}
+}
+
+// execute executes associated templates in order, where the empty name is
+// the template itself, and records metrics.
+func (t Templates) execute(w io.Writer, tpl parsedTemplate, name string, templateNames []string, data any) (err error) {
+	start := time.Now()
+	cw := &countWriter{w: w}
+	var templateName string
+	for _, templateName = range templateNames {
+		if templateName == "" {
+			err = tpl.Execute(cw, data)
+		} else {
+			err = tpl.ExecuteTemplate(cw, templateName, data)
+		}
 		if err != nil {
-			panic(err)
+			break
 		}
-		return tpl
 	}
-	panic(&Error{Err: ErrUnknownTemplate, Template: name})
+	if t.metrics != nil {
+		t.metrics.observe(name, time.Since(start), cw.n, err)
+	}
+	if err != nil {
+		return t.newExecuteError(name, templateName, data, err)
+	}
+	return nil
+}
+
+// countWriter counts the number of written bytes.
+type countWriter struct {
+	w io.Writer
+	n int
+}
+
+func (w *countWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	w.n += n
+	return n, err
+}
+
+// Close stops watching template files enabled by WithWatch option.
+func (t Templates) Close() error {
+	if t.watcher != nil {
+		t.watcher.stop()
+	}
+	return nil
+}
+
+func (t Templates) mustTemplate(name string) (tpl parsedTemplate) {
+	tpl, err := t.template(name)
+	if err != nil {
+		panic(err)
+	}
+	return tpl
+}
+
+func (t Templates) template(name string) (parsedTemplate, error) {
+	if tpl, ok := t.lookup(name); ok {
+		return tpl, nil
+	}
+	if t.parseFiles != nil {
+		return t.parseFiles(name)
+	}
+	return nil, &Error{Err: ErrUnknownTemplate, Template: name}
+}
+
+// has returns true if the template with the name exists.
+func (t Templates) has(name string) bool {
+	if _, ok := t.lookup(name); ok {
+		return true
+	}
+	_, ok := t.files[name]
+	return ok
 }
 
-func parseFiles(fn FileReadFunc, t *template.Template, filenames ...string) (*template.Template, error) {
-	for _, filename := range filenames {
-		b, err := fn(filename)
+// lookup returns the parsed template, guarding it from replacement by the
+// watcher.
+func (t Templates) lookup(name string) (parsedTemplate, bool) {
+	if t.watcher != nil {
+		t.watcher.mu.RLock()
+		defer t.watcher.mu.RUnlock()
+	}
+	tpl, ok := t.templates[name]
+	return tpl, ok
+}
+
+// discoverTemplates adds templates for files in the directory to the files
+// map.
+func discoverTemplates(o *Options, d templatesDir, files map[string][]string) error {
+	root := o.fileFindFunc(d.dir)
+	return o.fileWalkFunc(root, func(p string, e fs.DirEntry, err error) error {
 		if err != nil {
-			return nil, fmt.Errorf("read template file %s: %v", filename, err)
+			return fmt.Errorf("discover templates in %s: %v", d.dir, err)
 		}
-		_, err = t.Parse(string(b))
-		if err != nil {
-			return nil, fmt.Errorf("parse template file %s: %v", filename, err)
+		name := e.Name()
+		if p != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			if e.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
-	}
-	return t, nil
+		if e.IsDir() {
+			return nil
+		}
+		rel := filepath.ToSlash(strings.TrimPrefix(strings.TrimPrefix(p, root), string(filepath.Separator)))
+		rel = strings.TrimPrefix(rel, "/")
+		files[strings.TrimSuffix(rel, path.Ext(rel))] = append(append([]string(nil), d.shared...), path.Join(d.dir, rel))
+		return nil
+	})
 }
 
-func parseStrings(t *template.Template, strings ...string) (*template.Template, error) {
+func hasGlobMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// parseStrings parses a template from partials followed by strings. It
+// returns the template and filenames or glob patterns of the partials.
+func (o *Options) parseStrings(name string, strings []string) (parsedTemplate, []string, error) {
+	partials, err := o.readFiles(o.partials)
+	if err != nil {
+		return nil, nil, err
+	}
+	t := o.newTemplate(name)
+	for _, f := range partials {
+		if err := parseFile(t, f); err != nil {
+			return nil, nil, err
+		}
+	}
 	for _, str := range strings {
-		_, err := t.Parse(str)
-		if err != nil {
-			return nil, err
+		if err := t.parse(str); err != nil {
+			return nil, nil, err
 		}
 	}
-	return t, nil
+	return t, o.partials, nil
 }
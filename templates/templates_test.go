@@ -0,0 +1,151 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/web/templates"
+)
+
+func TestWithFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/layout.html": {Data: []byte(`<main>{{block "content" .}}{{end}}</main>`)},
+		"templates/index.html":  {Data: []byte(`{{define "content"}}Hello, {{.}}{{end}}`)},
+	}
+	tpl, err := templates.New(
+		templates.WithFS(fsys),
+		templates.WithBaseDir("templates"),
+		templates.WithTemplateFromFiles("index", "layout.html", "index.html"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := tpl.Render("index", "Ana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<main>Hello, Ana</main>"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	_, err = templates.New(
+		templates.WithFS(fsys),
+		templates.WithTemplateFromFiles("missing", "templates/missing.html"),
+	)
+	if err == nil || !strings.Contains(err.Error(), "templates/missing.html") {
+		t.Errorf("expected missing file error, got %v", err)
+	}
+}
+
+// reverseGlobFS returns glob matches in the reverse lexical order.
+type reverseGlobFS struct {
+	fstest.MapFS
+}
+
+func (f reverseGlobFS) Glob(pattern string) ([]string, error) {
+	matches, err := f.MapFS.Glob(pattern)
+	slices.Reverse(matches)
+	return matches, err
+}
+
+func TestWithTemplateFromFiles_glob(t *testing.T) {
+	fsys := reverseGlobFS{fstest.MapFS{
+		"parts/a.html": {Data: []byte(`{{define "a"}}A{{end}}{{define "last"}}a{{end}}`)},
+		"parts/b.html": {Data: []byte(`{{define "b"}}B{{end}}{{define "last"}}b{{end}}`)},
+		"parts/c.txt":  {Data: []byte(`{{define "c"}}C{{end}}`)},
+		"page.html":    {Data: []byte(`{{template "a"}}{{template "b"}}{{template "last"}}`)},
+	}}
+
+	tpl, err := templates.New(
+		templates.WithFS(fsys),
+		templates.WithTemplateFromFiles("page", "parts/*.html", "page.html"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tpl.Render("page", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ABb"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	_, err = templates.New(
+		templates.WithFS(fsys),
+		templates.WithTemplateFromFiles("page", "layouts/*.html", "page.html"),
+	)
+	if err == nil || !strings.Contains(err.Error(), "layouts/*.html: no matches") {
+		t.Errorf("expected no matches error, got %v", err)
+	}
+}
+
+func TestWithTemplatesFromDir(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.html":         {Data: []byte(`[{{block "content" .}}{{end}}]`)},
+		"pages/index.html":          {Data: []byte(`{{define "content"}}index{{end}}`)},
+		"pages/users/list.html":     {Data: []byte(`{{define "content"}}users {{.}}{{end}}`)},
+		"pages/_partial.html":       {Data: []byte(`{{define "content"}}partial{{end}}`)},
+		"pages/.hidden.html":        {Data: []byte(`{{define "content"}}hidden{{end}}`)},
+		"pages/_drafts/draft.html":  {Data: []byte(`{{define "content"}}draft{{end}}`)},
+		"pages/.git/config":         {Data: []byte(`{{`)},
+		"pages/users/_row.html":     {Data: []byte(`{{define "content"}}row{{end}}`)},
+		"pages/users/.editor.swp":   {Data: []byte(`{{`)},
+		"pages/users/detail/a.html": {Data: []byte(`{{define "content"}}detail{{end}}`)},
+	}
+
+	tpl, err := templates.New(
+		templates.WithFS(fsys),
+		templates.WithTemplatesFromDir("pages", "layouts/*.html"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"index":          "[index]",
+		"users/list":     "[users 1]",
+		"users/detail/a": "[detail]",
+	} {
+		got, err := tpl.Render(name, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+
+	for _, name := range []string{"_partial", ".hidden", "_drafts/draft", ".git/config", "users/_row", "users/.editor"} {
+		if _, err := render(tpl, name); err == nil {
+			t.Errorf("%s: expected unknown template error", name)
+		}
+	}
+
+	_, err = templates.New(
+		templates.WithFS(fsys),
+		templates.WithTemplatesFromDir("missing"),
+	)
+	if err == nil || !strings.Contains(err.Error(), "discover templates in missing") {
+		t.Errorf("expected discover error, got %v", err)
+	}
+}
+
+// render renders the template, returning the panic for unknown templates as
+// an error.
+func render(tpl *templates.Templates, name string) (s string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, _ = r.(error)
+		}
+	}()
+	return tpl.Render(name, nil)
+}
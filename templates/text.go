@@ -0,0 +1,135 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	texttemplate "text/template"
+	"text/template/parse"
+)
+
+// WithTextMode parses templates with text/template package instead of
+// html/template, for outputs that are not HTML, like plain text emails, CSV
+// exports, configuration files or Markdown. All other options apply in the
+// same way, but template output is not escaped. The content type should be
+// set with WithContentType or WithTemplateContentType options.
+func WithTextMode(yes bool) Option {
+	return func(o *Options) { o.textMode = yes }
+}
+
+// WithTextSuffixes parses templates with names that end with one of the
+// suffixes with text/template package, as with WithTextMode option, so that
+// HTML and plain text templates can be used together, for example ".txt" and
+// ".subject" templates of EmailRenderer.
+func WithTextSuffixes(suffixes ...string) Option {
+	return func(o *Options) { o.textSuffixes = append(o.textSuffixes, suffixes...) }
+}
+
+// WithTemplateContentType sets the content type HTTP header that will be
+// written by Respond functions for the named template, instead of the one set
+// by WithContentType option.
+func WithTemplateContentType(name, contentType string) Option {
+	return func(o *Options) { o.contentTypes[name] = contentType }
+}
+
+// parsedTemplate is a set of associated templates parsed by html/template or
+// text/template package.
+type parsedTemplate interface {
+	Execute(w io.Writer, data any) error
+	ExecuteTemplate(w io.Writer, name string, data any) error
+	// parse parses the text as the template body, adding associated
+	// templates that it defines.
+	parse(text string) error
+	// tree returns the parse tree of the associated template, or nil if it is
+	// not defined.
+	tree(name string) *parse.Tree
+	// trees returns parse trees of all associated templates.
+	trees() []*parse.Tree
+}
+
+// newTemplate returns an empty template for the named template with functions
+// and delimiters from options.
+func (o *Options) newTemplate(name string) parsedTemplate {
+	if o.isText(name) {
+		return textTemplate{texttemplate.New("").Funcs(texttemplate.FuncMap(o.functions)).Delims(o.delimOpen, o.delimClose)}
+	}
+	return htmlTemplate{htmltemplate.New("").Funcs(o.functions).Delims(o.delimOpen, o.delimClose)}
+}
+
+// isText returns true if the named template is parsed with text/template
+// package.
+func (o *Options) isText(name string) bool {
+	if o.textMode {
+		return true
+	}
+	for _, suffix := range o.textSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTextTemplate returns true if the template is parsed with text/template
+// package.
+func isTextTemplate(tpl parsedTemplate) bool {
+	_, ok := tpl.(textTemplate)
+	return ok
+}
+
+type htmlTemplate struct {
+	*htmltemplate.Template
+}
+
+func (t htmlTemplate) parse(text string) error {
+	_, err := t.Parse(text)
+	return err
+}
+
+func (t htmlTemplate) tree(name string) *parse.Tree {
+	if tpl := t.Lookup(name); tpl != nil {
+		return tpl.Tree
+	}
+	return nil
+}
+
+func (t htmlTemplate) trees() []*parse.Tree {
+	var trees []*parse.Tree
+	for _, tpl := range t.Templates() {
+		if tpl.Tree != nil {
+			trees = append(trees, tpl.Tree)
+		}
+	}
+	return trees
+}
+
+type textTemplate struct {
+	*texttemplate.Template
+}
+
+func (t textTemplate) parse(text string) error {
+	_, err := t.Parse(text)
+	return err
+}
+
+func (t textTemplate) tree(name string) *parse.Tree {
+	if tpl := t.Lookup(name); tpl != nil {
+		return tpl.Tree
+	}
+	return nil
+}
+
+func (t textTemplate) trees() []*parse.Tree {
+	var trees []*parse.Tree
+	for _, tpl := range t.Templates() {
+		if tpl.Tree != nil {
+			trees = append(trees, tpl.Tree)
+		}
+	}
+	return trees
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates_test
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"resenje.org/web/templates"
+)
+
+func TestTextMode(t *testing.T) {
+	tpl, err := templates.New(
+		templates.WithTextMode(true),
+		templates.WithDelims("[[", "]]"),
+		templates.WithFunction("first_exclaim", func(s string) string { return s[:1] + "!" }),
+		templates.WithContentType("text/plain; charset=utf-8"),
+		templates.WithTemplateContentType("report.csv", "text/csv; charset=utf-8"),
+		templates.WithTemplatesFromStrings(map[string][]string{
+			"report.csv": {`[[define "row"]][[.Name]],[[.Note]][[end]]name,note` + "\n" + `[[range .]][[template "row" .]]` + "\n" + `[[end]]`},
+			"note":       {`<[[first_exclaim .]]> & more`},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := tpl.Render("note", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<h!> & more"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		data        any
+		body        string
+		contentType string
+	}{
+		{
+			name:        "report.csv",
+			data:        []map[string]string{{"Name": "Ana", "Note": "<b>"}, {"Name": "Đorđe", "Note": "a&b"}},
+			body:        "name,note\nAna,<b>\nĐorđe,a&b\n",
+			contentType: "text/csv; charset=utf-8",
+		},
+		{
+			name:        "note",
+			data:        "x",
+			body:        "<x!> & more",
+			contentType: "text/plain; charset=utf-8",
+		},
+	} {
+		r := httptest.NewRecorder()
+		tpl.RespondWithStatus(r, tc.name, tc.data, http.StatusCreated)
+		if r.Code != http.StatusCreated {
+			t.Errorf("%s: expected status %d, got %d", tc.name, http.StatusCreated, r.Code)
+		}
+		if got := r.Body.String(); got != tc.body {
+			t.Errorf("%s: expected body %q, got %q", tc.name, tc.body, got)
+		}
+		if got := r.Header().Get("Content-Type"); got != tc.contentType {
+			t.Errorf("%s: expected content type %q, got %q", tc.name, tc.contentType, got)
+		}
+	}
+}
+
+func TestTextModeFileReadOnRender(t *testing.T) {
+	files := map[string]string{
+		"base.txt":  `Subject: [[block "subject" .]][[end]]` + "\n\n" + `[[block "body" .]][[end]]`,
+		"reset.txt": `[[/* layout "base" */]][[define "subject"]]Reset <[[.]]>[[end]][[define "body"]]Code: [[.]][[end]]`,
+	}
+	tpl, err := templates.New(
+		templates.WithTextMode(true),
+		templates.WithDelims("[[", "]]"),
+		templates.WithFileReadFunc(func(filename string) ([]byte, error) {
+			return []byte(files[filename]), nil
+		}),
+		templates.WithFileReadOnRender(true),
+		templates.WithLayout("base", "base.txt"),
+		templates.WithTemplateFromFiles("reset", "reset.txt"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := tpl.Render("reset", "a&b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Subject: Reset <a&b>\n\nCode: a&b"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	files["reset.txt"] = `[[/* layout "base" */]][[define "subject"]]Changed[[end]][[define "body"]][[.]][[end]]`
+	got, err = tpl.Render("reset", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Subject: Changed\n\n1"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestTextModeStreamErrorMarker(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		template string
+		options  []templates.Option
+		want     string
+	}{
+		{
+			name:     "html",
+			template: "page",
+			want:     "<p>a<!-- template error -->",
+		},
+		{
+			name:     "text",
+			template: "report.csv",
+			options:  []templates.Option{templates.WithTextSuffixes(".csv")},
+			want:     "a,b\n",
+		},
+		{
+			name:     "text with marker",
+			template: "report.csv",
+			options: []templates.Option{
+				templates.WithTextSuffixes(".csv"),
+				templates.WithStreamErrorMarker("# error\n"),
+			},
+			want: "a,b\n# error\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tpl, err := templates.New(append([]templates.Option{
+				templates.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+				templates.WithStreaming(1),
+				templates.WithStreamErrorPolicy(templates.StreamErrorMarker),
+				templates.WithFunction("fail", func() (string, error) { return "", errors.New("test error") }),
+				templates.WithTemplatesFromStrings(map[string][]string{
+					"page":       {`<p>a{{fail}}</p>`},
+					"report.csv": {"a,b\n{{fail}}"},
+				}),
+			}, tc.options...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRecorder()
+			tpl.Respond(r, tc.template, nil)
+			if got := r.Body.String(); got != tc.want {
+				t.Errorf("expected body %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
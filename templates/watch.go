@@ -0,0 +1,176 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// watcher polls template files and parses again templates which files have
+// changed.
+type watcher struct {
+	o       *Options
+	t       *Templates
+	mu      sync.RWMutex // guards templates of t
+	entries map[string]*watchEntry
+	quit    chan struct{}
+	once    sync.Once
+}
+
+// watchEntry holds sources of a template, the state of its files from the
+// last parsing and the changed state that is waiting to settle.
+type watchEntry struct {
+	sources []string
+	files   map[string]fileState
+	pending map[string]fileState
+	parse   func() (parsedTemplate, []string, error)
+}
+
+// fileState is the information about a file used to detect changes. A file
+// that does not exist has the zero state.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func newWatcher(o *Options, t *Templates) *watcher {
+	return &watcher{
+		o:       o,
+		t:       t,
+		entries: make(map[string]*watchEntry),
+		quit:    make(chan struct{}),
+	}
+}
+
+// add starts watching files of the template.
+func (w *watcher) add(name string, sources []string, parse func() (parsedTemplate, []string, error)) {
+	w.entries[name] = &watchEntry{
+		sources: sources,
+		files:   w.state(sources),
+		parse:   parse,
+	}
+}
+
+func (w *watcher) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.check()
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+func (w *watcher) stop() {
+	w.once.Do(func() { close(w.quit) })
+}
+
+// check parses again templates which files have changed. Changed files are
+// parsed only if they are the same as on the previous check, so that files
+// which are still being written by editors are not parsed.
+func (w *watcher) check() {
+	w.discover()
+	for name, e := range w.entries {
+		files := w.state(e.sources)
+		if equalFileStates(files, e.files) {
+			e.pending = nil
+			continue
+		}
+		if e.pending == nil || !equalFileStates(files, e.pending) {
+			e.pending = files
+			continue
+		}
+		e.files, e.pending = files, nil
+		tpl, sources, err := e.parse()
+		if err != nil {
+			attrs := []any{"template", name, "error", err}
+			var fe *FileError
+			if errors.As(err, &fe) {
+				attrs = append(attrs, "file", fe.File, "line", fe.Line)
+			}
+			w.o.logger.Error("templates: reload", attrs...)
+			continue
+		}
+		if !slices.Equal(sources, e.sources) {
+			// The layout has changed, so files of the new one are watched.
+			e.sources = sources
+			e.files = w.state(sources)
+		}
+		w.mu.Lock()
+		w.t.templates[name] = tpl
+		w.mu.Unlock()
+		w.o.logger.Debug("templates: reloaded", "template", name)
+	}
+}
+
+// discover starts watching templates for files that are added to
+// directories from WithTemplatesFromDir option. New templates have no file
+// states, so they are parsed by check as changed ones.
+func (w *watcher) discover() {
+	if len(w.o.dirs) == 0 {
+		return
+	}
+	found := make(map[string][]string)
+	for _, d := range w.o.dirs {
+		if err := discoverTemplates(w.o, d, found); err != nil {
+			w.o.logger.Error("templates: discover", "dir", d.dir, "error", err)
+			return
+		}
+	}
+	for name, files := range found {
+		if _, ok := w.entries[name]; ok {
+			continue
+		}
+		name, files := name, files
+		w.entries[name] = &watchEntry{
+			sources: files,
+			files:   make(map[string]fileState),
+			parse: func() (parsedTemplate, []string, error) {
+				return w.o.parseTemplate(name, files)
+			},
+		}
+		w.o.logger.Debug("templates: discovered", "template", name)
+	}
+}
+
+// state returns states of all files that match sources.
+func (w *watcher) state(sources []string) map[string]fileState {
+	files := make(map[string]fileState)
+	for _, s := range sources {
+		names, err := w.o.expandFiles([]string{s})
+		if err != nil {
+			// A glob pattern without matches is recorded as a missing file.
+			files[w.o.fileFindFunc(s)] = fileState{}
+			continue
+		}
+		for _, name := range names {
+			var state fileState
+			if info, err := w.o.fileStatFunc(name); err == nil {
+				state = fileState{modTime: info.ModTime(), size: info.Size()}
+			}
+			files[name] = state
+		}
+	}
+	return files
+}
+
+func equalFileStates(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, s := range a {
+		if t, ok := b[name]; !ok || !s.modTime.Equal(t.modTime) || s.size != t.size {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templates_test
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"resenje.org/web/templates"
+)
+
+func TestWithWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("_header.html", `{{define "header"}}H{{end}}`)
+	writeFile("index.html", `{{template "header"}} index`)
+
+	tpl, err := templates.New(
+		templates.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		templates.WithWatch(5*time.Millisecond),
+		templates.WithTemplatesFromDir(dir, filepath.Join(dir, "_header.html")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpl.Close()
+
+	render := func(name string) (s string, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+		return tpl.Render(name, nil)
+	}
+	waitFor := func(name, want string) {
+		t.Helper()
+		var got string
+		var err error
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			got, err = render(name)
+			if err == nil && got == want {
+				return
+			}
+		}
+		t.Errorf("%s: expected %q, got %q (error %v)", name, want, got, err)
+	}
+
+	waitFor("index", "H index")
+
+	writeFile("index.html", `{{template "header"}} changed index`)
+	waitFor("index", "H changed index")
+
+	writeFile("users/list.html", `{{template "header"}} users`)
+	waitFor("users/list", "H users")
+
+	writeFile("_header.html", `{{define "header"}}Header{{end}}`)
+	waitFor("users/list", "Header users")
+	waitFor("index", "Header changed index")
+
+	writeFile("_hidden.html", `hidden`)
+	time.Sleep(50 * time.Millisecond)
+	if _, err := render("_hidden"); err == nil {
+		t.Errorf("expected error for template of an ignored file")
+	}
+}
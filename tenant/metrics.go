@@ -0,0 +1,82 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tenant
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds Prometheus request counters and durations partitioned by
+// the tenant ID. As every tenant adds a new time series, it should be used
+// only with a bounded number of tenants. Tenant IDs that are not validated
+// by Lookup are recorded as UnknownLabel.
+type Metrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// MetricsOptions holds options for NewMetrics constructor.
+type MetricsOptions struct {
+	Namespace string
+	Subsystem string
+}
+
+// NewMetrics creates new Metrics instance. Options value can be nil.
+func NewMetrics(options *MetricsOptions) (m *Metrics) {
+	if options == nil {
+		options = new(MetricsOptions)
+	}
+	if options.Subsystem == "" {
+		options.Subsystem = "tenant"
+	}
+	return &Metrics{
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: options.Namespace,
+				Subsystem: options.Subsystem,
+				Name:      "requests_total",
+				Help:      "Number of HTTP requests, partitioned by tenant and status code.",
+			},
+			[]string{LogKey, "code"},
+		),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: options.Namespace,
+				Subsystem: options.Subsystem,
+				Name:      "request_duration_seconds",
+				Help:      "Duration of HTTP requests, partitioned by tenant.",
+				Buckets:   prometheus.DefBuckets,
+			},
+			[]string{LogKey},
+		),
+	}
+}
+
+func (m *Metrics) observe(id string, code int, seconds float64) {
+	m.requests.With(prometheus.Labels{LogKey: id, "code": strconv.Itoa(code)}).Inc()
+	m.duration.With(prometheus.Labels{LogKey: id}).Observe(seconds)
+}
+
+// Metrics returns all Prometheus metrics that should be registered.
+func (m *Metrics) Metrics() (cs []prometheus.Collector) {
+	return []prometheus.Collector{m.requests, m.duration}
+}
+
+// Labels returns Prometheus labels with the tenant ID from the context added
+// to the provided labels, to be used with application metrics. Tenant IDs
+// that are not validated by Lookup are replaced by UnknownLabel.
+func Labels(ctx context.Context, labels prometheus.Labels) prometheus.Labels {
+	l := make(prometheus.Labels, len(labels)+1)
+	for k, v := range labels {
+		l[k] = v
+	}
+	v, _ := ctx.Value(contextKey{}).(contextValue)
+	l[LogKey] = v.label()
+	return l
+}
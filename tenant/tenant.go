@@ -0,0 +1,271 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tenant provides an HTTP handler that resolves the tenant of the
+// request and stores it in the request context.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/felixge/httpsnoop"
+
+	"resenje.org/web/logging"
+)
+
+// LogKey is the log key for the tenant ID added to the context logger.
+const LogKey = "tenant"
+
+// UnknownLabel is the value of the tenant metrics label for requests with
+// tenant IDs that are not validated by Lookup or that are not found.
+const UnknownLabel = "unknown"
+
+// ErrNotFound should be returned by Lookup if the tenant does not exist.
+var ErrNotFound = errors.New("tenant not found")
+
+// Strategy resolves the tenant ID from the request. It returns an empty
+// string if the ID can not be resolved. The returned request, if not nil,
+// replaces the original one, for example with the path prefix removed.
+type Strategy func(r *http.Request) (id string, rr *http.Request)
+
+// Lookup provides the tenant by its ID.
+type Lookup interface {
+	// Tenant returns the tenant or ErrNotFound if it does not exist.
+	Tenant(ctx context.Context, id string) (any, error)
+}
+
+// LookupFunc type is an adapter to allow the use of ordinary functions as
+// Lookup.
+type LookupFunc func(ctx context.Context, id string) (any, error)
+
+// Tenant calls f(ctx, id).
+func (f LookupFunc) Tenant(ctx context.Context, id string) (any, error) {
+	return f(ctx, id)
+}
+
+// Handler implements http.Handler interface that resolves the tenant and
+// calls the wrapped handler with the tenant stored in the request context.
+type Handler struct {
+	handler         http.Handler
+	strategies      []Strategy
+	lookup          Lookup
+	optional        bool
+	notFoundHandler http.Handler
+	errorHandler    func(w http.ResponseWriter, r *http.Request, err error)
+	metrics         *Metrics
+}
+
+// Option is a function that sets optional parameters to the Handler.
+type Option func(*Handler)
+
+// WithStrategies sets strategies that are tried in order until one of them
+// resolves the tenant ID.
+func WithStrategies(strategies ...Strategy) Option {
+	return func(o *Handler) { o.strategies = strategies }
+}
+
+// WithLookup sets the Lookup that provides the tenant by its ID. If it is not
+// set, the tenant is the ID itself and all IDs are accepted. As IDs are
+// resolved from the request, they must not be trusted without Lookup and
+// they are not used as metrics label values.
+func WithLookup(l Lookup) Option { return func(o *Handler) { o.lookup = l } }
+
+// WithOptional allows requests without the resolved tenant ID to be passed
+// to the handler without the tenant in the context. Unknown tenants are
+// still rejected.
+func WithOptional(yes bool) Option { return func(o *Handler) { o.optional = yes } }
+
+// WithNotFoundHandler sets the handler that responds when the tenant ID can
+// not be resolved or the tenant does not exist. Default is
+// http.NotFoundHandler.
+func WithNotFoundHandler(h http.Handler) Option {
+	return func(o *Handler) { o.notFoundHandler = h }
+}
+
+// WithErrorHandler sets the function that will be used if there is an error
+// from Lookup. If it is not set, a panic will occur.
+func WithErrorHandler(fn func(w http.ResponseWriter, r *http.Request, err error)) Option {
+	return func(o *Handler) { o.errorHandler = fn }
+}
+
+// WithMetrics sets Metrics that count requests by the tenant ID. Requests
+// with tenants that are not found, or all requests if Lookup is not set, are
+// counted with the UnknownLabel label value, so that clients can not create
+// arbitrary time series.
+func WithMetrics(m *Metrics) Option { return func(o *Handler) { o.metrics = m } }
+
+// New creates a new Handler that calls the handler with resolved tenant.
+func New(handler http.Handler, options ...Option) (h *Handler) {
+	h = &Handler{
+		handler:         handler,
+		notFoundHandler: http.NotFoundHandler(),
+	}
+	for _, option := range options {
+		option(h)
+	}
+	return
+}
+
+// ServeHTTP implements http.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var id string
+	for _, strategy := range h.strategies {
+		var rr *http.Request
+		id, rr = strategy(r)
+		if id == "" {
+			continue
+		}
+		if rr != nil {
+			r = rr
+		}
+		break
+	}
+	if id == "" {
+		if h.optional {
+			h.handler.ServeHTTP(w, r)
+			return
+		}
+		h.notFoundHandler.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	var tenant any = id
+	if h.lookup != nil {
+		t, err := h.lookup.Tenant(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			h.serve(w, r, h.notFoundHandler, UnknownLabel)
+			return
+		}
+		if err != nil {
+			h.error(w, r, err)
+			return
+		}
+		tenant = t
+	}
+
+	v := contextValue{id: id, tenant: tenant, validated: h.lookup != nil}
+	ctx = context.WithValue(ctx, contextKey{}, v)
+	ctx = logging.NewSlogContext(ctx, logging.SlogFromContext(ctx).With(slog.String(LogKey, id)))
+	h.serve(w, r.WithContext(ctx), h.handler, v.label())
+}
+
+// serve calls the handler and records metrics with the tenant label.
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request, handler http.Handler, label string) {
+	if h.metrics == nil {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	m := httpsnoop.CaptureMetrics(handler, w, r)
+	h.metrics.observe(label, m.Code, m.Duration.Seconds())
+}
+
+func (h *Handler) error(w http.ResponseWriter, r *http.Request, err error) {
+	if h.errorHandler == nil {
+		panic(err)
+	}
+	h.errorHandler(w, r, err)
+}
+
+// FromHost returns a Strategy that uses the host label before the domain as
+// the tenant ID, so that for the domain "example.com" the ID from the host
+// "acme.example.com" is "acme". Hosts with more labels or without the domain
+// suffix are not resolved.
+func FromHost(domain string) Strategy {
+	suffix := "." + strings.ToLower(strings.Trim(domain, "."))
+	return func(r *http.Request) (string, *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		id, ok := strings.CutSuffix(host, suffix)
+		if !ok || id == "" || strings.Contains(id, ".") {
+			return "", nil
+		}
+		return id, nil
+	}
+}
+
+// FromPathPrefix returns a Strategy that uses the first path segment as the
+// tenant ID and removes it from the request URL path, so that the request to
+// "/acme/users" has the ID "acme" and the path "/users".
+func FromPathPrefix() Strategy {
+	return func(r *http.Request) (string, *http.Request) {
+		id, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if id == "" {
+			return "", nil
+		}
+		rr := new(http.Request)
+		*rr = *r
+		rr.URL = new(url.URL)
+		*rr.URL = *r.URL
+		rr.URL.Path = "/" + rest
+		if r.URL.RawPath != "" {
+			_, rawRest, _ := strings.Cut(strings.TrimPrefix(r.URL.RawPath, "/"), "/")
+			rr.URL.RawPath = "/" + rawRest
+		}
+		return id, rr
+	}
+}
+
+// FromHeader returns a Strategy that uses the value of the HTTP request header
+// as the tenant ID.
+func FromHeader(name string) Strategy {
+	return func(r *http.Request) (string, *http.Request) {
+		return strings.TrimSpace(r.Header.Get(name)), nil
+	}
+}
+
+// FromEntity returns a Strategy that uses the tenant ID of the authenticated
+// entity, which is usually stored in the request context by
+// web.AuthHandler PostAuthFunc.
+func FromEntity[Entity any](entity func(r *http.Request) (e Entity, ok bool), id func(e Entity) string) Strategy {
+	return func(r *http.Request) (string, *http.Request) {
+		e, ok := entity(r)
+		if !ok {
+			return "", nil
+		}
+		return id(e), nil
+	}
+}
+
+type contextKey struct{}
+
+type contextValue struct {
+	id        string
+	tenant    any
+	validated bool // the tenant is provided by Lookup
+}
+
+// label returns the tenant metrics label value.
+func (v contextValue) label() string {
+	if v.id != "" && !v.validated {
+		return UnknownLabel
+	}
+	return v.id
+}
+
+// IDFromContext returns the ID of the tenant stored in the context by the
+// Handler. If the Handler has no Lookup, the ID is resolved from the request
+// and must not be trusted.
+func IDFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(contextKey{}).(contextValue)
+	return v.id
+}
+
+// FromContext returns the tenant stored in the context by the Handler, as it
+// is returned by Lookup.
+func FromContext[T any](ctx context.Context) (t T, ok bool) {
+	v, _ := ctx.Value(contextKey{}).(contextValue)
+	t, ok = v.tenant.(T)
+	return t, ok
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tenant_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"resenje.org/web/logging"
+	"resenje.org/web/tenant"
+)
+
+type testTenant struct {
+	Name string
+}
+
+var testLookup = tenant.LookupFunc(func(ctx context.Context, id string) (any, error) {
+	switch id {
+	case "acme":
+		return testTenant{Name: "Acme"}, nil
+	case "broken":
+		return nil, errors.New("database unavailable")
+	}
+	return nil, tenant.ErrNotFound
+})
+
+func testHandler(w http.ResponseWriter, r *http.Request) {
+	t, _ := tenant.FromContext[testTenant](r.Context())
+	fmt.Fprintf(w, "%s %s %s", tenant.IDFromContext(r.Context()), t.Name, r.URL.Path)
+	logging.SlogFromContext(r.Context()).InfoContext(r.Context(), "served")
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	h := logging.NewContextLoggerHandler(tenant.New(http.HandlerFunc(testHandler),
+		tenant.WithStrategies(
+			tenant.FromHeader("X-Tenant"),
+			tenant.FromHost("example.com"),
+			tenant.FromPathPrefix(),
+		),
+		tenant.WithLookup(testLookup),
+		tenant.WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}),
+	), logger)
+
+	for _, tc := range []struct {
+		name   string
+		url    string
+		header string
+		status int
+		body   string
+	}{
+		{name: "host", url: "http://acme.example.com/users", status: http.StatusOK, body: "acme Acme /users"},
+		{name: "header", url: "http://acme.example.com/users", header: "acme", status: http.StatusOK, body: "acme Acme /users"},
+		{name: "path prefix", url: "http://localhost/acme/users", status: http.StatusOK, body: "acme Acme /users"},
+		{name: "unknown", url: "http://other.example.com/users", status: http.StatusNotFound, body: "404 page not found\n"},
+		{name: "error", url: "http://localhost/users", header: "broken", status: http.StatusInternalServerError, body: "database unavailable\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			r := httptest.NewRequest("GET", tc.url, nil)
+			if tc.header != "" {
+				r.Header.Set("X-Tenant", tc.header)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.status {
+				t.Errorf("expected status code %d, got %d", tc.status, w.Code)
+			}
+			if v := w.Body.String(); v != tc.body {
+				t.Errorf("expected body %q, got %q", tc.body, v)
+			}
+			if tc.status == http.StatusOK && !strings.Contains(buf.String(), "msg=served tenant=acme") {
+				t.Errorf("expected tenant in log, got %q", buf.String())
+			}
+		})
+	}
+}
+
+func TestHandler_optional(t *testing.T) {
+	h := tenant.New(http.HandlerFunc(testHandler),
+		tenant.WithStrategies(tenant.FromHeader("X-Tenant")),
+		tenant.WithOptional(true),
+	)
+
+	r := httptest.NewRequest("GET", "/users", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if v := w.Body.String(); v != "  /users" {
+		t.Errorf("expected body %q, got %q", "  /users", v)
+	}
+}
+
+func TestHandler_metrics(t *testing.T) {
+	metrics := tenant.NewMetrics(nil)
+	h := tenant.New(http.HandlerFunc(testHandler),
+		tenant.WithStrategies(tenant.FromEntity(
+			func(r *http.Request) (string, bool) {
+				user := r.Header.Get("X-User")
+				return user, user != ""
+			},
+			func(user string) string {
+				_, id, _ := strings.Cut(user, "@")
+				return id
+			},
+		)),
+		tenant.WithLookup(tenant.LookupFunc(func(_ context.Context, id string) (any, error) {
+			if id != "acme" {
+				return nil, tenant.ErrNotFound
+			}
+			return id, nil
+		})),
+		tenant.WithMetrics(metrics),
+	)
+
+	for _, user := range []string{"john@acme", "jane@acme", "joe@random1", "joe@random2"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-User", user)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	want := `
+# HELP tenant_requests_total Number of HTTP requests, partitioned by tenant and status code.
+# TYPE tenant_requests_total counter
+tenant_requests_total{code="200",tenant="acme"} 2
+tenant_requests_total{code="404",tenant="unknown"} 2
+`
+	if err := testutil.CollectAndCompare(metrics.Metrics()[0], strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandler_metricsWithoutLookup(t *testing.T) {
+	metrics := tenant.NewMetrics(nil)
+	var labels []prometheus.Labels
+	h := tenant.New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		labels = append(labels, tenant.Labels(r.Context(), nil))
+	}),
+		tenant.WithStrategies(tenant.FromHeader("X-Tenant")),
+		tenant.WithMetrics(metrics),
+	)
+
+	for _, id := range []string{"acme", "random1", "random2"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Tenant", id)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	want := `
+# HELP tenant_requests_total Number of HTTP requests, partitioned by tenant and status code.
+# TYPE tenant_requests_total counter
+tenant_requests_total{code="200",tenant="unknown"} 3
+`
+	if err := testutil.CollectAndCompare(metrics.Metrics()[0], strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	for _, l := range labels {
+		if l[tenant.LogKey] != tenant.UnknownLabel {
+			t.Errorf("expected label %q, got %q", tenant.UnknownLabel, l[tenant.LogKey])
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Storage if the upload does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Upload holds information about a resumable upload.
+type Upload struct {
+	ID        string            `json:"id"`
+	Size      int64             `json:"size"`
+	Offset    int64             `json:"-"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Owner     string            `json:"owner,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Completed returns true if all upload data has been received.
+func (u Upload) Completed() bool {
+	return u.Offset >= u.Size
+}
+
+// Expired returns true if the upload is not completed before its expiration
+// time.
+func (u Upload) Expired(now time.Time) bool {
+	return !u.Completed() && !u.ExpiresAt.IsZero() && now.After(u.ExpiresAt)
+}
+
+// Storage defines methods that are required to store uploads and their
+// data.
+type Storage interface {
+	// Create stores a new upload without any data.
+	Create(ctx context.Context, u Upload) error
+	// Get returns the upload with the Offset set to the size of stored data.
+	// If the upload does not exist, ErrNotFound must be returned.
+	Get(ctx context.Context, id string) (Upload, error)
+	// Update stores new upload information, not changing its data.
+	Update(ctx context.Context, u Upload) error
+	// Append writes data from the reader to the end of the upload data and
+	// returns the number of written bytes. Data that is written before the
+	// reader returns an error must be kept.
+	Append(ctx context.Context, id string, r io.Reader) (n int64, err error)
+	// Truncate discards upload data after the offset.
+	Truncate(ctx context.Context, id string, offset int64) error
+	// Remove removes the upload and its data.
+	Remove(ctx context.Context, id string) error
+	// List returns all stored uploads.
+	List(ctx context.Context) ([]Upload, error)
+}
+
+// FileStorage implements Storage that keeps uploads in a directory on the
+// local filesystem. Every upload has a data file named by the upload ID and
+// an information file with the .info extension.
+type FileStorage struct {
+	dir string
+	mu  sync.Mutex
+}
+
+const fileStorageInfoExt = ".info"
+
+// NewFileStorage creates a new instance of FileStorage.
+func NewFileStorage(dir string) *FileStorage {
+	return &FileStorage{
+		dir: dir,
+	}
+}
+
+// Create stores a new upload without any data.
+func (s *FileStorage) Create(_ context.Context, u Upload) error {
+	if err := os.MkdirAll(s.dir, 0o777); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.dataPath(u.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o666)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return s.writeInfo(u)
+}
+
+// Get returns the upload with the Offset set to the size of stored data.
+func (s *FileStorage) Get(_ context.Context, id string) (u Upload, err error) {
+	if !validID(id) {
+		return u, ErrNotFound
+	}
+	b, err := os.ReadFile(s.infoPath(id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return u, ErrNotFound
+		}
+		return u, err
+	}
+	if err := json.Unmarshal(b, &u); err != nil {
+		return u, fmt.Errorf("decode upload info: %w", err)
+	}
+	fi, err := os.Stat(s.dataPath(id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return u, ErrNotFound
+		}
+		return u, err
+	}
+	u.Offset = fi.Size()
+	return u, nil
+}
+
+// Update stores new upload information.
+func (s *FileStorage) Update(ctx context.Context, u Upload) error {
+	if _, err := s.Get(ctx, u.ID); err != nil {
+		return err
+	}
+	return s.writeInfo(u)
+}
+
+// Append writes data to the end of the upload data file.
+func (s *FileStorage) Append(_ context.Context, id string, r io.Reader) (n int64, err error) {
+	if !validID(id) {
+		return 0, ErrNotFound
+	}
+	f, err := os.OpenFile(s.dataPath(id), os.O_APPEND|os.O_WRONLY, 0o666)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	n, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// Truncate discards upload data after the offset.
+func (s *FileStorage) Truncate(_ context.Context, id string, offset int64) error {
+	if !validID(id) {
+		return ErrNotFound
+	}
+	err := os.Truncate(s.dataPath(id), offset)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Remove removes the upload data and information files.
+func (s *FileStorage) Remove(_ context.Context, id string) error {
+	if !validID(id) {
+		return ErrNotFound
+	}
+	err := os.Remove(s.infoPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(s.dataPath(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List returns all uploads in the directory.
+func (s *FileStorage) List(ctx context.Context) (uploads []Upload, err error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), fileStorageInfoExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		u, err := s.Get(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			// Removed in the meantime.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, nil
+}
+
+func (s *FileStorage) writeInfo(u Upload) error {
+	b, err := json.Marshal(u)
+	if err != nil {
+		return fmt.Errorf("encode upload info: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Write to a temporary file and rename it to replace the information
+	// atomically.
+	tmp := s.infoPath(u.ID) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.infoPath(u.ID))
+}
+
+func (s *FileStorage) dataPath(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+func (s *FileStorage) infoPath(id string) string {
+	return filepath.Join(s.dir, id+fileStorageInfoExt)
+}
+
+// validID protects against path traversal with IDs provided in requests.
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
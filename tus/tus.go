@@ -0,0 +1,579 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tus provides an HTTP handler that implements the tus resumable
+// upload protocol version 1.0.0 with creation, expiration, checksum and
+// termination extensions.
+//
+// The protocol is specified at https://tus.io/protocols/resumable-upload.
+package tus
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is the supported tus protocol version.
+const Version = "1.0.0"
+
+// StatusChecksumMismatch is the HTTP status code defined by the checksum
+// extension for responses when the checksum of the received data does not
+// match the one provided in the request.
+const StatusChecksumMismatch = 460
+
+const offsetContentType = "application/offset+octet-stream"
+
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// Handler implements http.Handler interface that serves tus protocol
+// requests. Uploads are created by POST requests on the base path and are
+// addressed by the base path followed by the upload ID.
+type Handler struct {
+	storage      Storage
+	basePath     string
+	maxSize      int64
+	maxChunkSize int64
+	expiration   time.Duration
+	ownerFunc    func(r *http.Request) (owner string, err error)
+	completeFunc func(ctx context.Context, u Upload)
+	errorHandler func(w http.ResponseWriter, r *http.Request, err error)
+	logger       *slog.Logger
+
+	locks   map[string]struct{}
+	locksMu sync.Mutex
+}
+
+// Option is a function that sets optional parameters to the Handler.
+type Option func(*Handler)
+
+// WithBasePath sets the URL path under which uploads are created and served.
+// Default is "/files/".
+func WithBasePath(p string) Option {
+	return func(o *Handler) {
+		if !strings.HasSuffix(p, "/") {
+			p += "/"
+		}
+		o.basePath = p
+	}
+}
+
+// WithMaxSize sets the maximal size of an upload in bytes. It is advertised
+// to the clients with the Tus-Max-Size header.
+func WithMaxSize(n int64) Option { return func(o *Handler) { o.maxSize = n } }
+
+// WithMaxChunkSize sets the maximal number of bytes that a single PATCH
+// request body can have, in the same way as web.MaxBodyBytesHandler does.
+func WithMaxChunkSize(n int64) Option { return func(o *Handler) { o.maxChunkSize = n } }
+
+// WithExpiration sets the duration after which uncompleted uploads expire.
+// Expiration is extended on every received chunk. Expired uploads can be
+// removed with RemoveExpired method.
+func WithExpiration(d time.Duration) Option { return func(o *Handler) { o.expiration = d } }
+
+// WithOwnerFunc sets the function that returns the owner of the request, for
+// example the key of the entity authenticated by web.AuthHandler and stored in
+// the request context by its PostAuthFunc. Uploads are accessible only to the
+// owner that created them.
+func WithOwnerFunc(fn func(r *http.Request) (owner string, err error)) Option {
+	return func(o *Handler) { o.ownerFunc = fn }
+}
+
+// WithCompleteFunc sets the function that is called when all data of an
+// upload is received.
+func WithCompleteFunc(fn func(ctx context.Context, u Upload)) Option {
+	return func(o *Handler) { o.completeFunc = fn }
+}
+
+// WithErrorHandler sets the function that will be used if there is an
+// error from Storage or the owner function. If it is not set, a panic will
+// occur.
+func WithErrorHandler(fn func(w http.ResponseWriter, r *http.Request, err error)) Option {
+	return func(o *Handler) { o.errorHandler = fn }
+}
+
+// WithLogger sets the function that will perform message logging.
+// Default is slog.Default().
+func WithLogger(l *slog.Logger) Option { return func(o *Handler) { o.logger = l } }
+
+// New creates a new Handler that stores uploads in the storage.
+func New(storage Storage, options ...Option) (h *Handler) {
+	h = &Handler{
+		storage:  storage,
+		basePath: "/files/",
+		logger:   slog.Default(),
+		locks:    make(map[string]struct{}),
+	}
+	for _, option := range options {
+		option(h)
+	}
+	return
+}
+
+// ServeHTTP implements http.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", Version)
+
+	method := r.Method
+	if m := r.Header.Get("X-HTTP-Method-Override"); m != "" {
+		method = strings.ToUpper(m)
+	}
+
+	if method == http.MethodOptions {
+		h.options(w)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != Version {
+		w.Header().Set("Tus-Version", Version)
+		respond(w, http.StatusPreconditionFailed)
+		return
+	}
+
+	id, ok := strings.CutPrefix(r.URL.Path, h.basePath)
+	if !ok && r.URL.Path+"/" == h.basePath {
+		id, ok = "", true
+	}
+	if !ok || strings.Contains(id, "/") {
+		respond(w, http.StatusNotFound)
+		return
+	}
+
+	var owner string
+	if h.ownerFunc != nil {
+		var err error
+		owner, err = h.ownerFunc(r)
+		if err != nil {
+			h.error(w, r, err)
+			return
+		}
+	}
+
+	if id == "" {
+		if method != http.MethodPost {
+			w.Header().Set("Allow", "OPTIONS, POST")
+			respond(w, http.StatusMethodNotAllowed)
+			return
+		}
+		h.create(w, r, owner)
+		return
+	}
+
+	switch method {
+	case http.MethodHead:
+		h.head(w, r, id, owner)
+	case http.MethodPatch:
+		h.patch(w, r, id, owner)
+	case http.MethodDelete:
+		h.delete(w, r, id, owner)
+	default:
+		w.Header().Set("Allow", "DELETE, HEAD, OPTIONS, PATCH")
+		respond(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// RemoveExpired removes all uploads that are expired.
+func (h *Handler) RemoveExpired(ctx context.Context) error {
+	uploads, err := h.storage.List(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, u := range uploads {
+		if !u.Expired(now) {
+			continue
+		}
+		if err := h.storage.Remove(ctx, u.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		h.logger.DebugContext(ctx, "tus: expired upload removed", "id", u.ID)
+	}
+	return nil
+}
+
+func (h *Handler) options(w http.ResponseWriter) {
+	w.Header().Set("Tus-Version", Version)
+	w.Header().Set("Tus-Extension", h.extensions())
+	if h.maxSize > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.maxSize, 10))
+	}
+	algorithms := make([]string, 0, len(checksumAlgorithms))
+	for a := range checksumAlgorithms {
+		algorithms = append(algorithms, a)
+	}
+	sort.Strings(algorithms)
+	w.Header().Set("Tus-Checksum-Algorithm", strings.Join(algorithms, ","))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) extensions() string {
+	extensions := []string{"creation", "checksum", "termination"}
+	if h.expiration > 0 {
+		extensions = append(extensions, "expiration")
+	}
+	return strings.Join(extensions, ",")
+}
+
+func (h *Handler) create(w http.ResponseWriter, r *http.Request, owner string) {
+	ctx := r.Context()
+
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		respond(w, http.StatusBadRequest)
+		return
+	}
+	if h.maxSize > 0 && size > h.maxSize {
+		respond(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+	metadata, err := parseMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		respond(w, http.StatusBadRequest)
+		return
+	}
+
+	id, err := newID()
+	if err != nil {
+		h.error(w, r, err)
+		return
+	}
+	now := time.Now()
+	u := Upload{
+		ID:        id,
+		Size:      size,
+		Metadata:  metadata,
+		Owner:     owner,
+		CreatedAt: now,
+	}
+	if h.expiration > 0 {
+		u.ExpiresAt = now.Add(h.expiration)
+	}
+	if err := h.storage.Create(ctx, u); err != nil {
+		h.error(w, r, err)
+		return
+	}
+
+	if u.Completed() && h.completeFunc != nil {
+		h.completeFunc(ctx, u)
+	}
+
+	w.Header().Set("Location", h.basePath+id)
+	setExpires(w, u)
+	respond(w, http.StatusCreated)
+}
+
+func (h *Handler) head(w http.ResponseWriter, r *http.Request, id, owner string) {
+	u, ok := h.get(w, r, id, owner)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Size, 10))
+	if len(u.Metadata) > 0 {
+		w.Header().Set("Upload-Metadata", formatMetadata(u.Metadata))
+	}
+	setExpires(w, u)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) patch(w http.ResponseWriter, r *http.Request, id, owner string) {
+	ctx := r.Context()
+
+	if r.Header.Get("Content-Type") != offsetContentType {
+		respond(w, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		respond(w, http.StatusBadRequest)
+		return
+	}
+	if h.maxChunkSize > 0 && r.ContentLength > h.maxChunkSize {
+		respond(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var checksum []byte
+	var newHash func() hash.Hash
+	if v := r.Header.Get("Upload-Checksum"); v != "" {
+		algorithm, sum, _ := strings.Cut(v, " ")
+		newHash = checksumAlgorithms[algorithm]
+		if newHash == nil {
+			respond(w, http.StatusBadRequest)
+			return
+		}
+		checksum, err = base64.StdEncoding.DecodeString(sum)
+		if err != nil {
+			respond(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Only one request can append data to the upload at the time.
+	unlock, ok := h.lock(id)
+	if !ok {
+		respond(w, http.StatusConflict)
+		return
+	}
+	defer unlock()
+
+	u, ok := h.get(w, r, id, owner)
+	if !ok {
+		return
+	}
+	if offset != u.Offset {
+		respond(w, http.StatusConflict)
+		return
+	}
+	remaining := u.Size - u.Offset
+	if r.ContentLength > remaining {
+		respond(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	limit := remaining
+	if h.maxChunkSize > 0 && h.maxChunkSize < limit {
+		limit = h.maxChunkSize
+	}
+	var body io.Reader = http.MaxBytesReader(w, r.Body, limit)
+	if newHash != nil {
+		body = &checksumReader{r: body, h: newHash(), sum: checksum}
+	}
+	n, err := h.storage.Append(ctx, id, body)
+	if err != nil && newHash != nil {
+		// Data that is not verified by the checksum of the whole chunk must
+		// not be kept.
+		if err := h.storage.Truncate(context.WithoutCancel(ctx), id, offset); err != nil {
+			h.error(w, r, err)
+			return
+		}
+		n = 0
+	}
+	if errors.Is(err, errChecksumMismatch) {
+		respond(w, StatusChecksumMismatch)
+		return
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		// Keep the data that fits the limit, as the client will resume from
+		// the offset.
+		h.logger.DebugContext(ctx, "tus: chunk too large", "id", id, "written", n)
+		u.Offset += n
+		if err := h.refreshExpiration(ctx, &u, n); err != nil {
+			h.error(w, r, err)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+		setExpires(w, u)
+		respond(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		if ctx.Err() != nil || errors.Is(err, io.ErrUnexpectedEOF) {
+			// The client disconnected, keep received data for resumption.
+			h.logger.DebugContext(ctx, "tus: upload interrupted", "id", id, "written", n, "error", err)
+			u.Offset += n
+			if err := h.refreshExpiration(context.WithoutCancel(ctx), &u, n); err != nil {
+				h.logger.ErrorContext(ctx, "tus: update upload expiration", "id", id, "error", err)
+			}
+			return
+		}
+		h.error(w, r, err)
+		return
+	}
+	u.Offset += n
+	if err := h.refreshExpiration(ctx, &u, n); err != nil {
+		h.error(w, r, err)
+		return
+	}
+
+	if u.Completed() && h.completeFunc != nil {
+		h.completeFunc(ctx, u)
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	setExpires(w, u)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refreshExpiration extends the expiration time of the incomplete upload
+// after n bytes are appended to it.
+func (h *Handler) refreshExpiration(ctx context.Context, u *Upload, n int64) error {
+	if h.expiration <= 0 || n == 0 || u.Completed() {
+		return nil
+	}
+	u.ExpiresAt = time.Now().Add(h.expiration)
+	return h.storage.Update(ctx, *u)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, id, owner string) {
+	unlock, ok := h.lock(id)
+	if !ok {
+		respond(w, http.StatusConflict)
+		return
+	}
+	defer unlock()
+
+	if _, ok := h.get(w, r, id, owner); !ok {
+		return
+	}
+	if err := h.storage.Remove(r.Context(), id); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			respond(w, http.StatusNotFound)
+			return
+		}
+		h.error(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// get returns the upload if it exists, is owned by the owner and is not
+// expired. Otherwise, it writes the response and returns false.
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, id, owner string) (u Upload, ok bool) {
+	u, err := h.storage.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			respond(w, http.StatusNotFound)
+			return u, false
+		}
+		h.error(w, r, err)
+		return u, false
+	}
+	if u.Owner != owner {
+		// Do not reveal that the upload exists.
+		respond(w, http.StatusNotFound)
+		return u, false
+	}
+	if u.Expired(time.Now()) {
+		respond(w, http.StatusGone)
+		return u, false
+	}
+	return u, true
+}
+
+func (h *Handler) lock(id string) (unlock func(), ok bool) {
+	h.locksMu.Lock()
+	defer h.locksMu.Unlock()
+
+	if _, ok := h.locks[id]; ok {
+		return nil, false
+	}
+	h.locks[id] = struct{}{}
+	return func() {
+		h.locksMu.Lock()
+		delete(h.locks, id)
+		h.locksMu.Unlock()
+	}, true
+}
+
+func (h *Handler) error(w http.ResponseWriter, r *http.Request, err error) {
+	if h.errorHandler == nil {
+		panic(err)
+	}
+	h.errorHandler(w, r, err)
+}
+
+// checksumReader computes the checksum of the read data and returns
+// errChecksumMismatch instead of io.EOF if it does not match the expected
+// sum.
+type checksumReader struct {
+	r   io.Reader
+	h   hash.Hash
+	sum []byte
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.h.Write(p[:n])
+	if errors.Is(err, io.EOF) && !bytes.Equal(c.h.Sum(nil), c.sum) {
+		return n, errChecksumMismatch
+	}
+	return n, err
+}
+
+func respond(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	text := http.StatusText(status)
+	if status == StatusChecksumMismatch {
+		text = "Checksum Mismatch"
+	}
+	_, _ = io.WriteString(w, text+"\n")
+}
+
+func setExpires(w http.ResponseWriter, u Upload) {
+	if !u.ExpiresAt.IsZero() && !u.Completed() {
+		w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// parseMetadata parses the Upload-Metadata header value which consists of
+// comma separated key and base64 encoded value pairs.
+func parseMetadata(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	m := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("empty metadata key")
+		}
+		v, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = string(v)
+	}
+	return m, nil
+}
+
+func formatMetadata(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if m[k] == "" {
+			pairs = append(pairs, k)
+			continue
+		}
+		pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(m[k])))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
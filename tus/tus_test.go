@@ -0,0 +1,368 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tus_test
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"resenje.org/web"
+	"resenje.org/web/tus"
+)
+
+func newRequest(method, target, body string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Tus-Resumable", tus.Version)
+	if method == http.MethodPatch {
+		r.Header.Set("Content-Type", "application/offset+octet-stream")
+	}
+	return r
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func assertStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+
+	if w.Code != status {
+		t.Fatalf("expected status code %d, got %d: %s", status, w.Code, w.Body.String())
+	}
+}
+
+func assertHeader(t *testing.T, w *httptest.ResponseRecorder, key, value string) {
+	t.Helper()
+
+	if v := w.Header().Get(key); v != value {
+		t.Errorf("expected %s header %q, got %q", key, value, v)
+	}
+}
+
+func create(t *testing.T, h http.Handler, size string) (location string) {
+	t.Helper()
+
+	r := newRequest(http.MethodPost, "/files/", "")
+	r.Header.Set("Upload-Length", size)
+	r.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("test.txt"))+",public")
+	w := serve(h, r)
+	assertStatus(t, w, http.StatusCreated)
+	return w.Header().Get("Location")
+}
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+
+	var completed tus.Upload
+	h := tus.New(tus.NewFileStorage(dir), tus.WithCompleteFunc(func(_ context.Context, u tus.Upload) {
+		completed = u
+	}))
+
+	location := create(t, h, "11")
+	if !strings.HasPrefix(location, "/files/") {
+		t.Fatalf("unexpected location %q", location)
+	}
+
+	w := serve(h, newRequest(http.MethodHead, location, ""))
+	assertStatus(t, w, http.StatusOK)
+	assertHeader(t, w, "Upload-Offset", "0")
+	assertHeader(t, w, "Upload-Length", "11")
+	assertHeader(t, w, "Upload-Metadata", "filename dGVzdC50eHQ=,public")
+	assertHeader(t, w, "Tus-Resumable", tus.Version)
+	assertHeader(t, w, "Cache-Control", "no-store")
+
+	r := newRequest(http.MethodPatch, location, "hello")
+	r.Header.Set("Upload-Offset", "0")
+	w = serve(h, r)
+	assertStatus(t, w, http.StatusNoContent)
+	assertHeader(t, w, "Upload-Offset", "5")
+
+	// Resuming from a wrong offset.
+	r = newRequest(http.MethodPatch, location, " world")
+	r.Header.Set("Upload-Offset", "4")
+	assertStatus(t, serve(h, r), http.StatusConflict)
+
+	r = newRequest(http.MethodPatch, location, " world")
+	r.Header.Set("Upload-Offset", "5")
+	w = serve(h, r)
+	assertStatus(t, w, http.StatusNoContent)
+	assertHeader(t, w, "Upload-Offset", "11")
+
+	id := strings.TrimPrefix(location, "/files/")
+	b, err := os.ReadFile(filepath.Join(dir, id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello world" {
+		t.Errorf("expected data %q, got %q", "hello world", string(b))
+	}
+	if completed.ID != id {
+		t.Errorf("expected completed upload %q, got %q", id, completed.ID)
+	}
+	if completed.Metadata["filename"] != "test.txt" {
+		t.Errorf("expected filename metadata %q, got %q", "test.txt", completed.Metadata["filename"])
+	}
+
+	assertStatus(t, serve(h, newRequest(http.MethodDelete, location, "")), http.StatusNoContent)
+	assertStatus(t, serve(h, newRequest(http.MethodHead, location, "")), http.StatusNotFound)
+}
+
+func TestHandler_Options(t *testing.T) {
+	h := tus.New(tus.NewFileStorage(t.TempDir()), tus.WithMaxSize(1024), tus.WithExpiration(time.Hour))
+
+	w := serve(h, httptest.NewRequest(http.MethodOptions, "/files/", nil))
+	assertStatus(t, w, http.StatusNoContent)
+	assertHeader(t, w, "Tus-Version", tus.Version)
+	assertHeader(t, w, "Tus-Extension", "creation,checksum,termination,expiration")
+	assertHeader(t, w, "Tus-Max-Size", "1024")
+	assertHeader(t, w, "Tus-Checksum-Algorithm", "md5,sha1,sha256")
+}
+
+func TestHandler_Version(t *testing.T) {
+	h := tus.New(tus.NewFileStorage(t.TempDir()))
+
+	r := httptest.NewRequest(http.MethodPost, "/files/", nil)
+	r.Header.Set("Tus-Resumable", "0.2.2")
+	w := serve(h, r)
+	assertStatus(t, w, http.StatusPreconditionFailed)
+	assertHeader(t, w, "Tus-Version", tus.Version)
+}
+
+func TestHandler_Limits(t *testing.T) {
+	h := tus.New(tus.NewFileStorage(t.TempDir()), tus.WithMaxSize(10), tus.WithMaxChunkSize(4))
+
+	r := newRequest(http.MethodPost, "/files/", "")
+	r.Header.Set("Upload-Length", "11")
+	assertStatus(t, serve(h, r), http.StatusRequestEntityTooLarge)
+
+	location := create(t, h, "10")
+
+	r = newRequest(http.MethodPatch, location, "hello")
+	r.Header.Set("Upload-Offset", "0")
+	assertStatus(t, serve(h, r), http.StatusRequestEntityTooLarge)
+
+	r = newRequest(http.MethodPatch, location, "hell")
+	r.Header.Set("Upload-Offset", "0")
+	assertStatus(t, serve(h, r), http.StatusNoContent)
+
+	// Chunk larger than the remaining upload size.
+	location = create(t, h, "3")
+	r = newRequest(http.MethodPatch, location, "hell")
+	r.Header.Set("Upload-Offset", "0")
+	assertStatus(t, serve(h, r), http.StatusRequestEntityTooLarge)
+}
+
+func TestHandler_Checksum(t *testing.T) {
+	h := tus.New(tus.NewFileStorage(t.TempDir()))
+
+	location := create(t, h, "10")
+
+	sum := sha1.Sum([]byte("hello"))
+
+	r := newRequest(http.MethodPatch, location, "hallo")
+	r.Header.Set("Upload-Offset", "0")
+	r.Header.Set("Upload-Checksum", "sha1 "+base64.StdEncoding.EncodeToString(sum[:]))
+	assertStatus(t, serve(h, r), tus.StatusChecksumMismatch)
+
+	w := serve(h, newRequest(http.MethodHead, location, ""))
+	assertHeader(t, w, "Upload-Offset", "0")
+
+	r = newRequest(http.MethodPatch, location, "hello")
+	r.Header.Set("Upload-Offset", "0")
+	r.Header.Set("Upload-Checksum", "sha1 "+base64.StdEncoding.EncodeToString(sum[:]))
+	w = serve(h, r)
+	assertStatus(t, w, http.StatusNoContent)
+	assertHeader(t, w, "Upload-Offset", "5")
+
+	r = newRequest(http.MethodPatch, location, "hello")
+	r.Header.Set("Upload-Offset", "5")
+	r.Header.Set("Upload-Checksum", "crc32 AAAA")
+	assertStatus(t, serve(h, r), http.StatusBadRequest)
+}
+
+func TestHandler_Expiration(t *testing.T) {
+	storage := tus.NewFileStorage(t.TempDir())
+	h := tus.New(storage, tus.WithExpiration(time.Hour))
+
+	w := serve(h, func() *http.Request {
+		r := newRequest(http.MethodPost, "/files/", "")
+		r.Header.Set("Upload-Length", "10")
+		return r
+	}())
+	assertStatus(t, w, http.StatusCreated)
+	expires, err := http.ParseTime(w.Header().Get("Upload-Expires"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expires); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("unexpected expiration %v", expires)
+	}
+	location := w.Header().Get("Location")
+	id := strings.TrimPrefix(location, "/files/")
+
+	u, err := storage.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.ExpiresAt = time.Now().Add(-time.Minute)
+	if err := storage.Update(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatus(t, serve(h, newRequest(http.MethodHead, location, "")), http.StatusGone)
+
+	if err := h.RemoveExpired(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, serve(h, newRequest(http.MethodHead, location, "")), http.StatusNotFound)
+}
+
+func TestHandler_Owner(t *testing.T) {
+	type ownerKey struct{}
+
+	uploads := tus.New(tus.NewFileStorage(t.TempDir()), tus.WithOwnerFunc(func(r *http.Request) (string, error) {
+		owner, _ := r.Context().Value(ownerKey{}).(string)
+		return owner, nil
+	}))
+	h := web.AuthHandler[string]{
+		KeyHeaderName: "X-Key",
+		Handler:       uploads,
+		AuthFunc: func(r *http.Request, key, secret string) (bool, string, error) {
+			return key != "", key, nil
+		},
+		PostAuthFunc: func(w http.ResponseWriter, r *http.Request, valid bool, entity string) (*http.Request, error) {
+			return r.WithContext(context.WithValue(r.Context(), ownerKey{}, entity)), nil
+		},
+	}
+
+	r := newRequest(http.MethodPost, "/files/", "")
+	r.Header.Set("Upload-Length", "10")
+	r.Header.Set("X-Key", "alice")
+	w := serve(h, r)
+	assertStatus(t, w, http.StatusCreated)
+	location := w.Header().Get("Location")
+
+	r = newRequest(http.MethodHead, location, "")
+	r.Header.Set("X-Key", "alice")
+	assertStatus(t, serve(h, r), http.StatusOK)
+
+	r = newRequest(http.MethodHead, location, "")
+	r.Header.Set("X-Key", "bob")
+	assertStatus(t, serve(h, r), http.StatusNotFound)
+
+	r = newRequest(http.MethodDelete, location, "")
+	r.Header.Set("X-Key", "bob")
+	assertStatus(t, serve(h, r), http.StatusNotFound)
+}
+
+func TestHandler_MethodOverride(t *testing.T) {
+	h := tus.New(tus.NewFileStorage(t.TempDir()))
+
+	location := create(t, h, "5")
+
+	r := newRequest(http.MethodPost, location, "hello")
+	r.Header.Set("X-HTTP-Method-Override", "PATCH")
+	r.Header.Set("Content-Type", "application/offset+octet-stream")
+	r.Header.Set("Upload-Offset", "0")
+	w := serve(h, r)
+	assertStatus(t, w, http.StatusNoContent)
+	assertHeader(t, w, "Upload-Offset", "5")
+}
+
+func TestHandler_NotFound(t *testing.T) {
+	h := tus.New(tus.NewFileStorage(t.TempDir()))
+
+	assertStatus(t, serve(h, newRequest(http.MethodHead, "/files/missing", "")), http.StatusNotFound)
+	assertStatus(t, serve(h, newRequest(http.MethodHead, "/files/..%2f..%2fetc", "")), http.StatusNotFound)
+	assertStatus(t, serve(h, newRequest(http.MethodHead, "/other/", "")), http.StatusNotFound)
+}
+
+func TestHandler_PartialChunk(t *testing.T) {
+	storage := tus.NewFileStorage(t.TempDir())
+	h := tus.New(storage, tus.WithMaxChunkSize(4), tus.WithExpiration(time.Hour))
+
+	location := create(t, h, "10")
+	id := strings.TrimPrefix(location, "/files/")
+
+	// expireSoon sets the upload expiration time that is refreshed only if
+	// the upload offset is changed.
+	expireSoon := func() {
+		t.Helper()
+
+		u, err := storage.Get(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u.ExpiresAt = time.Now().Add(time.Minute)
+		if err := storage.Update(context.Background(), u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertExpiration := func(refreshed bool) {
+		t.Helper()
+
+		u, err := storage.Get(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := time.Until(u.ExpiresAt) > 59*time.Minute; got != refreshed {
+			t.Errorf("expected expiration refreshed %v, got expiration %v", refreshed, u.ExpiresAt)
+		}
+	}
+	patch := func(offset, checksum string, body io.Reader) *httptest.ResponseRecorder {
+		r := newRequest(http.MethodPatch, location, "")
+		r.Body = io.NopCloser(body)
+		r.ContentLength = -1
+		r.Header.Set("Upload-Offset", offset)
+		if checksum != "" {
+			sum := sha1.Sum([]byte(checksum))
+			r.Header.Set("Upload-Checksum", "sha1 "+base64.StdEncoding.EncodeToString(sum[:]))
+		}
+		return serve(h, r)
+	}
+	interrupted := func(data string) io.Reader {
+		return io.MultiReader(strings.NewReader(data), iotest.ErrReader(io.ErrUnexpectedEOF))
+	}
+
+	// Data of the chunk that is too large is discarded with checksum.
+	expireSoon()
+	w := patch("0", "hello", strings.NewReader("hello"))
+	assertStatus(t, w, http.StatusRequestEntityTooLarge)
+	assertHeader(t, w, "Upload-Offset", "0")
+	assertHeader(t, serve(h, newRequest(http.MethodHead, location, "")), "Upload-Offset", "0")
+	assertExpiration(false)
+
+	// Data of the interrupted chunk is discarded with checksum.
+	patch("0", "hel", interrupted("he"))
+	assertHeader(t, serve(h, newRequest(http.MethodHead, location, "")), "Upload-Offset", "0")
+	assertExpiration(false)
+
+	// Data of the chunk that is too large is kept up to the limit without
+	// checksum.
+	w = patch("0", "", strings.NewReader("hello"))
+	assertStatus(t, w, http.StatusRequestEntityTooLarge)
+	assertHeader(t, w, "Upload-Offset", "4")
+	assertHeader(t, serve(h, newRequest(http.MethodHead, location, "")), "Upload-Offset", "4")
+	assertExpiration(true)
+
+	// Data of the interrupted chunk is kept without checksum.
+	expireSoon()
+	patch("4", "", interrupted("wo"))
+	assertHeader(t, serve(h, newRequest(http.MethodHead, location, "")), "Upload-Offset", "6")
+	assertExpiration(true)
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package upload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// DirSink implements Sink that stores files in a directory on the local
+// filesystem under unique names.
+type DirSink struct {
+	dir string
+}
+
+// NewDirSink creates a new instance of DirSink. If dir is an empty string,
+// the default directory for temporary files is used.
+func NewDirSink(dir string) *DirSink {
+	return &DirSink{
+		dir: dir,
+	}
+}
+
+// Create creates a new file in the directory and sets its path to the File.
+func (s *DirSink) Create(_ context.Context, f *File) (io.WriteCloser, error) {
+	if s.dir != "" {
+		if err := os.MkdirAll(s.dir, 0o777); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.CreateTemp(s.dir, "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	f.Path = file.Name()
+	return file, nil
+}
+
+// Remove removes the file from the directory.
+func (s *DirSink) Remove(_ context.Context, f *File) error {
+	if f.Path == "" {
+		return nil
+	}
+	if err := os.Remove(f.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,435 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package upload provides an HTTP handler that streams multipart form files
+// to a directory or a custom Sink, validating them while they are received.
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"resenje.org/jsonhttp"
+
+	"resenje.org/web"
+)
+
+// Default limits used if they are not set by options.
+var (
+	DefaultMaxFiles           = 10
+	DefaultMaxFileSize  int64 = 32 << 20
+	DefaultMaxValueSize int64 = 1 << 20
+)
+
+// sniffLen is the number of bytes used by http.DetectContentType.
+const sniffLen = 512
+
+// File holds information about an uploaded file.
+type File struct {
+	// Field is the name of the form field.
+	Field string
+	// Filename is the name of the file provided by the client.
+	Filename string
+	// ContentType is the content type detected from the file content.
+	ContentType string
+	// Size is the number of bytes of the file.
+	Size int64
+	// Checksums are hex encoded checksums of the file content by the names
+	// of hash functions set with WithChecksum option.
+	Checksums map[string]string
+	// Path is the location of the file on disk if it is stored by DirSink.
+	Path string
+	// Header is the multipart part header.
+	Header textproto.MIMEHeader
+}
+
+// Form holds form values and files received by the Handler.
+type Form struct {
+	Values url.Values
+	Files  map[string][]*File
+}
+
+// Sink stores the content of uploaded files.
+type Sink interface {
+	// Create returns a writer to which the file content is written.
+	Create(ctx context.Context, f *File) (io.WriteCloser, error)
+	// Remove removes the stored file.
+	Remove(ctx context.Context, f *File) error
+}
+
+// Handler implements http.Handler interface that reads multipart form
+// from the request body, streams files to the Sink and calls the wrapped
+// handler with the Form stored in the request context.
+type Handler struct {
+	handler       http.Handler
+	dir           string
+	sink          Sink
+	maxFiles      int
+	maxFileSize   int64
+	maxValueSize  int64
+	extensions    []string
+	contentTypes  []string
+	checksums     map[string]func() hash.Hash
+	keepFiles     bool
+	errorsHandler func(w http.ResponseWriter, r *http.Request, errs web.FormErrors)
+	errorHandler  func(w http.ResponseWriter, r *http.Request, err error)
+	logger        *slog.Logger
+}
+
+// Option is a function that sets optional parameters to the Handler.
+type Option func(*Handler)
+
+// WithDir sets the directory where uploaded files are stored. The default
+// is the directory returned by os.TempDir.
+func WithDir(dir string) Option { return func(o *Handler) { o.dir = dir } }
+
+// WithSink sets a custom Sink for storing uploaded files. This option
+// has a precedence upon WithDir, regardless of the order of options.
+func WithSink(sink Sink) Option { return func(o *Handler) { o.sink = sink } }
+
+// WithMaxFiles sets the maximal number of files in one request.
+func WithMaxFiles(n int) Option { return func(o *Handler) { o.maxFiles = n } }
+
+// WithMaxFileSize sets the maximal size of a single file in bytes.
+func WithMaxFileSize(n int64) Option { return func(o *Handler) { o.maxFileSize = n } }
+
+// WithMaxValueSize sets the maximal size of a non-file form value in bytes.
+func WithMaxValueSize(n int64) Option { return func(o *Handler) { o.maxValueSize = n } }
+
+// WithExtensions sets the list of allowed filename extensions, such as ".png".
+// Extensions are compared case insensitively.
+func WithExtensions(extensions ...string) Option {
+	return func(o *Handler) { o.extensions = extensions }
+}
+
+// WithContentTypes sets the list of allowed media types or media ranges, such
+// as "image/*", which are compared with the content type detected from the
+// file content.
+func WithContentTypes(contentTypes ...string) Option {
+	return func(o *Handler) { o.contentTypes = contentTypes }
+}
+
+// WithChecksum adds a hash function that will be used to compute the checksum
+// of every file while it is streamed.
+func WithChecksum(name string, fn func() hash.Hash) Option {
+	return func(o *Handler) { o.checksums[name] = fn }
+}
+
+// WithKeepFiles prevents stored files from being removed after the wrapped
+// handler returns. By default, files are removed and the handler is expected
+// to copy or move them to a permanent location.
+func WithKeepFiles(yes bool) Option { return func(o *Handler) { o.keepFiles = yes } }
+
+// WithErrorsHandler sets the function that responds when the form is not
+// valid. By default, FormErrors are returned as a JSON-encoded body with the
+// Bad Request HTTP status.
+func WithErrorsHandler(fn func(w http.ResponseWriter, r *http.Request, errs web.FormErrors)) Option {
+	return func(o *Handler) { o.errorsHandler = fn }
+}
+
+// WithErrorHandler sets the function that will be used if there is an error
+// storing files. If it is not set, a panic will occur.
+func WithErrorHandler(fn func(w http.ResponseWriter, r *http.Request, err error)) Option {
+	return func(o *Handler) { o.errorHandler = fn }
+}
+
+// WithLogger sets the function that will perform message logging.
+// Default is slog.Default().
+func WithLogger(l *slog.Logger) Option { return func(o *Handler) { o.logger = l } }
+
+// New creates a new Handler that calls the handler with parsed Form.
+func New(handler http.Handler, options ...Option) (h *Handler) {
+	h = &Handler{
+		handler:      handler,
+		maxFiles:     DefaultMaxFiles,
+		maxFileSize:  DefaultMaxFileSize,
+		maxValueSize: DefaultMaxValueSize,
+		checksums:    make(map[string]func() hash.Hash),
+		errorsHandler: func(w http.ResponseWriter, r *http.Request, errs web.FormErrors) {
+			jsonhttp.BadRequest(w, errs)
+		},
+		logger: slog.Default(),
+	}
+	for _, option := range options {
+		option(h)
+	}
+	if h.sink == nil {
+		h.sink = NewDirSink(h.dir)
+	}
+	return
+}
+
+// ServeHTTP implements http.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		h.errorsHandler(w, r, invalidFormErrors())
+		return
+	}
+
+	form := &Form{
+		Values: make(url.Values),
+		Files:  make(map[string][]*File),
+	}
+	var errs web.FormErrors
+	err = h.read(ctx, mr, form, &errs)
+	if err != nil || errs.HasErrors() {
+		h.removeFiles(ctx, form)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// The client is gone and there is nobody to respond to.
+			h.logger.DebugContext(ctx, "upload: request canceled", "error", err)
+			return
+		}
+		if errors.Is(err, errInvalidForm) {
+			h.errorsHandler(w, r, invalidFormErrors())
+			return
+		}
+		h.error(w, r, err)
+		return
+	}
+	if errs.HasErrors() {
+		h.errorsHandler(w, r, errs)
+		return
+	}
+
+	if !h.keepFiles {
+		defer h.removeFiles(ctx, form)
+	}
+	h.handler.ServeHTTP(w, r.WithContext(NewFormContext(ctx, form)))
+}
+
+var (
+	errInvalidForm = errors.New("invalid multipart form")
+
+	fileTypeNotAllowedMessage = web.FormMessage{Code: "file_type_not_allowed", Text: "file type not allowed"}
+)
+
+func invalidFormErrors() (errs web.FormErrors) {
+	errs.AddErrorMessage(web.FormMessage{Code: "invalid_form", Text: errInvalidForm.Error()})
+	return errs
+}
+
+func (h *Handler) read(ctx context.Context, mr *multipart.Reader, form *Form, errs *web.FormErrors) error {
+	var files int
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", errInvalidForm, err)
+		}
+		field := part.FormName()
+		if field == "" {
+			part.Close()
+			continue
+		}
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, h.maxValueSize+1))
+			part.Close()
+			if err != nil {
+				return fmt.Errorf("%w: %w", errInvalidForm, err)
+			}
+			if int64(len(value)) > h.maxValueSize {
+				errs.AddFieldErrorMessage(field, web.FormMessage{
+					Code:   "value_too_large",
+					Params: map[string]string{"limit": strconv.FormatInt(h.maxValueSize, 10)},
+					Text:   "value too large",
+				})
+				continue
+			}
+			form.Values.Add(field, string(value))
+			continue
+		}
+		files++
+		if h.maxFiles > 0 && files > h.maxFiles {
+			part.Close()
+			errs.AddFieldErrorMessage(field, web.FormMessage{
+				Code:   "too_many_files",
+				Params: map[string]string{"limit": strconv.Itoa(h.maxFiles)},
+				Text:   "too many files",
+			})
+			continue
+		}
+		f, err := h.store(ctx, part, errs)
+		part.Close()
+		if f != nil {
+			form.Files[field] = append(form.Files[field], f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// store validates and writes the file to the sink. It returns a non-nil File
+// if the file is created in the sink, even if the file is not valid, so that
+// it can be removed.
+func (h *Handler) store(ctx context.Context, part *multipart.Part, errs *web.FormErrors) (*File, error) {
+	f := &File{
+		Field:    part.FormName(),
+		Filename: filepath.Base(part.FileName()),
+		Header:   part.Header,
+	}
+
+	if len(h.extensions) > 0 && !containsFold(h.extensions, filepath.Ext(f.Filename)) {
+		errs.AddFieldErrorMessage(f.Field, fileTypeNotAllowedMessage)
+		return nil, nil
+	}
+
+	r := &contextReader{ctx: ctx, r: part}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, readError(err)
+	}
+	head = head[:n]
+	f.ContentType = http.DetectContentType(head)
+	if len(h.contentTypes) > 0 && !matchContentType(h.contentTypes, f.ContentType) {
+		errs.AddFieldErrorMessage(f.Field, fileTypeNotAllowedMessage)
+		return nil, nil
+	}
+
+	wc, err := h.sink.Create(ctx, f)
+	if err != nil {
+		return nil, fmt.Errorf("create file: %w", err)
+	}
+
+	hashes := make(map[string]hash.Hash, len(h.checksums))
+	writers := []io.Writer{wc}
+	for name, fn := range h.checksums {
+		hh := fn()
+		hashes[name] = hh
+		writers = append(writers, hh)
+	}
+	dst := io.MultiWriter(writers...)
+
+	src := io.MultiReader(bytes.NewReader(head), r)
+	size, err := io.Copy(dst, io.LimitReader(src, h.maxFileSize+1))
+	if cerr := wc.Close(); err == nil && cerr != nil {
+		return f, fmt.Errorf("close file: %w", cerr)
+	}
+	if err != nil {
+		return f, readError(err)
+	}
+	if size > h.maxFileSize {
+		errs.AddFieldErrorMessage(f.Field, web.FormMessage{
+			Code:   "file_too_large",
+			Params: map[string]string{"limit": strconv.FormatInt(h.maxFileSize, 10)},
+			Text:   "file too large",
+		})
+		return f, nil
+	}
+
+	f.Size = size
+	f.Checksums = make(map[string]string, len(hashes))
+	for name, hh := range hashes {
+		f.Checksums[name] = hex.EncodeToString(hh.Sum(nil))
+	}
+	return f, nil
+}
+
+func (h *Handler) removeFiles(ctx context.Context, form *Form) {
+	ctx = context.WithoutCancel(ctx)
+	for _, files := range form.Files {
+		for _, f := range files {
+			if err := h.sink.Remove(ctx, f); err != nil {
+				h.logger.ErrorContext(ctx, "upload: remove file", "field", f.Field, "filename", f.Filename, "error", err)
+			}
+		}
+	}
+}
+
+func (h *Handler) error(w http.ResponseWriter, r *http.Request, err error) {
+	if h.errorHandler == nil {
+		panic(err)
+	}
+	h.errorHandler(w, r, err)
+}
+
+type contextKeyForm struct{}
+
+// NewFormContext returns a context that contains the given Form.
+func NewFormContext(ctx context.Context, f *Form) context.Context {
+	return context.WithValue(ctx, contextKeyForm{}, f)
+}
+
+// FormFromContext returns the Form stored in ctx by the Handler, or nil if
+// there is none.
+func FormFromContext(ctx context.Context) *Form {
+	if f, ok := ctx.Value(contextKeyForm{}).(*Form); ok {
+		return f
+	}
+	return nil
+}
+
+// contextReader stops reading when the context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// readError marks errors from the request body as invalid form errors, while
+// keeping context errors intact.
+func readError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", errInvalidForm, err)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, e := range list {
+		if strings.EqualFold(e, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchContentType(mediaRanges []string, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, mr := range mediaRanges {
+		mr = strings.ToLower(mr)
+		if mr == "*/*" || mr == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(mr, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
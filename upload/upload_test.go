@@ -0,0 +1,320 @@
+// Copyright (c) 2024, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package upload_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"resenje.org/web"
+	"resenje.org/web/upload"
+)
+
+var pngHeader = "\x89PNG\x0D\x0A\x1A\x0A"
+
+type testPart struct {
+	field    string
+	filename string
+	content  string
+}
+
+func newRequest(t *testing.T, parts ...testPart) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, p := range parts {
+		if p.filename == "" {
+			if err := mw.WriteField(p.field, p.content); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		fw, err := mw.CreateFormFile(p.field, p.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(fw, p.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	content := pngHeader + strings.Repeat("0", 1000)
+
+	var form *upload.Form
+	var stored string
+	h := upload.New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		form = upload.FormFromContext(r.Context())
+		b, err := os.ReadFile(form.Files["image"][0].Path)
+		if err != nil {
+			t.Error(err)
+		}
+		stored = string(b)
+	}),
+		upload.WithDir(dir),
+		upload.WithChecksum("sha256", sha256.New),
+		upload.WithExtensions(".png"),
+		upload.WithContentTypes("image/*"),
+	)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newRequest(t,
+		testPart{field: "title", content: "resenje"},
+		testPart{field: "image", filename: "test.PNG", content: content},
+	))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if v := form.Values.Get("title"); v != "resenje" {
+		t.Errorf("expected value %q, got %q", "resenje", v)
+	}
+	f := form.Files["image"][0]
+	if f.Filename != "test.PNG" {
+		t.Errorf("expected filename %q, got %q", "test.PNG", f.Filename)
+	}
+	if f.ContentType != "image/png" {
+		t.Errorf("expected content type %q, got %q", "image/png", f.ContentType)
+	}
+	if f.Size != int64(len(content)) {
+		t.Errorf("expected size %v, got %v", len(content), f.Size)
+	}
+	sum := sha256.Sum256([]byte(content))
+	if v := f.Checksums["sha256"]; v != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected checksum %q, got %q", hex.EncodeToString(sum[:]), v)
+	}
+	if stored != content {
+		t.Error("stored file content does not match")
+	}
+	assertEmptyDir(t, dir)
+}
+
+func TestHandler_KeepFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	var form *upload.Form
+	h := upload.New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		form = upload.FormFromContext(r.Context())
+	}),
+		upload.WithDir(dir),
+		upload.WithKeepFiles(true),
+	)
+
+	h.ServeHTTP(httptest.NewRecorder(), newRequest(t,
+		testPart{field: "file", filename: "test.txt", content: "resenje"},
+	))
+
+	b, err := os.ReadFile(form.Files["file"][0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "resenje" {
+		t.Errorf("expected file content %q, got %q", "resenje", string(b))
+	}
+}
+
+func TestHandler_SinkPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	sinkDir := t.TempDir()
+
+	var form *upload.Form
+	h := upload.New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		form = upload.FormFromContext(r.Context())
+	}),
+		upload.WithSink(upload.NewDirSink(sinkDir)),
+		upload.WithDir(dir),
+		upload.WithKeepFiles(true),
+	)
+
+	h.ServeHTTP(httptest.NewRecorder(), newRequest(t,
+		testPart{field: "file", filename: "test.txt", content: "resenje"},
+	))
+
+	if got := filepath.Dir(form.Files["file"][0].Path); got != sinkDir {
+		t.Errorf("expected file in directory %q, got %q", sinkDir, got)
+	}
+	assertEmptyDir(t, dir)
+}
+
+func TestHandler_Validation(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		options []upload.Option
+		parts   []testPart
+		want    web.FormErrors
+	}{
+		{
+			name:    "max files",
+			options: []upload.Option{upload.WithMaxFiles(1)},
+			parts: []testPart{
+				{field: "file", filename: "1.txt", content: "1"},
+				{field: "file", filename: "2.txt", content: "2"},
+			},
+			want: fieldError("file", web.FormMessage{Code: "too_many_files", Params: map[string]string{"limit": "1"}, Text: "too many files"}),
+		},
+		{
+			name:    "max file size",
+			options: []upload.Option{upload.WithMaxFileSize(10)},
+			parts: []testPart{
+				{field: "file", filename: "1.txt", content: "01234567890"},
+			},
+			want: fieldError("file", web.FormMessage{Code: "file_too_large", Params: map[string]string{"limit": "10"}, Text: "file too large"}),
+		},
+		{
+			name:    "max value size",
+			options: []upload.Option{upload.WithMaxValueSize(3)},
+			parts: []testPart{
+				{field: "name", content: "resenje"},
+			},
+			want: fieldError("name", web.FormMessage{Code: "value_too_large", Params: map[string]string{"limit": "3"}, Text: "value too large"}),
+		},
+		{
+			name:    "extension",
+			options: []upload.Option{upload.WithExtensions(".png", ".jpg")},
+			parts: []testPart{
+				{field: "image", filename: "image.gif", content: "GIF89a"},
+			},
+			want: fieldError("image", web.FormMessage{Code: "file_type_not_allowed", Text: "file type not allowed"}),
+		},
+		{
+			name:    "content type",
+			options: []upload.Option{upload.WithContentTypes("image/png")},
+			parts: []testPart{
+				{field: "image", filename: "image.png", content: "GIF89a"},
+			},
+			want: fieldError("image", web.FormMessage{Code: "file_type_not_allowed", Text: "file type not allowed"}),
+		},
+		{
+			name:    "multiple errors",
+			options: []upload.Option{upload.WithMaxFileSize(2), upload.WithMaxValueSize(2)},
+			parts: []testPart{
+				{field: "name", content: "resenje"},
+				{field: "file", filename: "1.txt", content: "ok"},
+				{field: "other", filename: "2.txt", content: "resenje"},
+			},
+			want: web.FormErrors{FieldErrors: map[string][]web.FormMessage{
+				"name":  {{Code: "value_too_large", Params: map[string]string{"limit": "2"}, Text: "value too large"}},
+				"other": {{Code: "file_too_large", Params: map[string]string{"limit": "2"}, Text: "file too large"}},
+			}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			h := upload.New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("handler called")
+			}), append(tc.options, upload.WithDir(dir))...)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, newRequest(t, tc.parts...))
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+			}
+			var got web.FormErrors
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected errors %+v, got %+v", tc.want, got)
+			}
+			assertEmptyDir(t, dir)
+		})
+	}
+}
+
+func fieldError(field string, m web.FormMessage) (errs web.FormErrors) {
+	errs.AddFieldErrorMessage(field, m)
+	return errs
+}
+
+func TestHandler_InvalidForm(t *testing.T) {
+	h := upload.New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called")
+	}))
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader("resenje"))
+	r.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandler_ContextCanceled(t *testing.T) {
+	dir := t.TempDir()
+
+	h := upload.New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called")
+	}), upload.WithDir(dir))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := newRequest(t, testPart{field: "file", filename: "1.txt", content: strings.Repeat("0", 10000)})
+	r = r.WithContext(ctx)
+	r.Body = &cancelingReader{r: r.Body, cancel: cancel, after: 1000}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assertEmptyDir(t, dir)
+}
+
+type cancelingReader struct {
+	r      io.ReadCloser
+	cancel context.CancelFunc
+	after  int
+	n      int
+}
+
+func (r *cancelingReader) Read(p []byte) (int, error) {
+	if len(p) > 10 {
+		p = p[:10]
+	}
+	n, err := r.r.Read(p)
+	r.n += n
+	if r.n >= r.after {
+		r.cancel()
+	}
+	return n, err
+}
+
+func (r *cancelingReader) Close() error {
+	return r.r.Close()
+}
+
+func assertEmptyDir(t *testing.T, dir string) {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected empty directory, got %v entries", len(entries))
+	}
+}